@@ -0,0 +1,260 @@
+// package accuracy checks how well the carriers keep their promises, by comparing the arrival they quoted with the
+// time the package was actually delivered.
+package accuracy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+var (
+	ErrFailedToApplyOption   = errors.New("failed to apply option")
+	ErrFailedToCreateMetrics = errors.New("failed to create metric from provider")
+	ErrInvalidConfirmation   = errors.New("invalid confirmation")
+)
+
+// Window is how long after the quoted arrival a package can be delivered, and still be on time. Carriers estimate
+// the arrival within 6 hours.
+const Window = 6 * time.Hour
+
+// DefaultCapacity is how many confirmations are kept. See WithCapacity.
+const DefaultCapacity = 100_000
+
+// Buckets are the upper bounds of the lateness histogram, in hours. Packages that are on time are 0 hours late.
+var Buckets = []float64{0, 1, 6, 12, 24, 48, 96}
+
+type Option func(t *Tracker) error
+
+var Defaults = []Option{
+	WithMeter(otel.Meter("github.com/andrewhowdencom/courses.pito/delivery-service/accuracy")),
+}
+
+// Confirmation is a report that a package was delivered.
+type Confirmation struct {
+	// Provider is the carrier that delivered the package.
+	Provider string `json:"provider"`
+
+	// Quoted is the arrival the carrier quoted.
+	Quoted time.Time `json:"quoted_arrival"`
+
+	// Delivered is when the package was actually delivered.
+	Delivered time.Time `json:"delivered"`
+}
+
+// Lateness is how long after the end of the quoted window the package was delivered. It is zero for packages that
+// were on time (or early).
+func (c *Confirmation) Lateness() time.Duration {
+	late := c.Delivered.Sub(c.Quoted.Add(Window))
+	if late < 0 {
+		return 0
+	}
+
+	return late
+}
+
+// Bucket is a single bar of the lateness histogram.
+type Bucket struct {
+	// UpTo is the upper bound of the bucket (inclusive), in hours late. The last bucket has no upper bound, and is
+	// omitted.
+	UpTo *float64 `json:"up_to,omitempty"`
+
+	// Count is the number of deliveries within the bucket.
+	Count int64 `json:"count"`
+}
+
+// Summary is how accurate a carrier was over a period of time.
+type Summary struct {
+	Provider string `json:"provider"`
+
+	// Deliveries is the number of confirmed deliveries, and OnTime how many of those were on time.
+	Deliveries int64 `json:"deliveries"`
+	OnTime     int64 `json:"on_time"`
+
+	// OnTimePercentage is OnTime as a percentage of the Deliveries.
+	OnTimePercentage float64 `json:"on_time_percentage"`
+
+	// Lateness is the histogram of how late deliveries were, with a bucket for each of Buckets and one for the
+	// deliveries later than that.
+	Lateness []Bucket `json:"lateness"`
+}
+
+// Tracker records delivery confirmations, and summarises them per carrier.
+type Tracker struct {
+	opts struct {
+		m metric.Meter
+	}
+
+	metrics struct {
+		confirmations metric.Int64Counter
+		lateness      metric.Float64Histogram
+	}
+
+	// confirmations are the most recent confirmations, oldest first. There are at most capacity of them.
+	mu            sync.RWMutex
+	confirmations []*Confirmation
+	capacity      int
+}
+
+// New creates a tracker. As with the carriers, the default options should be extended when this function is used.
+func New(opts ...Option) (*Tracker, error) {
+	t := &Tracker{capacity: DefaultCapacity}
+
+	for _, o := range opts {
+		if err := o(t); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrFailedToApplyOption, err)
+		}
+	}
+
+	// If there is no meter, add one so we're safe.
+	if t.opts.m == nil {
+		t.opts.m = noop.NewMeterProvider().Meter("noop")
+	}
+
+	var err error
+	if t.metrics.confirmations, err = t.opts.m.Int64Counter(
+		"delivery.confirmations",
+		metric.WithDescription("Confirmed deliveries, by provider and whether they arrived within the quoted window"),
+	); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFailedToCreateMetrics, err)
+	}
+
+	if t.metrics.lateness, err = t.opts.m.Float64Histogram(
+		"delivery.lateness",
+		metric.WithDescription("How long after the quoted window deliveries arrived"),
+		metric.WithUnit("h"),
+	); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFailedToCreateMetrics, err)
+	}
+
+	// The on time percentage can be derived from the counter, but is exported directly as it is the number people
+	// ask for.
+	if _, err = t.opts.m.Float64ObservableGauge(
+		"delivery.on_time.ratio",
+		metric.WithDescription("The ratio of confirmed deliveries that arrived within the quoted window, by provider"),
+		metric.WithFloat64Callback(t.observeOnTime),
+	); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFailedToCreateMetrics, err)
+	}
+
+	return t, nil
+}
+
+// WithMeter applies a specific meter provider to the tracker. Used mostly in testing.
+func WithMeter(m metric.Meter) Option {
+	return func(t *Tracker) error {
+		t.opts.m = m
+
+		return nil
+	}
+}
+
+// WithCapacity sets how many confirmations are kept. Once there are more, the oldest (by when they were confirmed) are
+// removed; they are still counted in the metrics, but no longer summarised.
+func WithCapacity(n int) Option {
+	return func(t *Tracker) error {
+		if n <= 0 {
+			return fmt.Errorf("capacity must be positive: %d", n)
+		}
+
+		t.capacity = n
+
+		return nil
+	}
+}
+
+// Confirm records that a package was delivered.
+func (t *Tracker) Confirm(ctx context.Context, c *Confirmation) error {
+	if c.Provider == "" || c.Quoted.IsZero() || c.Delivered.IsZero() {
+		return fmt.Errorf("%w: provider, quoted arrival and delivery time are all required", ErrInvalidConfirmation)
+	}
+
+	late := c.Lateness()
+	attrs := metric.WithAttributes(
+		attribute.String("provider", c.Provider),
+		attribute.Bool("on_time", late == 0),
+	)
+
+	t.metrics.confirmations.Add(ctx, 1, attrs)
+	t.metrics.lateness.Record(ctx, late.Hours(), metric.WithAttributes(attribute.String("provider", c.Provider)))
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.confirmations = append(t.confirmations, c)
+
+	// Hint: The oldest confirmations are sliced off, rather than copied over, so the array behind them is only freed
+	// as append grows it.
+	if n := len(t.confirmations); n > t.capacity {
+		t.confirmations[0] = nil
+		t.confirmations = t.confirmations[n-t.capacity:]
+	}
+
+	return nil
+}
+
+// Summarise returns the accuracy of each carrier for the deliveries between the two times (inclusive), ordered by
+// provider.
+func (t *Tracker) Summarise(from, to time.Time) []*Summary {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	summaries := map[string]*Summary{}
+
+	for _, c := range t.confirmations {
+		if c.Delivered.Before(from) || c.Delivered.After(to) {
+			continue
+		}
+
+		s, ok := summaries[c.Provider]
+		if !ok {
+			s = &Summary{Provider: c.Provider, Lateness: make([]Bucket, len(Buckets)+1)}
+			for i := range Buckets {
+				s.Lateness[i].UpTo = &Buckets[i]
+			}
+
+			summaries[c.Provider] = s
+		}
+
+		late := c.Lateness()
+
+		s.Deliveries++
+		if late == 0 {
+			s.OnTime++
+		}
+
+		// The first bucket the lateness fits within. If it fits none, it is in the last (unbounded) bucket.
+		i := sort.SearchFloat64s(Buckets, late.Hours())
+		s.Lateness[i].Count++
+	}
+
+	out := make([]*Summary, 0, len(summaries))
+	for _, s := range summaries {
+		s.OnTimePercentage = 100 * float64(s.OnTime) / float64(s.Deliveries)
+		out = append(out, s)
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Provider < out[j].Provider })
+
+	return out
+}
+
+// end is later than any delivery, such that summarising up to it includes every delivery that is kept.
+var end = time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC)
+
+// observeOnTime reports the on time ratio of each provider, over all the deliveries that are kept.
+func (t *Tracker) observeOnTime(_ context.Context, o metric.Float64Observer) error {
+	for _, s := range t.Summarise(time.Time{}, end) {
+		o.Observe(float64(s.OnTime)/float64(s.Deliveries), metric.WithAttributes(attribute.String("provider", s.Provider)))
+	}
+
+	return nil
+}
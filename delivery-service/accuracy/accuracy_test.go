@@ -0,0 +1,28 @@
+package accuracy
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCapacity(t *testing.T) {
+	tr, err := New(WithCapacity(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	quoted := time.Date(2023, 9, 11, 18, 0, 0, 0, time.UTC)
+
+	// The first confirmation (which is late) is the one that is removed.
+	for _, late := range []time.Duration{12 * time.Hour, 0, time.Hour} {
+		if err := tr.Confirm(context.Background(), &Confirmation{Provider: "svx", Quoted: quoted, Delivered: quoted.Add(late)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := tr.Summarise(time.Time{}, quoted.Add(24*time.Hour))
+	if len(s) != 1 || s[0].Deliveries != 2 || s[0].OnTime != 2 {
+		t.Errorf("expected 2 deliveries on time, got %+v", s)
+	}
+}
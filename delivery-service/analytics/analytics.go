@@ -0,0 +1,267 @@
+// package analytics summarises the quote log; which carriers win the most business, what delivery costs for packages
+// of different weights, and how often clients are left without any options at all.
+package analytics
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/money"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/quotelog"
+)
+
+// Band is a range of package weights, in grams. The upper bound is exclusive, and zero for the last band.
+type Band struct {
+	Name string `json:"name"`
+	From int64  `json:"from"`
+	To   int64  `json:"to,omitempty"`
+}
+
+// Bands are the weight bands prices are summarised by.
+var Bands = []Band{
+	{Name: "0-1kg", From: 0, To: 1_000},
+	{Name: "1-5kg", From: 1_000, To: 5_000},
+	{Name: "5-10kg", From: 5_000, To: 10_000},
+	{Name: "10-20kg", From: 10_000, To: 20_000},
+	{Name: "20kg+", From: 20_000},
+}
+
+// Carrier is how often a single carrier won.
+type Carrier struct {
+	Provider string `json:"provider"`
+
+	// Offered is the number of requests in which the carrier offered at least one option.
+	Offered int64 `json:"offered"`
+
+	// Wins is the number of requests in which the carrier offered the cheapest option.
+	Wins int64 `json:"wins"`
+
+	// WinRate is Wins as a ratio of the requests that were compared.
+	WinRate float64 `json:"win_rate"`
+}
+
+// Prices are the percentiles of the cost of options, for packages within a weight band, in a single currency. The
+// costs are in the minor unit of the currency (for example, cents).
+type Prices struct {
+	Band     string `json:"band"`
+	Currency string `json:"currency"`
+	Options  int64  `json:"options"`
+	P50      int64  `json:"p50"`
+	P90      int64  `json:"p90"`
+	P99      int64  `json:"p99"`
+}
+
+// Report summarises the quote log.
+type Report struct {
+	// From and To are the times of the first and last entries.
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+
+	// Requests is the number of requests, and Empty the number of those without any options.
+	Requests  int64   `json:"requests"`
+	Empty     int64   `json:"empty"`
+	EmptyRate float64 `json:"empty_rate"`
+
+	// Compared is the number of requests in which the options could be compared to find a winner. Options in
+	// different currencies can only be compared with exchange rates.
+	Compared int64 `json:"compared"`
+
+	Carriers []Carrier `json:"carriers"`
+	Prices   []Prices  `json:"prices"`
+}
+
+// Aggregator builds a report from entries in the quote log.
+type Aggregator struct {
+	// rates convert costs into a single currency such that they can be compared. May be nil.
+	rates *money.Rates
+
+	report   Report
+	carriers map[string]*Carrier
+
+	// costs are the costs of options, keyed by band and then currency.
+	costs map[string]map[string][]int64
+}
+
+// New creates an aggregator. The rates are optional.
+func New(rates *money.Rates) *Aggregator {
+	return &Aggregator{
+		rates:    rates,
+		carriers: make(map[string]*Carrier),
+		costs:    make(map[string]map[string][]int64),
+	}
+}
+
+// Add adds an entry to the report.
+func (a *Aggregator) Add(e *quotelog.Entry) error {
+	if a.report.From.IsZero() || e.Time.Before(a.report.From) {
+		a.report.From = e.Time
+	}
+
+	if e.Time.After(a.report.To) {
+		a.report.To = e.Time
+	}
+
+	a.report.Requests++
+
+	if len(e.Options) == 0 {
+		a.report.Empty++
+		return nil
+	}
+
+	band := BandOf(e.Package.Weight)
+	offered := map[string]bool{}
+
+	for _, o := range e.Options {
+		offered[o.Provider] = true
+
+		if a.costs[band.Name] == nil {
+			a.costs[band.Name] = make(map[string][]int64)
+		}
+
+		a.costs[band.Name][o.Cost.Currency] = append(a.costs[band.Name][o.Cost.Currency], o.Cost.Total)
+	}
+
+	for p := range offered {
+		a.carrier(p).Offered++
+	}
+
+	if winner, ok := a.winner(e.Options); ok {
+		a.report.Compared++
+		a.carrier(winner).Wins++
+	}
+
+	return nil
+}
+
+// Report returns the report of all entries added so far.
+func (a *Aggregator) Report() *Report {
+	r := a.report
+	r.Carriers = []Carrier{}
+	r.Prices = []Prices{}
+
+	if r.Requests > 0 {
+		r.EmptyRate = float64(r.Empty) / float64(r.Requests)
+	}
+
+	for _, c := range a.carriers {
+		c := *c
+		if r.Compared > 0 {
+			c.WinRate = float64(c.Wins) / float64(r.Compared)
+		}
+
+		r.Carriers = append(r.Carriers, c)
+	}
+
+	sort.Slice(r.Carriers, func(i, j int) bool { return r.Carriers[i].Provider < r.Carriers[j].Provider })
+
+	for _, b := range Bands {
+		currencies := make([]string, 0, len(a.costs[b.Name]))
+		for c := range a.costs[b.Name] {
+			currencies = append(currencies, c)
+		}
+
+		sort.Strings(currencies)
+
+		for _, c := range currencies {
+			costs := append([]int64{}, a.costs[b.Name][c]...)
+			sort.Slice(costs, func(i, j int) bool { return costs[i] < costs[j] })
+
+			r.Prices = append(r.Prices, Prices{
+				Band:     b.Name,
+				Currency: c,
+				Options:  int64(len(costs)),
+				P50:      percentile(costs, 50),
+				P90:      percentile(costs, 90),
+				P99:      percentile(costs, 99),
+			})
+		}
+	}
+
+	return &r
+}
+
+// Aggregate builds a report from the quote log at the path, including the rotated files.
+func Aggregate(path string, maxBackups int, rates *money.Rates) (*Report, error) {
+	a := New(rates)
+	if err := quotelog.Read(path, maxBackups, a.Add); err != nil {
+		return nil, err
+	}
+
+	return a.Report(), nil
+}
+
+// BandOf returns the band the weight (in grams) falls within.
+func BandOf(weight int64) Band {
+	for _, b := range Bands {
+		if weight >= b.From && (b.To == 0 || weight < b.To) {
+			return b
+		}
+	}
+
+	// Weights are never negative, but if one is, it is lighter than anything else.
+	return Bands[0]
+}
+
+// carrier returns the statistics of the provider, creating them if needed.
+func (a *Aggregator) carrier(provider string) *Carrier {
+	c, ok := a.carriers[provider]
+	if !ok {
+		c = &Carrier{Provider: provider}
+		a.carriers[provider] = c
+	}
+
+	return c
+}
+
+// winner returns the provider of the cheapest option. The costs are compared directly if all are in the same
+// currency, and otherwise converted into the base currency of the rates. If they cannot be compared, there is no
+// winner.
+func (a *Aggregator) winner(opts []quotelog.Option) (string, bool) {
+	var (
+		winner string
+		best   int64 = math.MaxInt64
+	)
+
+	same := true
+	for _, o := range opts {
+		same = same && o.Cost.Currency == opts[0].Cost.Currency
+	}
+
+	for _, o := range opts {
+		cost := o.Cost.Total
+
+		if !same {
+			if a.rates == nil {
+				return "", false
+			}
+
+			conv, err := a.rates.Convert(o.Cost, a.rates.Base, money.RoundHalfUp)
+			if err != nil {
+				return "", false
+			}
+
+			cost = conv.Amount.Total
+		}
+
+		if cost < best {
+			winner, best = o.Provider, cost
+		}
+	}
+
+	return winner, true
+}
+
+// percentile returns the nearest-rank percentile of the sorted values.
+func percentile(sorted []int64, p float64) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+
+	return sorted[rank-1]
+}
@@ -0,0 +1,169 @@
+package analytics
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/carriers"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/money"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/quotelog"
+)
+
+func TestPercentile(t *testing.T) {
+	tens := []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+
+	for _, tc := range []struct {
+		name   string
+		sorted []int64
+		p      float64
+		want   int64
+	}{
+		{"median", tens, 50, 5},
+		{"p90", tens, 90, 9},
+		{"p99 rounds the rank up", tens, 99, 10},
+		{"p100", tens, 100, 10},
+		{"p0 is the smallest", tens, 0, 1},
+		{"single value", []int64{42}, 99, 42},
+		{"two values", []int64{320, 590}, 50, 320},
+		{"no values", nil, 50, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := percentile(tc.sorted, tc.p); got != tc.want {
+				t.Errorf("expected %d, got %d", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestBandOf(t *testing.T) {
+	for _, tc := range []struct {
+		weight int64
+		want   string
+	}{
+		{0, "0-1kg"},
+		{999, "0-1kg"},
+		{1_000, "1-5kg"},
+		{19_999, "10-20kg"},
+		{20_000, "20kg+"},
+		{-1, "0-1kg"},
+	} {
+		if got := BandOf(tc.weight).Name; got != tc.want {
+			t.Errorf("expected %dg to be in %s, got %s", tc.weight, tc.want, got)
+		}
+	}
+}
+
+// option is an option in the log, from the provider at the cost.
+func option(provider string, total int64, currency string) quotelog.Option {
+	return quotelog.Option{Provider: provider, Cost: &money.Money{Total: total, Currency: currency}}
+}
+
+func TestReport(t *testing.T) {
+	start := time.Date(2023, 9, 9, 12, 0, 0, 0, time.UTC)
+
+	entries := []*quotelog.Entry{
+		{
+			Time:    start.Add(time.Hour),
+			Package: &carriers.Package{Weight: 500},
+			Options: []quotelog.Option{option("svx", 590, "EUR"), option("hid", 320, "EUR"), option("svx", 640, "EUR")},
+		},
+		{
+			// The earliest, even though it is not the first. The options can only be compared with rates.
+			Time:    start,
+			Package: &carriers.Package{Weight: 2_500},
+			Options: []quotelog.Option{option("svx", 815, "EUR"), option("mmc", 600, "GBP")},
+		},
+		{
+			Time:    start.Add(2 * time.Hour),
+			Package: &carriers.Package{Weight: 2_500},
+		},
+		{
+			Time:    start.Add(3 * time.Hour),
+			Package: &carriers.Package{Weight: 25_000},
+			Options: []quotelog.Option{option("svx", 2_840, "EUR")},
+		},
+	}
+
+	// 600 GBP is about 698 EUR, so is cheaper.
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "rates.json"), []byte(`{"source": "test", "base": "EUR", "rates": {"GBP": "0.86"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	rates, err := money.LoadRates(filepath.Join(dir, "rates.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prices := []Prices{
+		{Band: "0-1kg", Currency: "EUR", Options: 3, P50: 590, P90: 640, P99: 640},
+		{Band: "1-5kg", Currency: "EUR", Options: 1, P50: 815, P90: 815, P99: 815},
+		{Band: "1-5kg", Currency: "GBP", Options: 1, P50: 600, P90: 600, P99: 600},
+		{Band: "20kg+", Currency: "EUR", Options: 1, P50: 2_840, P90: 2_840, P99: 2_840},
+	}
+
+	for _, tc := range []struct {
+		name     string
+		rates    *money.Rates
+		compared int64
+		carriers []Carrier
+	}{
+		{
+			name:     "with rates",
+			rates:    rates,
+			compared: 3,
+			carriers: []Carrier{
+				{Provider: "hid", Offered: 1, Wins: 1, WinRate: 1.0 / 3},
+				{Provider: "mmc", Offered: 1, Wins: 1, WinRate: 1.0 / 3},
+				{Provider: "svx", Offered: 3, Wins: 1, WinRate: 1.0 / 3},
+			},
+		},
+		{
+			name:     "without rates",
+			compared: 2,
+			carriers: []Carrier{
+				{Provider: "hid", Offered: 1, Wins: 1, WinRate: 0.5},
+				{Provider: "mmc", Offered: 1, Wins: 0, WinRate: 0},
+				{Provider: "svx", Offered: 3, Wins: 1, WinRate: 0.5},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a := New(tc.rates)
+			for _, e := range entries {
+				if err := a.Add(e); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			r := a.Report()
+
+			if !r.From.Equal(start) || !r.To.Equal(start.Add(3*time.Hour)) {
+				t.Errorf("expected the report to be from %s to %s, got %s to %s", start, start.Add(3*time.Hour), r.From, r.To)
+			}
+
+			if r.Requests != 4 || r.Empty != 1 || r.EmptyRate != 0.25 || r.Compared != tc.compared {
+				t.Errorf("expected 4 requests, 1 empty (0.25) and %d compared, got %d, %d (%g) and %d", tc.compared, r.Requests, r.Empty, r.EmptyRate, r.Compared)
+			}
+
+			if !slices.Equal(r.Carriers, tc.carriers) {
+				t.Errorf("expected carriers %+v, got %+v", tc.carriers, r.Carriers)
+			}
+
+			if !slices.Equal(r.Prices, prices) {
+				t.Errorf("expected prices %+v, got %+v", prices, r.Prices)
+			}
+		})
+	}
+}
+
+func TestReportEmpty(t *testing.T) {
+	r := New(nil).Report()
+
+	if r.Requests != 0 || r.EmptyRate != 0 || len(r.Carriers) != 0 || len(r.Prices) != 0 {
+		t.Errorf("expected an empty report, got %+v", r)
+	}
+}
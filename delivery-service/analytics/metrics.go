@@ -0,0 +1,80 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var ErrFailedToCreateMetrics = errors.New("failed to create metric from provider")
+
+// Observe exports the report returned by the function as metrics, each time they are collected. The function should
+// be cheap (for example, return a report built earlier) and may return nil if there is no report yet.
+func Observe(m metric.Meter, report func() *Report) error {
+	requests, err := m.Int64ObservableGauge(
+		"analytics.requests",
+		metric.WithDescription("The number of requests for delivery options in the quote log"),
+	)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrFailedToCreateMetrics, err)
+	}
+
+	empty, err := m.Float64ObservableGauge(
+		"analytics.empty.ratio",
+		metric.WithDescription("The ratio of requests for delivery options that had no options"),
+	)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrFailedToCreateMetrics, err)
+	}
+
+	wins, err := m.Float64ObservableGauge(
+		"analytics.win.ratio",
+		metric.WithDescription("The ratio of compared requests in which the provider offered the cheapest option"),
+	)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrFailedToCreateMetrics, err)
+	}
+
+	prices, err := m.Int64ObservableGauge(
+		"analytics.price",
+		metric.WithDescription("Percentiles of the cost of options, in the minor unit of the currency, by weight band"),
+	)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrFailedToCreateMetrics, err)
+	}
+
+	_, err = m.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		r := report()
+		if r == nil {
+			return nil
+		}
+
+		o.ObserveInt64(requests, r.Requests)
+		o.ObserveFloat64(empty, r.EmptyRate)
+
+		for _, c := range r.Carriers {
+			o.ObserveFloat64(wins, c.WinRate, metric.WithAttributes(attribute.String("provider", c.Provider)))
+		}
+
+		for _, p := range r.Prices {
+			for q, v := range map[string]int64{"50": p.P50, "90": p.P90, "99": p.P99} {
+				o.ObserveInt64(prices, v, metric.WithAttributes(
+					attribute.String("band", p.Band),
+					attribute.String("currency", p.Currency),
+					attribute.String("percentile", q),
+				))
+			}
+		}
+
+		return nil
+	}, requests, empty, wins, prices)
+
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrFailedToCreateMetrics, err)
+	}
+
+	return nil
+}
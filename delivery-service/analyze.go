@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/analytics"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/money"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/quotelog"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/telemetry"
+	"go.opentelemetry.io/otel"
+)
+
+// analyze summarises the quote log, serving the report as JSON on "/analytics" and as metrics on "/metrics" until
+// interrupted. For example,
+//
+//	./delivery-service -quote-log quotes.log -exchange-rates exchange-rates.json analytics
+//	curl localhost:9095/analytics
+//
+// The log is read again every interval, such that the report follows the server as it writes. It returns the exit
+// code for the process.
+func analyze(args []string) int {
+	if len(args) != 0 {
+		log.Error("analytics takes no arguments")
+		return 2
+	}
+
+	if *quoteLog == "" {
+		log.Error("analytics requires the quote log to be supplied with -quote-log")
+		return 2
+	}
+
+	// Exchange rates are optional. Without them, options in different currencies cannot be compared.
+	var rates *money.Rates
+	if *exchangeRates != "" {
+		var err error
+		if rates, err = money.LoadRates(*exchangeRates); err != nil {
+			log.Error("failed to load exchange rates", "error", err, "path", *exchangeRates)
+			return 1
+		}
+	}
+
+	var (
+		mu     sync.RWMutex
+		report *analytics.Report
+	)
+
+	refresh := func() error {
+		r, err := analytics.Aggregate(*quoteLog, quotelog.DefaultMaxBackups, rates)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		report = r
+		mu.Unlock()
+
+		return nil
+	}
+
+	current := func() *analytics.Report {
+		mu.RLock()
+		defer mu.RUnlock()
+
+		return report
+	}
+
+	if err := refresh(); err != nil {
+		log.Error("failed to read quote log", "error", err, "path", *quoteLog)
+		return 1
+	}
+
+	// The metrics are served alongside the report, rather than on the address used by the server, such that both can
+	// run at the same time.
+	prom := telemetry.NewPrometheusHTTP("")
+	if err := telemetry.SetupOTelMetrics(prom.Reader); err != nil {
+		log.Error("failed to bootstrap metrics", "error", err)
+		return 1
+	}
+
+	if err := analytics.Observe(otel.Meter("github.com/andrewhowdencom/courses.pito/delivery-service/analytics"), current); err != nil {
+		log.Error("failed to create metrics", "error", err)
+		return 1
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", prom.Handler())
+	mux.HandleFunc("/analytics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+
+		// Hint: This can fail, but it is ignored.
+		json.NewEncoder(w).Encode(current())
+	})
+
+	srv := &http.Server{Addr: *analyticsAddr, Handler: mux}
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error("failed to start analytics server", "error", err, "addr", *analyticsAddr)
+			os.Exit(1)
+		}
+	}()
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGINT)
+
+	tick := time.NewTicker(30 * time.Second)
+	defer tick.Stop()
+
+	log.Info("serving analytics", "addr", *analyticsAddr)
+
+	for {
+		select {
+		case <-ch:
+			srv.Shutdown(context.Background())
+			telemetry.ShutdownOTelMetrics(context.Background())
+
+			return 0
+		case <-tick.C:
+			// If the log cannot be read, the previous report is served until it can.
+			if err := refresh(); err != nil {
+				log.Error("failed to read quote log", "error", err, "path", *quoteLog)
+			}
+		}
+	}
+}
@@ -1,9 +1,11 @@
 package carriers
 
 import (
+	"context"
 	"time"
 
 	"github.com/andrewhowdencom/courses.pito/delivery-service/money"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/pickup"
 )
 
 // Carrier is the interface that all carriers must meet. It ensure that we can provide a standard set of
@@ -14,13 +16,46 @@ type Carrier interface {
 	Query(*Package) ([]*DeliveryOption, error)
 }
 
+// ContextCarrier is implemented by carriers that can abandon a query once the context is done, returning the error
+// of the context. Carriers that do not implement it are always queried to completion.
+type ContextCarrier interface {
+	QueryContext(context.Context, *Package) ([]*DeliveryOption, error)
+}
+
+// QueryContext queries the carrier with the context if it supports it, and otherwise without it (once the context is
+// done, such carriers are not queried at all).
+func QueryContext(ctx context.Context, c Carrier, pkg *Package) ([]*DeliveryOption, error) {
+	if cc, ok := c.(ContextCarrier); ok {
+		return cc.QueryContext(ctx, pkg)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return c.Query(pkg)
+}
+
 // Package is a request for a delivery options.
 type Package struct {
 	// The distance between two points, measured in milimeters
-	Width, Height, Depth int64
+	Width  int64 `json:"width"`
+	Height int64 `json:"height"`
+	Depth  int64 `json:"depth"`
 
 	// The weight of an object, measured in grams.
-	Weight int64
+	Weight int64 `json:"weight"`
+
+	// The postal codes the package is sent from and to. Optional.
+	Origin      string `json:"origin,omitempty"`
+	Destination string `json:"destination,omitempty"`
+
+	// The estimated distance between the origin and destination, measured in meters. Zero if unknown.
+	Distance int64 `json:"distance,omitempty"`
+
+	// The pickup points near the destination, closest first. Carriers may offer to deliver to these instead of the
+	// door. They are looked up for each query, so are not kept with the package.
+	PickupPoints []*pickup.Point `json:"-"`
 }
 
 // DeliveryOption is an option that can be booked for a delivery.
@@ -31,6 +66,80 @@ type DeliveryOption struct {
 	// The cost of the delivery option, should it be booked
 	Cost *money.Money `json:"cost"`
 
+	// The cost converted into the currency requested by the client, if one was requested and a rate was available.
+	Converted *money.Conversion `json:"converted,omitempty"`
+
 	// The estimated arrival (within 6 hours) that the package will be delivered.
 	Arrival time.Time `json:"arrival"`
+
+	// The mode of transport the package will (mostly) travel by.
+	Mode TransportMode `json:"mode,omitempty"`
+
+	// The estimated emissions of delivering the package, if the distance and mode of transport are known.
+	Emissions *Emissions `json:"emissions,omitempty"`
+
+	// The pickup point the package is delivered to. If empty, the package is delivered to the door.
+	PickupPoint *pickup.Point `json:"pickup_point,omitempty"`
+
+	// The identifier of the quote for this option, used to book it.
+	QuoteID string `json:"quote_id,omitempty"`
+
+	// The time after which the option can no longer be booked.
+	Expires time.Time `json:"expires,omitempty"`
+
+	// A signed token, proving what was quoted. See quotes.Keys.
+	Token string `json:"token,omitempty"`
+}
+
+// Copy returns a copy of the option that can be changed without changing the original; its cost, conversion and
+// emissions are copied as well. The pickup point is not, as it is the point itself (rather than a description of it).
+func (o *DeliveryOption) Copy() *DeliveryOption {
+	c := *o
+
+	if o.Cost != nil {
+		cost := *o.Cost
+		c.Cost = &cost
+	}
+
+	if o.Converted != nil {
+		conv := *o.Converted
+		if conv.Amount != nil {
+			amount := *conv.Amount
+			conv.Amount = &amount
+		}
+
+		c.Converted = &conv
+	}
+
+	if o.Emissions != nil {
+		e := *o.Emissions
+		c.Emissions = &e
+	}
+
+	return &c
+}
+
+// Namer is implemented by carriers that know the name of the provider they return options for. It allows finding the
+// carrier for an option without first querying it (for example, after a restart).
+type Namer interface {
+	ProviderName() string
+}
+
+// Booker is implemented by carriers that can book the delivery options they provide.
+type Booker interface {
+	// Book commits the carrier to delivering the package as described by the option, or returns an error if that is
+	// no longer possible.
+	Book(*Package, *DeliveryOption) (*Booking, error)
+}
+
+// Booking is the confirmation from a carrier that it will deliver a package.
+type Booking struct {
+	// Reference is the carriers identifier for the booking, such as a tracking number.
+	Reference string `json:"reference"`
+
+	// The provider that will fulfil the booking.
+	Provider string `json:"provider"`
+
+	// The time at which the booking was made.
+	Booked time.Time `json:"booked"`
 }
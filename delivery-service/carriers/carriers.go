@@ -4,7 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
+	"time"
 
+	"github.com/andrewhowdencom/courses.pito/delivery-service/clock"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/pickup"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/metric/noop"
@@ -14,12 +18,19 @@ var (
 	ErrNoOffersFound         = errors.New("no offers found")
 	ErrFailedToApplyOption   = errors.New("failed to apply option")
 	ErrFailedToCreateMetrics = errors.New("failed to create metric from provider")
+	ErrUnknownProvider       = errors.New("unknown provider")
+	ErrBookingNotSupported   = errors.New("provider does not support booking")
+
+	// ErrExcluded is returned (wrapped, with the reason) by carriers, or their middleware, that were deliberately not
+	// queried for a package; for example, because the client is not part of an experiment. It is not a failure.
+	ErrExcluded = errors.New("carrier excluded")
 )
 
 type Option func(car *Carriers) error
 
 var Defaults = []Option{
 	WithMeter(otel.Meter("github.com/andrewhowdencom/courses.pito/delivery-service/carriers")),
+	WithMiddleware(Tracing(otel.Tracer("github.com/andrewhowdencom/courses.pito/delivery-service/carriers"))),
 }
 
 // Carriers is a wrapper around all individual carriers to aggregate the results from those carriers
@@ -30,14 +41,39 @@ type Carriers struct {
 	// opts are things that modifiy the structs bootstrap, but are later unused.
 	opts struct {
 		m metric.Meter
+
+		// middleware wrap every carrier, outermost first.
+		middleware []Middleware
 	}
 
 	// Metrics are used
 	metrics struct {
 		queries metric.Int64Counter
+
+		// shadow* compare each shadow carrier with each live carrier. See WithShadow.
+		shadowComparisons metric.Int64Counter
+		shadowLatency     metric.Float64Histogram
+		shadowPrice       metric.Float64Histogram
 	}
 
 	carriers []Carrier
+
+	// shadows are queried alongside the carriers, but what they return is only compared with them. See WithShadow.
+	shadows []Carrier
+
+	// chains are the middleware each carrier is wrapped in, in the order the carriers were registered.
+	chains []Chain
+
+	// providers maps the name of each provider to the carrier that returns options on its behalf, so that those
+	// options can later be booked. It is populated from carriers that implement Namer, and as options are returned.
+	mu        sync.RWMutex
+	providers map[string]Carrier
+
+	// points are the pickup points that carriers may deliver to, instead of the door. Optional.
+	points *pickup.Directory
+
+	// clock is what the time each carrier takes to respond is measured with.
+	clock clock.Clock
 }
 
 // New generates a new set of carriers. There are a series of default options that should be extended
@@ -46,7 +82,8 @@ type Carriers struct {
 //	New(append(Defaults, WithCarrier(...))
 func New(opts ...Option) (*Carriers, error) {
 	c := &Carriers{
-		carriers: make([]Carrier, 0),
+		carriers:  make([]Carrier, 0),
+		providers: make(map[string]Carrier),
 	}
 
 	for _, o := range opts {
@@ -55,6 +92,30 @@ func New(opts ...Option) (*Carriers, error) {
 		}
 	}
 
+	c.clock = clock.Or(c.clock)
+
+	// Wrap every carrier in the middleware, regardless of whether it was registered before or after them.
+	for i, ic := range c.carriers {
+		var chain Chain
+		c.carriers[i], chain = c.wrap(ic)
+
+		if _, ok := ic.(Namer); ok {
+			c.providers[chain.Provider] = c.carriers[i]
+		}
+
+		c.chains = append(c.chains, chain)
+	}
+
+	// Shadows are wrapped in the same middleware, such that they are compared on equal terms. They are not providers,
+	// as their options cannot be booked.
+	for i, sc := range c.shadows {
+		var chain Chain
+		c.shadows[i], chain = c.wrap(sc)
+
+		chain.Shadow = true
+		c.chains = append(c.chains, chain)
+	}
+
 	// If there is no meter, add one so we're safe.
 	if c.opts.m == nil {
 		c.opts.m = noop.NewMeterProvider().Meter("noop")
@@ -66,9 +127,48 @@ func New(opts ...Option) (*Carriers, error) {
 		return nil, fmt.Errorf("%w: %s", ErrFailedToCreateMetrics, err)
 	}
 
+	if c.metrics.shadowComparisons, err = c.opts.m.Int64Counter(
+		"carrier.shadow.comparisons",
+		metric.WithDescription("Queries of a shadow carrier compared with a live carrier, by whether either failed"),
+	); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFailedToCreateMetrics, err)
+	}
+
+	if c.metrics.shadowLatency, err = c.opts.m.Float64Histogram(
+		"carrier.shadow.latency.delta",
+		metric.WithDescription("How much longer a shadow carrier took to respond than a live carrier"),
+		metric.WithUnit("s"),
+	); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFailedToCreateMetrics, err)
+	}
+
+	if c.metrics.shadowPrice, err = c.opts.m.Float64Histogram(
+		"carrier.shadow.price.delta",
+		metric.WithDescription("How much more the cheapest option of a shadow carrier cost than that of a live carrier"),
+		metric.WithUnit("%"),
+	); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFailedToCreateMetrics, err)
+	}
+
 	return c, nil
 }
 
+// wrap wraps the carrier in every middleware, returning it along with its chain.
+func (c *Carriers) wrap(ic Carrier) (Carrier, Chain) {
+	chain := Chain{Provider: name(ic), Carrier: fmt.Sprintf("%T", ic), Middleware: []string{}}
+
+	wrapped := ic
+	for j := len(c.opts.middleware) - 1; j >= 0; j-- {
+		wrapped = c.opts.middleware[j].Wrap(wrapped)
+	}
+
+	for _, mw := range c.opts.middleware {
+		chain.Middleware = append(chain.Middleware, mw.Name)
+	}
+
+	return wrapped, chain
+}
+
 // WithCarrier adds a carrier to the carriers primitive
 func WithCarrier(nc Carrier) Option {
 	return func(c *Carriers) error {
@@ -78,6 +178,41 @@ func WithCarrier(nc Carrier) Option {
 	}
 }
 
+// WithMiddleware wraps every carrier in the middleware. The first middleware is the outermost, seeing each query
+// first; middleware added by later options are inside those added by earlier ones.
+func WithMiddleware(mw ...Middleware) Option {
+	return func(c *Carriers) error {
+		for _, m := range mw {
+			if m.Wrap == nil {
+				return fmt.Errorf("middleware %q has nothing to wrap carriers with", m.Name)
+			}
+		}
+
+		c.opts.middleware = append(c.opts.middleware, mw...)
+
+		return nil
+	}
+}
+
+// WithPickupPoints allows carriers to offer delivery to the pickup points near the destination of the package.
+func WithPickupPoints(d *pickup.Directory) Option {
+	return func(c *Carriers) error {
+		c.points = d
+
+		return nil
+	}
+}
+
+// WithClock sets the clock that the time each carrier takes to respond is measured with. The clock of each carrier
+// (if it has one) is set separately.
+func WithClock(cl clock.Clock) Option {
+	return func(c *Carriers) error {
+		c.clock = cl
+
+		return nil
+	}
+}
+
 // WithMeter applies a specific meter provider to the carriers. Used mostly in testing.
 func WithMeter(mp metric.Meter) Option {
 	return func(car *Carriers) error {
@@ -87,25 +222,159 @@ func WithMeter(mp metric.Meter) Option {
 	}
 }
 
+// Len is the number of carriers that are queried for each package, not including shadows.
+func (c *Carriers) Len() int {
+	return len(c.carriers)
+}
+
+// Chains returns the middleware each carrier is wrapped in, in the order the carriers were registered; followed by the
+// shadows.
+func (c *Carriers) Chains() []Chain {
+	return c.chains
+}
+
+// Outcome is what a single carrier returned when queried for a package.
+type Outcome struct {
+	// Provider identifies the carrier. Carriers that do not implement Namer are identified by their type.
+	Provider string `json:"provider"`
+
+	// Options is the number of options the carrier returned.
+	Options int `json:"options"`
+
+	// Error is why the carrier failed, if it did.
+	Error string `json:"error,omitempty"`
+
+	// Excluded is why the carrier was not queried, if it was not. See ErrExcluded.
+	Excluded string `json:"excluded,omitempty"`
+
+	// Latency is how long the carrier took to respond.
+	Latency time.Duration `json:"latency"`
+}
+
 // Query takes a single package and returns the aggregated results from all delivery providers.
 func (c *Carriers) Query(in *Package) ([]*DeliveryOption, error) {
+	return c.QueryContext(context.Background(), in)
+}
+
+// QueryContext is the same as Query, but abandons querying the carriers once the context is done.
+func (c *Carriers) QueryContext(ctx context.Context, in *Package) ([]*DeliveryOption, error) {
+	results, _, err := c.QueryOutcomes(ctx, in)
+
+	return results, err
+}
 
-	c.metrics.queries.Add(context.Background(), 1)
+// QueryOutcomes is the same as QueryContext, but additionally returns what each carrier returned (in the order they
+// were registered), such that the carriers can be compared. Shadows are not included; they are queried asynchronously,
+// and compared with the carriers once both have returned.
+func (c *Carriers) QueryOutcomes(ctx context.Context, in *Package) ([]*DeliveryOption, []Outcome, error) {
+	c.metrics.queries.Add(ctx, 1, metric.WithAttributes(AttributesFromContext(ctx)...))
 
 	results := []*DeliveryOption{}
+	outcomes := make([]Outcome, 0, len(c.carriers))
+
+	// Find the pickup points that are near enough to the destination for the recipient to collect the package. They
+	// are added to a copy of the package, such that the package of the caller is not changed.
+	//
+	// Hint: If the destination cannot be located, carriers only offer delivery to the door.
+	if c.points != nil && in.Destination != "" {
+		pkg := *in
+		pkg.PickupPoints, _ = c.points.Near(in.Destination, pickup.DefaultRadius)
+		in = &pkg
+	}
+
+	// Shadows are queried at the same time as the carriers, with their own copy of the package. They never delay the
+	// response; the comparison waits for the carriers instead.
+	done := make(chan struct{})
+	live := make([]sample, 0, len(c.carriers))
+
+	for _, sc := range c.shadows {
+		pkg := *in
+		go c.shadow(ctx, sc, &pkg, done, &live)
+	}
 
 	for _, ic := range c.carriers {
 		// Here, we do not want to _fail_ the request if a single provider fails. Instead, we just want to return
 		// whatever providers are available. Otherwise, we'd be only as available as a the worst downstream provider!
 		// However, that creates a dilemma: How do we know when we need to intervene with a provider?
-		opts, _ := ic.Query(in)
+		start := c.clock.Now()
+		opts, err := QueryContext(ctx, ic, in)
+
+		o := Outcome{Provider: name(ic), Options: len(opts), Latency: c.clock.Now().Sub(start)}
+		switch {
+		case errors.Is(err, ErrExcluded):
+			o.Excluded = err.Error()
+		case err != nil:
+			o.Error = err.Error()
+		}
+
+		outcomes = append(outcomes, o)
+
+		if o.Excluded == "" {
+			live = append(live, newSample(o.Provider, opts, err, o.Latency))
+		}
+
+		// Estimate the emissions of each option with the model of the carrier that provided it.
+		model := DefaultEmissionsModel
+		if e, ok := ic.(Emitter); ok {
+			model = e.Emissions()
+		}
+
+		c.mu.Lock()
+		for _, o := range opts {
+			o.Emissions, _ = model.Estimate(o.Mode, in)
+			c.providers[o.Provider] = ic
+		}
+		c.mu.Unlock()
 
 		results = append(results, opts...)
 	}
 
+	close(done)
+
 	if len(results) == 0 {
-		return nil, ErrNoOffersFound
+		return nil, outcomes, ErrNoOffersFound
+	}
+
+	return results, outcomes, nil
+}
+
+// name identifies the carrier; by the name of its provider if it has one, and otherwise by its type.
+func name(ic Carrier) string {
+	if n, ok := ic.(Namer); ok {
+		return n.ProviderName()
+	}
+
+	return fmt.Sprintf("%T", ic)
+}
+
+// Book books the option with the carrier that provided it.
+func (c *Carriers) Book(pkg *Package, opt *DeliveryOption) (*Booking, error) {
+	c.mu.RLock()
+	ic, ok := c.providers[opt.Provider]
+	c.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, opt.Provider)
+	}
+
+	b, ok := ic.(Booker)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrBookingNotSupported, opt.Provider)
+	}
+
+	// Options delivered to a pickup point take up one of its places, which is given back if the booking fails.
+	if opt.PickupPoint == nil || c.points == nil {
+		return b.Book(pkg, opt)
+	}
+
+	if err := c.points.Hold(opt.PickupPoint.ID); err != nil {
+		return nil, err
+	}
+
+	booking, err := b.Book(pkg, opt)
+	if err != nil {
+		c.points.Release(opt.PickupPoint.ID)
 	}
 
-	return results, nil
+	return booking, err
 }
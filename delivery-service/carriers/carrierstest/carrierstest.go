@@ -0,0 +1,219 @@
+// package carrierstest checks that implementations of carriers.Carrier behave as the rest of the application expects.
+// Each implementation can run the whole suite from its own tests with a single call:
+//
+//	func TestConformance(t *testing.T) {
+//		carrierstest.Run(t, &MyCarrier{}, nil)
+//	}
+//
+// Run the tests with -race, such that the concurrency checks can find data races.
+package carrierstest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/carriers"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/clock"
+)
+
+// Packages are the packages the carrier is queried for; from a letter to something that needs two people to lift.
+var Packages = []*carriers.Package{
+	{Width: 240, Height: 5, Depth: 160, Weight: 50},
+	{Width: 200, Height: 35, Depth: 150, Weight: 2_500},
+	{Width: 600, Height: 400, Depth: 400, Weight: 18_000, Origin: "10115", Destination: "80331", Distance: 504_000},
+}
+
+// Queries is how many times the carrier is queried for each package, such that carriers that occasionally fail (or
+// vary their options) are checked more than once.
+var Queries = 5
+
+// Concurrency is how many goroutines query the carrier at the same time.
+var Concurrency = 8
+
+// Timeout is how long a carrier has to return once its context is done.
+const Timeout = time.Second
+
+// Slack is how long after the deadline of its context a carrier may still return what it queried, rather than the
+// error of the context; for example, because it finished just as the deadline passed.
+const Slack = 10 * time.Millisecond
+
+// Run runs the whole suite against the carrier, each check as a subtest. The carrier is queried as it is, so it should
+// be configured such that it does not take too long to respond.
+//
+// The clock is the one the carrier tells the time with, such that its arrivals are checked against the time it was
+// queried at; if nil, the real clock is used. It must run by itself (as clock.From does), rather than being advanced.
+func Run(t *testing.T, c carriers.Carrier, clk clock.Clock) {
+	t.Helper()
+
+	clk = clock.Or(clk)
+
+	t.Run("Options", func(t *testing.T) { testOptions(t, c, clk) })
+	t.Run("ContextCancelled", func(t *testing.T) { testContextCancelled(t, c, clk) })
+	t.Run("ContextDeadline", func(t *testing.T) { testContextDeadline(t, c, clk) })
+	t.Run("Concurrency", func(t *testing.T) { testConcurrency(t, c, clk) })
+}
+
+// testOptions checks that every query returns either options or an error (never nil for both), and that each option is
+// valid (see Check). Carriers may fail, but not every query of a package.
+func testOptions(t testing.TB, c carriers.Carrier, clk clock.Clock) {
+	for _, pkg := range Packages {
+		succeeded := 0
+		for i := 0; i < Queries; i++ {
+			ok, err := query(context.Background(), c, clk, pkg)
+			if err != nil {
+				t.Errorf("%s: %s", describe(pkg), err)
+			}
+
+			if ok {
+				succeeded++
+			}
+		}
+
+		if succeeded == 0 {
+			t.Errorf("%s: every one of %d queries failed", describe(pkg), Queries)
+		}
+	}
+}
+
+// testContextCancelled checks that the carrier does not query at all once the context is cancelled, returning the
+// error of the context.
+func testContextCancelled(t testing.TB, c carriers.Carrier, clk clock.Clock) {
+	cc := contextCarrier(t, c)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := clk.Now()
+	opts, err := cc.QueryContext(ctx, Packages[0])
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %q with a cancelled context, but got %v (and %d options)", context.Canceled, err, len(opts))
+	}
+
+	if took := clk.Now().Sub(start); took > Timeout {
+		t.Errorf("expected to return within %s with a cancelled context, but took %s", Timeout, took)
+	}
+}
+
+// testContextDeadline checks that the carrier stops querying once the deadline of the context passes, returning the
+// error of the context. Carriers that respond (or fail) before the deadline pass.
+func testContextDeadline(t testing.TB, c carriers.Carrier, clk clock.Clock) {
+	cc := contextCarrier(t, c)
+
+	ctx, cancel := clock.WithTimeout(context.Background(), clk, time.Millisecond)
+	defer cancel()
+
+	start := clk.Now()
+	opts, err := cc.QueryContext(ctx, Packages[0])
+	took := clk.Now().Sub(start)
+
+	if took > time.Millisecond+Timeout {
+		t.Errorf("expected to return within %s of the deadline, but took %s (returning %v and %d options)", Timeout, took, err, len(opts))
+	}
+
+	if took > time.Millisecond+Slack && !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected %q once the deadline passed, but got %v (and %d options) after %s", context.DeadlineExceeded, err, len(opts), took)
+	}
+}
+
+// testConcurrency checks that the carrier can be queried from several goroutines at the same time, as it is for
+// concurrent requests. Data races are only found with -race.
+func testConcurrency(t testing.TB, c carriers.Carrier, clk clock.Clock) {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+
+	for g := 0; g < Concurrency; g++ {
+		wg.Add(1)
+
+		go func(g int) {
+			defer wg.Done()
+
+			pkg := Packages[g%len(Packages)]
+			if _, err := query(context.Background(), c, clk, pkg); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("%s: %w", describe(pkg), err))
+				mu.Unlock()
+			}
+		}(g)
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		t.Error(err)
+	}
+}
+
+// Check returns why the options returned for a query made at the time are invalid, or nil if they are valid. An option
+// is valid if it has a provider, a cost in a known ISO 4217 currency that is not negative, and an arrival after the
+// query.
+func Check(opts []*carriers.DeliveryOption, at time.Time) error {
+	errs := []error{}
+
+	for i, o := range opts {
+		if o == nil {
+			errs = append(errs, fmt.Errorf("option %d is nil", i))
+			continue
+		}
+
+		if o.Provider == "" {
+			errs = append(errs, fmt.Errorf("option %d has no provider", i))
+		}
+
+		switch {
+		case o.Cost == nil:
+			errs = append(errs, fmt.Errorf("option %d has no cost", i))
+		case o.Cost.Validate() != nil:
+			errs = append(errs, fmt.Errorf("option %d: %w", i, o.Cost.Validate()))
+		case o.Cost.Total < 0:
+			errs = append(errs, fmt.Errorf("option %d has a negative cost (%d)", i, o.Cost.Total))
+		}
+
+		if !o.Arrival.After(at) {
+			errs = append(errs, fmt.Errorf("option %d does not arrive in the future (%s)", i, o.Arrival.Format(time.RFC3339)))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// query queries the carrier for the package, and returns whether the carrier returned options (rather than failing),
+// and why what it returned is invalid. Errors from the carrier itself are not invalid; carriers may fail.
+func query(ctx context.Context, c carriers.Carrier, clk clock.Clock, pkg *carriers.Package) (bool, error) {
+	at := clk.Now()
+
+	opts, err := carriers.QueryContext(ctx, c, pkg)
+	if err != nil {
+		return false, nil
+	}
+
+	if opts == nil {
+		return false, errors.New("returned nil options, but no error either")
+	}
+
+	return true, Check(opts, at)
+}
+
+// contextCarrier returns the carrier as a carriers.ContextCarrier, failing the test if it cannot be cancelled.
+func contextCarrier(t testing.TB, c carriers.Carrier) carriers.ContextCarrier {
+	t.Helper()
+
+	cc, ok := c.(carriers.ContextCarrier)
+	if !ok {
+		t.Fatalf("%T does not implement carriers.ContextCarrier, so cannot be cancelled", c)
+	}
+
+	return cc
+}
+
+// describe identifies the package in a failure.
+func describe(pkg *carriers.Package) string {
+	return fmt.Sprintf("%dx%dx%dmm, %dg", pkg.Width, pkg.Height, pkg.Depth, pkg.Weight)
+}
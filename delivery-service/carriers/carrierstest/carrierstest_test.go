@@ -0,0 +1,176 @@
+package carrierstest
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/carriers"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/clock"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/money"
+)
+
+// fake is a carrier that quotes a single option after its latency, and can be broken in each of the ways the suite
+// checks for.
+type fake struct {
+	clk     clock.Clock
+	latency time.Duration
+
+	// option changes the option that is quoted, such that it is invalid.
+	option func(o *carriers.DeliveryOption)
+
+	// nothing returns nil options (and no error), and ignore queries whether the context is done or not.
+	nothing, ignore bool
+}
+
+func (f *fake) Query(pkg *carriers.Package) ([]*carriers.DeliveryOption, error) {
+	return f.QueryContext(context.Background(), pkg)
+}
+
+func (f *fake) QueryContext(ctx context.Context, pkg *carriers.Package) ([]*carriers.DeliveryOption, error) {
+	if f.ignore {
+		f.clk.Sleep(f.latency)
+	} else if err := clock.SleepContext(ctx, f.clk, f.latency); err != nil {
+		return nil, err
+	}
+
+	if f.nothing {
+		return nil, nil
+	}
+
+	o := &carriers.DeliveryOption{
+		Provider: "fake",
+		Cost:     &money.Money{Total: 590, Currency: "EUR"},
+		Arrival:  f.clk.Now().Add(48 * time.Hour),
+	}
+
+	if f.option != nil {
+		f.option(o)
+	}
+
+	return []*carriers.DeliveryOption{o}, nil
+}
+
+// queryOnly is a carrier that can only be queried without a context.
+type queryOnly struct {
+	c *fake
+}
+
+func (q queryOnly) Query(pkg *carriers.Package) ([]*carriers.DeliveryOption, error) {
+	return q.c.Query(pkg)
+}
+
+// failures records what a check reports, rather than failing the test that runs it.
+type failures struct {
+	testing.TB
+
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (f *failures) Error(args ...any) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.msgs = append(f.msgs, fmt.Sprint(args...))
+}
+
+func (f *failures) Errorf(format string, args ...any) {
+	f.Error(fmt.Sprintf(format, args...))
+}
+
+func (f *failures) Fatalf(format string, args ...any) {
+	f.Errorf(format, args...)
+	runtime.Goexit()
+}
+
+// check runs the check against the carrier, and returns what it reported. The check is run in its own goroutine, such
+// that Fatalf can stop it as it would stop a test.
+func check(t *testing.T, fn func(testing.TB, carriers.Carrier, clock.Clock), c carriers.Carrier, clk clock.Clock) []string {
+	f := &failures{TB: t}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn(f, c, clk)
+	}()
+	<-done
+
+	return f.msgs
+}
+
+func TestChecks(t *testing.T) {
+	// The clock does not tell the time on the wall, such that checking against it (rather than the clock of the carrier)
+	// would be noticed.
+	clk := clock.From(time.Date(2023, 9, 9, 12, 0, 0, 0, time.UTC))
+
+	checks := map[string]func(testing.TB, carriers.Carrier, clock.Clock){
+		"Options":          testOptions,
+		"ContextCancelled": testContextCancelled,
+		"ContextDeadline":  testContextDeadline,
+		"Concurrency":      testConcurrency,
+	}
+
+	for _, tc := range []struct {
+		name    string
+		carrier carriers.Carrier
+
+		// fail are the checks that are expected to fail; every other check is expected to pass.
+		fail []string
+	}{
+		{
+			name:    "valid",
+			carrier: &fake{clk: clk, latency: 20 * time.Millisecond},
+		},
+		{
+			name:    "nil options",
+			carrier: &fake{clk: clk, nothing: true},
+			fail:    []string{"Options", "Concurrency"},
+		},
+		{
+			name: "negative cost",
+			carrier: &fake{clk: clk, option: func(o *carriers.DeliveryOption) {
+				o.Cost.Total = -1
+			}},
+			fail: []string{"Options", "Concurrency"},
+		},
+		{
+			name: "unknown currency",
+			carrier: &fake{clk: clk, option: func(o *carriers.DeliveryOption) {
+				o.Cost.Currency = "XXY"
+			}},
+			fail: []string{"Options", "Concurrency"},
+		},
+		{
+			name: "arrival in the past",
+			carrier: &fake{clk: clk, option: func(o *carriers.DeliveryOption) {
+				o.Arrival = clk.Now().Add(-time.Hour)
+			}},
+			fail: []string{"Options", "Concurrency"},
+		},
+		{
+			name:    "ignores the context",
+			carrier: &fake{clk: clk, latency: 20 * time.Millisecond, ignore: true},
+			fail:    []string{"ContextCancelled", "ContextDeadline"},
+		},
+		{
+			name:    "cannot be cancelled",
+			carrier: queryOnly{c: &fake{clk: clk}},
+			fail:    []string{"ContextCancelled", "ContextDeadline"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for name, fn := range checks {
+				msgs := check(t, fn, tc.carrier, clk)
+
+				if failed, want := len(msgs) > 0, slices.Contains(tc.fail, name); failed != want {
+					t.Errorf("%s: expected failed to be %v, got %v (%q)", name, want, failed, msgs)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,372 @@
+package carriers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/clock"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var (
+	ErrFailedToOpenCassette = errors.New("failed to open cassette")
+	ErrFailedToRecord       = errors.New("failed to record to cassette")
+	ErrNotRecorded          = errors.New("query not recorded")
+	ErrReplayedFailure      = errors.New("replayed carrier failure")
+)
+
+// Recording is a single query of a carrier, as it happened.
+type Recording struct {
+	Provider string    `json:"provider"`
+	At       time.Time `json:"at"`
+	Package  *Package  `json:"package"`
+
+	// Options are what the carrier returned, before they were modified (for example, by estimating emissions).
+	Options []*DeliveryOption `json:"options"`
+
+	// Error is why the carrier failed, if it did; and Kind the kind of error it was, if it was one that callers
+	// distinguish (see errorKinds), such that it is the same kind when replayed.
+	Error string `json:"error,omitempty"`
+	Kind  string `json:"kind,omitempty"`
+
+	// Latency is how long the carrier took to respond.
+	Latency time.Duration `json:"latency"`
+
+	// Shadow is whether the carrier was a shadow (see WithShadow), rather than a live carrier.
+	Shadow bool `json:"shadow,omitempty"`
+}
+
+// errorKinds are the errors that are recorded as a kind, keyed by the kind.
+var errorKinds = map[string]error{
+	"deadline": context.DeadlineExceeded,
+	"canceled": context.Canceled,
+	"excluded": ErrExcluded,
+}
+
+// errorKind returns the kind the error is recorded as, or "" if it is not one of errorKinds.
+func errorKind(err error) string {
+	for kind, target := range errorKinds {
+		if errors.Is(err, target) {
+			return kind
+		}
+	}
+
+	return ""
+}
+
+// Cassette is a file of recordings, as newline delimited JSON. It is written by Recorder, and read by Replayer.
+type Cassette struct {
+	// log and failures report recordings that could not be written. Only used when recording.
+	log      *slog.Logger
+	failures metric.Int64Counter
+
+	mu sync.Mutex
+
+	// f is the file recordings are appended to. Nil unless recording.
+	f *os.File
+
+	// recordings are the recordings that can be replayed, keyed by provider and package, oldest first.
+	recordings map[string][]json.RawMessage
+
+	// played is how many of the recordings for each key have been replayed.
+	played map[string]int
+
+	// providers are the providers that were recorded, in the order they were first recorded; and live those that were
+	// recorded as live carriers, rather than only as shadows.
+	providers []string
+	live      map[string]bool
+}
+
+// CreateCassette opens (or creates) a cassette to record to. Recordings are appended to any that are already there.
+// Recordings that cannot be written are logged to the logger, and counted in carrier.cassette.failures.
+func CreateCassette(path string, log *slog.Logger) (*Cassette, error) {
+	failures, err := otel.Meter("github.com/andrewhowdencom/courses.pito/delivery-service/carriers").Int64Counter(
+		"carrier.cassette.failures",
+		metric.WithDescription("Queries that could not be recorded to the cassette, by provider"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFailedToOpenCassette, err)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFailedToOpenCassette, err)
+	}
+
+	return &Cassette{f: f, log: log, failures: failures}, nil
+}
+
+// LoadCassette reads a cassette to replay.
+func LoadCassette(path string) (*Cassette, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFailedToOpenCassette, err)
+	}
+	defer f.Close()
+
+	c := &Cassette{
+		recordings: make(map[string][]json.RawMessage),
+		played:     make(map[string]int),
+		live:       make(map[string]bool),
+	}
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for sc.Scan() {
+		r := &Recording{}
+		if err := json.Unmarshal(sc.Bytes(), r); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrFailedToOpenCassette, err)
+		}
+
+		k, err := key(r.Provider, r.Package)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrFailedToOpenCassette, err)
+		}
+
+		if !slices.Contains(c.providers, r.Provider) {
+			c.providers = append(c.providers, r.Provider)
+		}
+
+		if !r.Shadow {
+			c.live[r.Provider] = true
+		}
+
+		// Each recording is kept as it was written, and decoded again each time it is replayed, such that the options
+		// returned can be modified without changing the recording.
+		c.recordings[k] = append(c.recordings[k], append(json.RawMessage{}, sc.Bytes()...))
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFailedToOpenCassette, err)
+	}
+
+	return c, nil
+}
+
+// Providers returns the live providers that have recordings in the cassette, in the order they were first recorded
+// (which, for a cassette written by Recorder, is the order they were registered in).
+func (c *Cassette) Providers() []string {
+	return c.filter(true)
+}
+
+// Shadows returns the providers that were only recorded as shadows, as in Providers. They should be replayed as shadows
+// too; see WithShadow.
+func (c *Cassette) Shadows() []string {
+	return c.filter(false)
+}
+
+// filter returns the providers that were (or were not) recorded as live carriers.
+func (c *Cassette) filter(live bool) []string {
+	out := []string{}
+	for _, p := range c.providers {
+		if c.live[p] == live {
+			out = append(out, p)
+		}
+	}
+
+	return out
+}
+
+// Close closes the file being recorded to, if there is one.
+func (c *Cassette) Close() error {
+	if c.f == nil {
+		return nil
+	}
+
+	return c.f.Close()
+}
+
+// record appends the recording to the cassette.
+func (c *Cassette) record(r *Recording) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrFailedToRecord, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.f == nil {
+		return fmt.Errorf("%w: cassette was not created for recording", ErrFailedToRecord)
+	}
+
+	if _, err := c.f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("%w: %s", ErrFailedToRecord, err)
+	}
+
+	return nil
+}
+
+// next returns the next recording for the provider and package. Recordings are replayed in the order they were
+// recorded; once all have been, the last is repeated.
+func (c *Cassette) next(provider string, pkg *Package) (*Recording, error) {
+	k, err := key(provider, pkg)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	recs := c.recordings[k]
+	i := c.played[k]
+	if i < len(recs)-1 {
+		c.played[k]++
+	}
+	c.mu.Unlock()
+
+	if len(recs) == 0 {
+		return nil, fmt.Errorf("%w: %s for %s", ErrNotRecorded, provider, k)
+	}
+
+	r := &Recording{}
+	if err := json.Unmarshal(recs[i], r); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// key identifies the queries that are the same; those for the same package, with the same provider.
+func key(provider string, pkg *Package) (string, error) {
+	b, err := json.Marshal(pkg)
+	if err != nil {
+		return "", err
+	}
+
+	return provider + " " + string(b), nil
+}
+
+// Recorder is a carrier that records every query of the carrier it wraps to a cassette, such that it can be replayed
+// later. It otherwise behaves exactly like the carrier it wraps.
+type Recorder struct {
+	Carrier  Carrier
+	Cassette *Cassette
+
+	// Clock is what the latency of the carrier is measured with. If nil, the real clock is used.
+	Clock clock.Clock
+}
+
+func (r *Recorder) Query(pkg *Package) ([]*DeliveryOption, error) {
+	return r.QueryContext(context.Background(), pkg)
+}
+
+// QueryContext queries the wrapped carrier with the context (if it supports it), recording the query.
+func (r *Recorder) QueryContext(ctx context.Context, pkg *Package) ([]*DeliveryOption, error) {
+	cl := clock.Or(r.Clock)
+
+	start := cl.Now()
+	opts, err := QueryContext(ctx, r.Carrier, pkg)
+
+	rec := &Recording{
+		Provider: name(r.Carrier),
+		At:       start.UTC(),
+		Package:  pkg,
+		Options:  opts,
+		Latency:  cl.Now().Sub(start),
+		Shadow:   isShadow(ctx),
+	}
+
+	if err != nil {
+		rec.Error = err.Error()
+		rec.Kind = errorKind(err)
+	}
+
+	// Failing to record does not fail the query, but the recording is then incomplete; so it is logged and counted.
+	if rerr := r.Cassette.record(rec); rerr != nil {
+		r.Cassette.log.ErrorContext(ctx, "failed to record query", "provider", rec.Provider, "error", rerr)
+		r.Cassette.failures.Add(ctx, 1, metric.WithAttributes(attribute.String("provider", rec.Provider)))
+	}
+
+	return opts, err
+}
+
+// ProviderName returns the name of the wrapped carrier.
+func (r *Recorder) ProviderName() string {
+	return name(r.Carrier)
+}
+
+// Emissions returns the emissions model of the wrapped carrier, if it has one.
+func (r *Recorder) Emissions() EmissionsModel {
+	if e, ok := r.Carrier.(Emitter); ok {
+		return e.Emissions()
+	}
+
+	return nil
+}
+
+// Book books with the wrapped carrier, if it supports booking. Bookings are not recorded.
+func (r *Recorder) Book(pkg *Package, opt *DeliveryOption) (*Booking, error) {
+	b, ok := r.Carrier.(Booker)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrBookingNotSupported, opt.Provider)
+	}
+
+	return b.Book(pkg, opt)
+}
+
+// Replayer is a carrier that answers queries with what a provider returned when they were recorded, taking as long
+// as the provider did. Queries that were not recorded fail with ErrNotRecorded, and those that failed when they were
+// recorded with ErrReplayedFailure (as well as the kind of error they were recorded as, if any).
+type Replayer struct {
+	// Name is the provider to replay.
+	Name     string
+	Cassette *Cassette
+
+	// Model is the emissions model of the provider, as it is not recorded. If nil, the DefaultEmissionsModel is used.
+	Model EmissionsModel
+
+	// Clock is what the recorded latency is waited for with. If nil, the real clock is used.
+	Clock clock.Clock
+}
+
+func (r *Replayer) Query(pkg *Package) ([]*DeliveryOption, error) {
+	return r.QueryContext(context.Background(), pkg)
+}
+
+// QueryContext is the same as Query, but stops waiting for the recorded latency once the context is done.
+func (r *Replayer) QueryContext(ctx context.Context, pkg *Package) ([]*DeliveryOption, error) {
+	// Queries that are abandoned before they start do not use up a recording.
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	rec, err := r.Cassette.next(r.Name, pkg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := clock.SleepContext(ctx, r.Clock, rec.Latency); err != nil {
+		return nil, err
+	}
+
+	if rec.Error == "" {
+		return rec.Options, nil
+	}
+
+	// Errors of a kind that callers distinguish (such as a deadline) are replayed as that kind, too.
+	if kind, ok := errorKinds[rec.Kind]; ok {
+		return nil, fmt.Errorf("%w (%w): %s", ErrReplayedFailure, kind, rec.Error)
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrReplayedFailure, rec.Error)
+}
+
+// ProviderName returns the name of the provider being replayed.
+func (r *Replayer) ProviderName() string {
+	return r.Name
+}
+
+// Emissions returns the emissions model of the provider being replayed.
+func (r *Replayer) Emissions() EmissionsModel {
+	return r.Model
+}
@@ -0,0 +1,62 @@
+package carriers_test
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/carriers"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/carriers/carrierstest"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/clock"
+)
+
+// simulated returns a seeded simulation of a provider that answers quickly, such that the suite does not take long. It
+// tells the time with the clock, as the seeded carriers of the service do.
+func simulated(clk clock.Clock) *carriers.Simulated {
+	s := carriers.SeededSimulations(42)[0]
+	s.Latency = 20 * time.Millisecond
+	s.Clock = clk
+
+	return s
+}
+
+func TestConformance(t *testing.T) {
+	// The arrivals are in 2023, so are only in the future if they are checked against the clock of the carrier.
+	clk := clock.From(time.Date(2023, 9, 9, 12, 0, 0, 0, time.UTC))
+
+	t.Run("Simulated", func(t *testing.T) {
+		carrierstest.Run(t, simulated(clk), clk)
+	})
+
+	t.Run("Replayer", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "cassette.ndjson")
+
+		cassette, err := carriers.CreateCassette(path, slog.Default())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Record a query of each package that succeeded, such that every query of the package replays it.
+		sim := simulated(clk)
+		sim.FailureRate = 0
+
+		rec := &carriers.Recorder{Carrier: sim, Cassette: cassette}
+		for _, pkg := range carrierstest.Packages {
+			if _, err := rec.QueryContext(context.Background(), pkg); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := cassette.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if cassette, err = carriers.LoadCassette(path); err != nil {
+			t.Fatal(err)
+		}
+
+		carrierstest.Run(t, &carriers.Replayer{Name: sim.Name, Cassette: cassette, Model: sim.Model, Clock: clk}, clk)
+	})
+}
@@ -0,0 +1,66 @@
+package carriers
+
+import "math"
+
+// TransportMode is the way in which a package is (mostly) moved between its origin and destination.
+type TransportMode string
+
+const (
+	ModeAir          TransportMode = "air"
+	ModeRoad         TransportMode = "road"
+	ModeRoadElectric TransportMode = "road-electric"
+	ModeRail         TransportMode = "rail"
+	ModeCargoBike    TransportMode = "cargo-bike"
+)
+
+// EmissionsModel is the greenhouse gas that a carrier emits moving packages, in grams of CO2 equivalent per kilogram
+// of package per kilometer travelled ("gCO2e/kg-km"), for each mode of transport it uses.
+//
+// See:
+// 1. https://www.smartfreightcentre.org/en/our-programs/global-logistics-emissions-council/
+type EmissionsModel map[TransportMode]float64
+
+// DefaultEmissionsModel are typical figures for each mode of transport, for carriers that do not publish their own.
+var DefaultEmissionsModel = EmissionsModel{
+	ModeAir:          0.60,
+	ModeRoad:         0.10,
+	ModeRoadElectric: 0.04,
+	ModeRail:         0.03,
+	ModeCargoBike:    0.00,
+}
+
+// Emitter is implemented by carriers that can describe how much they emit. Carriers that do not implement it are
+// assumed to use the DefaultEmissionsModel.
+type Emitter interface {
+	Emissions() EmissionsModel
+}
+
+// Emissions is the estimated greenhouse gas emitted delivering a package.
+type Emissions struct {
+	// The estimated emissions, in grams of CO2 equivalent.
+	CO2e int64 `json:"co2e"`
+
+	// The distance the estimate is based on, in meters.
+	Distance int64 `json:"distance"`
+}
+
+// Estimate calculates the emissions for delivering the package with the given mode of transport. It indicates
+// whether there was enough information to do so.
+func (m EmissionsModel) Estimate(mode TransportMode, pkg *Package) (*Emissions, bool) {
+	factor, ok := m[mode]
+	if !ok {
+		factor, ok = DefaultEmissionsModel[mode]
+	}
+
+	if !ok || pkg.Distance <= 0 {
+		return nil, false
+	}
+
+	// Weight is in grams and distance in meters, but the factor is per kilogram and kilometer.
+	kgkm := (float64(pkg.Weight) / 1_000) * (float64(pkg.Distance) / 1_000)
+
+	return &Emissions{
+		CO2e:     int64(math.Round(kgkm * factor)),
+		Distance: pkg.Distance,
+	}, true
+}
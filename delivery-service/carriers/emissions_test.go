@@ -0,0 +1,38 @@
+package carriers
+
+import "testing"
+
+func TestEstimate(t *testing.T) {
+	model := EmissionsModel{ModeRoad: 0.09}
+
+	for _, tc := range []struct {
+		name     string
+		mode     TransportMode
+		weight   int64
+		distance int64
+		want     int64
+		ok       bool
+	}{
+		{"from the model", ModeRoad, 2_500, 600_000, 135, true},
+		{"from the default model", ModeAir, 2_500, 600_000, 900, true},
+		{"rounded", ModeRoad, 1_000, 10_000, 1, true},
+		{"no emissions", ModeCargoBike, 2_500, 10_000, 0, true},
+		{"unknown mode", TransportMode("teleport"), 2_500, 600_000, 0, false},
+		{"no distance", ModeRoad, 2_500, 0, 0, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			e, ok := model.Estimate(tc.mode, &Package{Weight: tc.weight, Distance: tc.distance})
+			if ok != tc.ok {
+				t.Fatalf("expected an estimate: %t, got %t", tc.ok, ok)
+			}
+
+			if !ok {
+				return
+			}
+
+			if e.CO2e != tc.want || e.Distance != tc.distance {
+				t.Errorf("expected %dg over %dm, got %dg over %dm", tc.want, tc.distance, e.CO2e, e.Distance)
+			}
+		})
+	}
+}
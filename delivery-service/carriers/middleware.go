@@ -0,0 +1,168 @@
+package carriers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/clock"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Middleware wraps a carrier with behaviour that is not specific to any one carrier, such as tracing, retries or
+// caching. See WithMiddleware.
+type Middleware struct {
+	// Name identifies the middleware in the chain of each carrier. See Carriers.Chains.
+	Name string
+
+	// Wrap returns a carrier that queries the carrier it is given. The returned carrier should forward the optional
+	// interfaces (such as Namer and Booker) of the carrier it wraps, most easily by embedding Decorator.
+	Wrap func(Carrier) Carrier
+}
+
+// Chain is the middleware a carrier is wrapped in.
+type Chain struct {
+	// Provider identifies the carrier, as in Outcome.
+	Provider string `json:"provider"`
+
+	// Carrier is the type of the (innermost) carrier.
+	Carrier string `json:"carrier"`
+
+	// Middleware are the names of the middleware, outermost (the first to see each query) first.
+	Middleware []string `json:"middleware"`
+
+	// Shadow is whether the carrier is only queried to be compared with the others. See WithShadow.
+	Shadow bool `json:"shadow,omitempty"`
+}
+
+// Decorator forwards queries, and the optional interfaces, to the carrier it wraps. Middleware embed it, and override
+// only what they change.
+type Decorator struct {
+	Carrier Carrier
+}
+
+func (d Decorator) Query(pkg *Package) ([]*DeliveryOption, error) {
+	return d.Carrier.Query(pkg)
+}
+
+// QueryContext queries the wrapped carrier with the context, if it supports it.
+func (d Decorator) QueryContext(ctx context.Context, pkg *Package) ([]*DeliveryOption, error) {
+	return QueryContext(ctx, d.Carrier, pkg)
+}
+
+// ProviderName returns the name of the wrapped carrier.
+func (d Decorator) ProviderName() string {
+	return name(d.Carrier)
+}
+
+// Emissions returns the emissions model of the wrapped carrier, if it has one.
+func (d Decorator) Emissions() EmissionsModel {
+	if e, ok := d.Carrier.(Emitter); ok {
+		return e.Emissions()
+	}
+
+	return nil
+}
+
+// Book books with the wrapped carrier, if it supports booking.
+func (d Decorator) Book(pkg *Package, opt *DeliveryOption) (*Booking, error) {
+	b, ok := d.Carrier.(Booker)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrBookingNotSupported, opt.Provider)
+	}
+
+	return b.Book(pkg, opt)
+}
+
+type attributesKey struct{}
+
+// ContextWithAttributes returns a context that carries attributes (such as the experiments the client is assigned) to
+// add to the telemetry of queries made with it; the delivery-option.queries counter, and the spans of Tracing.
+func ContextWithAttributes(ctx context.Context, attrs ...attribute.KeyValue) context.Context {
+	return context.WithValue(ctx, attributesKey{}, append(AttributesFromContext(ctx), attrs...))
+}
+
+// AttributesFromContext returns the attributes the context carries, if any.
+func AttributesFromContext(ctx context.Context) []attribute.KeyValue {
+	attrs, _ := ctx.Value(attributesKey{}).([]attribute.KeyValue)
+
+	return attrs[:len(attrs):len(attrs)]
+}
+
+// Tracing records each query of a carrier as a span, with the provider and the number of options it returned.
+func Tracing(t trace.Tracer) Middleware {
+	return Middleware{
+		Name: "tracing",
+		Wrap: func(c Carrier) Carrier {
+			return &traced{Decorator: Decorator{Carrier: c}, tracer: t}
+		},
+	}
+}
+
+type traced struct {
+	Decorator
+
+	tracer trace.Tracer
+}
+
+func (t *traced) Query(pkg *Package) ([]*DeliveryOption, error) {
+	return t.QueryContext(context.Background(), pkg)
+}
+
+func (t *traced) QueryContext(ctx context.Context, pkg *Package) ([]*DeliveryOption, error) {
+	ctx, span := t.tracer.Start(ctx, "carrier.query", trace.WithAttributes(
+		append(AttributesFromContext(ctx), attribute.String("provider", t.ProviderName()))...,
+	))
+	defer span.End()
+
+	opts, err := t.Decorator.QueryContext(ctx, pkg)
+
+	span.SetAttributes(attribute.Int("options", len(opts)))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return opts, err
+}
+
+// Record records each query of a carrier to the cassette. See Recorder.
+func Record(c *Cassette, cl clock.Clock) Middleware {
+	return Middleware{
+		Name: "record",
+		Wrap: func(ic Carrier) Carrier {
+			return &Recorder{Carrier: ic, Cassette: c, Clock: cl}
+		},
+	}
+}
+
+// Timeout abandons each query of a carrier that takes longer than the duration on the clock, as if the context had a
+// deadline. Carriers that do not implement ContextCarrier cannot be abandoned, and are waited for.
+func Timeout(d time.Duration, cl clock.Clock) Middleware {
+	return Middleware{
+		Name: "timeout",
+		Wrap: func(c Carrier) Carrier {
+			return &timeout{Decorator: Decorator{Carrier: c}, d: d, clock: cl}
+		},
+	}
+}
+
+type timeout struct {
+	Decorator
+
+	d     time.Duration
+	clock clock.Clock
+}
+
+func (t *timeout) Query(pkg *Package) ([]*DeliveryOption, error) {
+	return t.QueryContext(context.Background(), pkg)
+}
+
+func (t *timeout) QueryContext(ctx context.Context, pkg *Package) ([]*DeliveryOption, error) {
+	ctx, cancel := clock.WithTimeout(ctx, t.clock, t.d)
+	defer cancel()
+
+	return t.Decorator.QueryContext(ctx, pkg)
+}
@@ -0,0 +1,102 @@
+package carriers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/money"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// WithShadow adds a carrier that is queried alongside the others, but whose options are never returned (or booked).
+// Instead, what it returns is compared with what each of the others returned for the same package, in the
+// carrier.shadow.* metrics. This allows a new implementation of a carrier to be evaluated against real traffic without
+// affecting it.
+func WithShadow(nc Carrier) Option {
+	return func(c *Carriers) error {
+		c.shadows = append(c.shadows, nc)
+
+		return nil
+	}
+}
+
+type shadowKey struct{}
+
+// isShadow returns whether the query with the context is of a shadow, such that middleware (such as Recorder) can tell
+// it apart from the live carriers.
+func isShadow(ctx context.Context) bool {
+	shadow, _ := ctx.Value(shadowKey{}).(bool)
+
+	return shadow
+}
+
+// sample is what a single carrier returned for a package, reduced to what can be compared.
+type sample struct {
+	provider string
+	latency  time.Duration
+	failed   bool
+
+	// cheapest is the cost of the cheapest option, if there were any.
+	cheapest *money.Money
+}
+
+// newSample reduces what the carrier returned to a sample. The cost is copied, such that it is not affected by changes
+// to the options once they are returned (such as those made by the server).
+func newSample(provider string, opts []*DeliveryOption, err error, latency time.Duration) sample {
+	s := sample{provider: provider, latency: latency, failed: err != nil}
+	for _, o := range opts {
+		if o.Cost != nil && (s.cheapest == nil || o.Cost.Total < s.cheapest.Total) {
+			cost := *o.Cost
+			s.cheapest = &cost
+		}
+	}
+
+	return s
+}
+
+// shadow queries the shadow carrier for the package, then waits for the live carriers to be queried (as signalled by
+// done) and compares it with each of them. The query is not abandoned with the request; only by its own timeout (if it
+// has one), such that slow candidates are still measured.
+func (c *Carriers) shadow(ctx context.Context, sc Carrier, pkg *Package, done <-chan struct{}, live *[]sample) {
+	ctx = context.WithValue(context.WithoutCancel(ctx), shadowKey{}, true)
+
+	start := c.clock.Now()
+	opts, err := QueryContext(ctx, sc, pkg)
+	latency := c.clock.Now().Sub(start)
+
+	// A shadow excluded from the query (for example, by an experiment) has nothing to compare.
+	if errors.Is(err, ErrExcluded) {
+		return
+	}
+
+	s := newSample(name(sc), opts, err, latency)
+
+	<-done
+
+	for _, l := range *live {
+		attrs := metric.WithAttributes(attribute.String("shadow", s.provider), attribute.String("live", l.provider))
+
+		c.metrics.shadowComparisons.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("shadow", s.provider),
+			attribute.String("live", l.provider),
+			attribute.Bool("shadow_failed", s.failed),
+			attribute.Bool("live_failed", l.failed),
+		))
+
+		if s.failed || l.failed {
+			continue
+		}
+
+		c.metrics.shadowLatency.Record(ctx, (s.latency - l.latency).Seconds(), attrs)
+
+		// Prices can only be compared in the same currency, and relative to a price that is not free.
+		if s.cheapest == nil || l.cheapest == nil || s.cheapest.Currency != l.cheapest.Currency || l.cheapest.Total == 0 {
+			continue
+		}
+
+		delta := float64(s.cheapest.Total-l.cheapest.Total) / float64(l.cheapest.Total) * 100
+		c.metrics.shadowPrice.Record(ctx, delta, attrs)
+	}
+}
@@ -0,0 +1,171 @@
+package carriers_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/carriers"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/clock"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/money"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// live is a carrier that waits for the shadow to be queried, then takes its latency (on the fake clock) to quote a
+// single option.
+type live struct {
+	clk     *clock.Fake
+	latency time.Duration
+	cost    int64
+
+	shadowed <-chan struct{}
+}
+
+func (l *live) Query(pkg *carriers.Package) ([]*carriers.DeliveryOption, error) {
+	<-l.shadowed
+	l.clk.Advance(l.latency)
+
+	return []*carriers.DeliveryOption{{Provider: "live", Cost: &money.Money{Total: l.cost, Currency: "EUR"}}}, nil
+}
+
+func (l *live) ProviderName() string {
+	return "live"
+}
+
+// shadow is a carrier that, once queried, waits to be released before it quotes a single option. It sends the error
+// of the context it was queried with once it has been.
+type shadow struct {
+	cost int64
+
+	queried chan struct{}
+	release chan struct{}
+	errs    chan error
+}
+
+func (s *shadow) Query(pkg *carriers.Package) ([]*carriers.DeliveryOption, error) {
+	return s.QueryContext(context.Background(), pkg)
+}
+
+func (s *shadow) QueryContext(ctx context.Context, pkg *carriers.Package) ([]*carriers.DeliveryOption, error) {
+	close(s.queried)
+	<-s.release
+
+	// The package is a copy, so changing it does not change the package of the live carriers.
+	pkg.Weight = 0
+	s.errs <- ctx.Err()
+
+	return []*carriers.DeliveryOption{{Provider: "shadow", Cost: &money.Money{Total: s.cost, Currency: "EUR"}}}, nil
+}
+
+func (s *shadow) ProviderName() string {
+	return "shadow"
+}
+
+func TestShadow(t *testing.T) {
+	clk := clock.NewFake(time.Date(2023, 9, 9, 12, 0, 0, 0, time.UTC))
+	reader := sdkmetric.NewManualReader()
+
+	sc := &shadow{cost: 1200, queried: make(chan struct{}), release: make(chan struct{}), errs: make(chan error, 1)}
+	lc := &live{clk: clk, latency: 100 * time.Millisecond, cost: 1000, shadowed: sc.queried}
+
+	c, err := carriers.New(
+		carriers.WithClock(clk),
+		carriers.WithMeter(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")),
+		carriers.WithCarrier(lc),
+		carriers.WithShadow(sc),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pkg := &carriers.Package{Width: 200, Height: 35, Depth: 150, Weight: 2_500}
+
+	// The shadow is still waiting to be released, so the response does not wait for it.
+	opts, outcomes, err := c.QueryOutcomes(ctx, pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(opts) != 1 || opts[0].Provider != "live" || opts[0].Cost.Total != 1000 {
+		t.Errorf("expected only the option of the live carrier, got %v", opts)
+	}
+
+	if len(outcomes) != 1 || outcomes[0].Provider != "live" || outcomes[0].Latency != lc.latency {
+		t.Errorf("expected only the outcome of the live carrier, taking %s, got %+v", lc.latency, outcomes)
+	}
+
+	if pkg.Weight != 2_500 {
+		t.Errorf("expected the package not to be changed, got a weight of %d", pkg.Weight)
+	}
+
+	// The request is done, but the shadow is still measured; taking 250ms in all.
+	cancel()
+	clk.Advance(150 * time.Millisecond)
+	close(sc.release)
+
+	if err := <-sc.errs; err != nil {
+		t.Errorf("expected the shadow to be queried to completion, got %v", err)
+	}
+
+	// The comparison is recorded once the shadow returns; the price last.
+	var metrics map[string]metricdata.Metrics
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if metrics = collect(t, reader); len(metrics["carrier.shadow.price.delta"].Name) > 0 {
+			break
+		}
+	}
+
+	comparisons, ok := metrics["carrier.shadow.comparisons"].Data.(metricdata.Sum[int64])
+	if !ok || len(comparisons.DataPoints) != 1 || comparisons.DataPoints[0].Value != 1 {
+		t.Fatalf("expected a single comparison, got %+v", metrics["carrier.shadow.comparisons"].Data)
+	}
+
+	for k, want := range map[attribute.Key]attribute.Value{
+		"shadow":        attribute.StringValue("shadow"),
+		"live":          attribute.StringValue("live"),
+		"shadow_failed": attribute.BoolValue(false),
+		"live_failed":   attribute.BoolValue(false),
+	} {
+		if got, _ := comparisons.DataPoints[0].Attributes.Value(k); got != want {
+			t.Errorf("%s: expected %v, got %v", k, want.Emit(), got.Emit())
+		}
+	}
+
+	for name, want := range map[string]float64{
+		// The shadow took 150ms longer than the live carrier, and its cheapest option cost 20% more.
+		"carrier.shadow.latency.delta": 0.15,
+		"carrier.shadow.price.delta":   20,
+	} {
+		h, ok := metrics[name].Data.(metricdata.Histogram[float64])
+		if !ok || len(h.DataPoints) != 1 || h.DataPoints[0].Count != 1 {
+			t.Errorf("%s: expected a single value, got %+v", name, metrics[name].Data)
+			continue
+		}
+
+		if got := h.DataPoints[0].Sum; got < want-1e-9 || got > want+1e-9 {
+			t.Errorf("%s: expected %v, got %v", name, want, got)
+		}
+	}
+}
+
+// collect returns the metrics that have been recorded, keyed by their name.
+func collect(t *testing.T, reader sdkmetric.Reader) map[string]metricdata.Metrics {
+	t.Helper()
+
+	rm := metricdata.ResourceMetrics{}
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics := map[string]metricdata.Metrics{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m
+		}
+	}
+
+	return metrics
+}
@@ -0,0 +1,298 @@
+package carriers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/clock"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/money"
+)
+
+var (
+	ErrSimulatedFailure = errors.New("simulated carrier failure")
+)
+
+// MaxPickupOptions is the maximum number of pickup points that a simulated carrier offers for a single package.
+const MaxPickupOptions = 3
+
+// Simulated is a fake carrier. It generates random (but plausible) delivery options, takes a random amount of time
+// to do so and, occasionally, fails. It stands in for the third party APIs a real delivery service would call.
+type Simulated struct {
+	// Name is the short name of the provider, such as "svx".
+	Name string
+
+	// Currency is the ISO code of the currency the carrier quotes in.
+	Currency string
+
+	// Base is the fixed cost of any delivery, and PerKg the cost of each (started) kilogram, both in the base unit of
+	// the currency.
+	Base, PerKg int64
+
+	// Transit is the minimum time a delivery takes, and Spread the maximum random time added to it.
+	Transit, Spread time.Duration
+
+	// Latency is the maximum time the carrier takes to answer a query.
+	Latency time.Duration
+
+	// FailureRate is the probability (between 0 and 1) that a query fails.
+	FailureRate float64
+
+	// Modes are the modes of transport the carrier offers. An option is generated for each.
+	Modes []TransportMode
+
+	// Model is how much the carrier emits per mode of transport. Modes not in the model use the
+	// DefaultEmissionsModel.
+	Model EmissionsModel
+
+	// Rand is the source of randomness for prices, arrivals, latencies and failures. With the same source (and the
+	// same sequence of queries), the carrier behaves the same way every time. If nil, the global source is used.
+	Rand *rand.Rand
+
+	// Clock is what the carrier tells the time (and waits for its latency) with. If nil, the real clock is used.
+	Clock clock.Clock
+
+	// mu guards Rand, which is not safe to use concurrently.
+	mu sync.Mutex
+}
+
+// Simulations are the (nonsensical) providers described in the README.
+func Simulations() []*Simulated {
+	return []*Simulated{
+		{
+			Name:        "svx", // Stock Variant Express
+			Currency:    "EUR",
+			Base:        590,
+			PerKg:       90,
+			Transit:     24 * time.Hour,
+			Spread:      12 * time.Hour,
+			Latency:     150 * time.Millisecond,
+			FailureRate: 0.05,
+			Modes:       []TransportMode{ModeAir, ModeRoad},
+		},
+		{
+			Name:        "mmc", // Million Mile Company
+			Currency:    "GBP",
+			Base:        450,
+			PerKg:       60,
+			Transit:     48 * time.Hour,
+			Spread:      24 * time.Hour,
+			Latency:     300 * time.Millisecond,
+			FailureRate: 0.1,
+			Modes:       []TransportMode{ModeRoad, ModeRoadElectric},
+			Model: EmissionsModel{
+				ModeRoad:         0.09,
+				ModeRoadElectric: 0.03,
+			},
+		},
+		{
+			Name:        "hid", // High Inertia Delivery
+			Currency:    "EUR",
+			Base:        320,
+			PerKg:       30,
+			Transit:     96 * time.Hour,
+			Spread:      48 * time.Hour,
+			Latency:     800 * time.Millisecond,
+			FailureRate: 0.2,
+			Modes:       []TransportMode{ModeRail},
+		},
+	}
+}
+
+// SeededSimulations are the same as Simulations, but each carrier draws its randomness from a source seeded from the
+// seed and its name. Carriers thus behave the same way for the same seed, regardless of which others are registered.
+func SeededSimulations(seed int64) []*Simulated {
+	return NewSeeds(seed).Simulations()
+}
+
+// Seeds are the sources of randomness of the simulated carriers, each seeded from a single seed and the name of the
+// carrier. Simulations created from the same Seeds share their sources, such that replacing the carriers (for example,
+// when the configuration is reloaded) continues each sequence rather than starting it again.
+type Seeds struct {
+	seed int64
+
+	mu      sync.Mutex
+	sources map[string]*rand.Rand
+}
+
+// NewSeeds creates the sources for the seed. Each is only created once the carrier it is for is first simulated.
+func NewSeeds(seed int64) *Seeds {
+	return &Seeds{seed: seed, sources: map[string]*rand.Rand{}}
+}
+
+// Simulations are the same as Simulations, but each carrier draws its randomness from its source.
+func (s *Seeds) Simulations() []*Simulated {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sims := Simulations()
+	for _, sim := range sims {
+		r, ok := s.sources[sim.Name]
+		if !ok {
+			h := fnv.New64a()
+			h.Write([]byte(sim.Name))
+
+			// The source is shared by every simulation of the carrier, which may be queried at the same time.
+			r = rand.New(&lockedSource{src: rand.NewSource(s.seed ^ int64(h.Sum64())).(rand.Source64)})
+			s.sources[sim.Name] = r
+		}
+
+		sim.Rand = r
+	}
+
+	return sims
+}
+
+// lockedSource is a source of randomness that is safe to use concurrently.
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source64
+}
+
+func (l *lockedSource) Int63() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.src.Int63()
+}
+
+func (l *lockedSource) Uint64() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.src.Uint64()
+}
+
+func (l *lockedSource) Seed(seed int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.src.Seed(seed)
+}
+
+// Query generates the options for the package.
+func (s *Simulated) Query(pkg *Package) ([]*DeliveryOption, error) {
+	return s.QueryContext(context.Background(), pkg)
+}
+
+// QueryContext is the same as Query, but stops waiting for the carrier to respond once the context is done.
+func (s *Simulated) QueryContext(ctx context.Context, pkg *Package) ([]*DeliveryOption, error) {
+	// Real APIs take time to respond.
+	if err := clock.SleepContext(ctx, s.clock(), time.Duration(s.int63n(int64(s.Latency)+1))); err != nil {
+		return nil, err
+	}
+
+	if s.float64() < s.FailureRate {
+		return nil, ErrSimulatedFailure
+	}
+
+	// Carriers charge for every started kilogram.
+	kg := (pkg.Weight + 999) / 1_000
+
+	opts := make([]*DeliveryOption, 0, len(s.Modes))
+	for _, mode := range s.Modes {
+		// Prices vary by up to 20% between queries, as if they were based on demand.
+		total := s.Base + s.PerKg*kg
+		total += s.int63n(total/5 + 1)
+
+		arrival := s.clock().Now().Add(s.Transit + time.Duration(s.int63n(int64(s.Spread)+1)))
+
+		opts = append(opts, &DeliveryOption{
+			Provider: s.Name,
+			Cost:     &money.Money{Total: total, Currency: s.Currency},
+
+			// The arrival is only estimated within a 6 hour window.
+			Arrival: arrival.Truncate(6 * time.Hour),
+			Mode:    mode,
+		})
+	}
+
+	// Offer delivery to the pickup points the carrier operates near the destination. These are cheaper, as the
+	// carrier can deliver many packages in a single stop.
+	offered := 0
+	for _, p := range pkg.PickupPoints {
+		if offered == MaxPickupOptions || len(opts) == 0 {
+			break
+		}
+
+		if p.Carrier != s.Name || !p.Accepts(pkg.Width, pkg.Height, pkg.Depth, pkg.Weight) {
+			continue
+		}
+
+		// Pickup options are based on the first (door) option, which always exists if the carrier has a mode.
+		cost, err := opts[0].Cost.ApplyPercentage(8_000, money.RoundHalfUp)
+		if err != nil {
+			continue
+		}
+
+		opts = append(opts, &DeliveryOption{
+			Provider:    s.Name,
+			Cost:        cost,
+			Arrival:     opts[0].Arrival,
+			Mode:        opts[0].Mode,
+			PickupPoint: p,
+		})
+		offered++
+	}
+
+	return opts, nil
+}
+
+// Book pretends to book the option, returning a random reference. Like queries, bookings occasionally fail.
+func (s *Simulated) Book(pkg *Package, opt *DeliveryOption) (*Booking, error) {
+	s.clock().Sleep(time.Duration(s.int63n(int64(s.Latency) + 1)))
+
+	if s.float64() < s.FailureRate {
+		return nil, ErrSimulatedFailure
+	}
+
+	return &Booking{
+		Reference: fmt.Sprintf("%s-%010d", strings.ToUpper(s.Name), s.int63n(10_000_000_000)),
+		Provider:  s.Name,
+		Booked:    s.clock().Now(),
+	}, nil
+}
+
+// ProviderName returns the name the carrier provides options under.
+func (s *Simulated) ProviderName() string {
+	return s.Name
+}
+
+// Emissions returns the emissions model of the carrier.
+func (s *Simulated) Emissions() EmissionsModel {
+	return s.Model
+}
+
+// clock returns the clock of the carrier, or the real clock if it has none.
+func (s *Simulated) clock() clock.Clock {
+	return clock.Or(s.Clock)
+}
+
+// int63n returns a random number in [0, n) from the source of the carrier.
+func (s *Simulated) int63n(n int64) int64 {
+	if s.Rand == nil {
+		return rand.Int63n(n)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.Rand.Int63n(n)
+}
+
+// float64 returns a random number in [0, 1) from the source of the carrier.
+func (s *Simulated) float64() float64 {
+	if s.Rand == nil {
+		return rand.Float64()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.Rand.Float64()
+}
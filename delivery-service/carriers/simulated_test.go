@@ -0,0 +1,78 @@
+package carriers_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/carriers"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/clock"
+)
+
+// answer is what a carrier returned for a single query.
+type answer struct {
+	opts []*carriers.DeliveryOption
+	err  error
+}
+
+// seeded queries the simulations of the seeds that are named, in turn, for a number of rounds, and returns what each
+// returned by name. The simulations answer quickly, on a clock that starts at a fixed time.
+func seeded(t *testing.T, seeds *carriers.Seeds, clk clock.Clock, rounds int, names ...string) map[string][]answer {
+	t.Helper()
+
+	sims := map[string]*carriers.Simulated{}
+	for _, s := range seeds.Simulations() {
+		s.Latency = time.Millisecond
+		s.Clock = clk
+		sims[s.Name] = s
+	}
+
+	pkg := &carriers.Package{Width: 200, Height: 35, Depth: 150, Weight: 2_500}
+
+	out := map[string][]answer{}
+	for i := 0; i < rounds; i++ {
+		for _, n := range names {
+			opts, err := sims[n].QueryContext(context.Background(), pkg)
+			out[n] = append(out[n], answer{opts: opts, err: err})
+		}
+	}
+
+	return out
+}
+
+func TestSeeds(t *testing.T) {
+	clk := clock.From(time.Date(2023, 9, 9, 0, 0, 0, 0, time.UTC))
+
+	t.Run("the same seed gives the same answers, whichever others are queried", func(t *testing.T) {
+		all := seeded(t, carriers.NewSeeds(42), clk, 20, "svx", "mmc", "hid")
+		some := seeded(t, carriers.NewSeeds(42), clk, 20, "hid", "svx")
+
+		for _, n := range []string{"svx", "hid"} {
+			if !reflect.DeepEqual(all[n], some[n]) {
+				t.Errorf("expected %s to answer the same without mmc, got %+v and %+v", n, all[n], some[n])
+			}
+		}
+	})
+
+	t.Run("another seed gives other answers", func(t *testing.T) {
+		a := seeded(t, carriers.NewSeeds(42), clk, 20, "svx")
+		b := seeded(t, carriers.NewSeeds(43), clk, 20, "svx")
+
+		if reflect.DeepEqual(a, b) {
+			t.Errorf("expected another seed to answer differently, got %+v", a)
+		}
+	})
+
+	t.Run("simulations created again continue the sequence", func(t *testing.T) {
+		once := seeded(t, carriers.NewSeeds(42), clk, 20, "svx")
+
+		seeds := carriers.NewSeeds(42)
+		twice := seeded(t, seeds, clk, 10, "svx")
+		twice["svx"] = append(twice["svx"], seeded(t, seeds, clk, 10, "svx")["svx"]...)
+
+		if !reflect.DeepEqual(once, twice) {
+			t.Errorf("expected the simulations to continue where the last left off, got %+v and %+v", once, twice)
+		}
+	})
+}
@@ -0,0 +1,110 @@
+// package clock abstracts the passing of time, such that code that depends on it (for example, quotes expiring or the
+// simulated carriers taking time to respond) can be made reproducible, and tested without waiting.
+package clock
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Clock tells the time, and waits for it to pass.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// Sleep waits for the duration to pass.
+	Sleep(d time.Duration)
+
+	// After returns a channel that receives the time once the duration has passed.
+	After(d time.Duration) <-chan time.Time
+}
+
+// Real is the clock on the wall, as provided by the time package.
+var Real Clock = real{}
+
+type real struct{}
+
+func (real) Now() time.Time                         { return time.Now() }
+func (real) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (real) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// From returns a clock that reads the supplied time when it is created, and runs at the speed of the real clock from
+// then on. Unlike a Fake, it does not need advancing; but the times it tells do not depend on when the process started,
+// such that (for example) the arrivals of seeded carriers are the same on every run.
+func From(start time.Time) Clock {
+	return &from{start: start, origin: time.Now()}
+}
+
+type from struct {
+	start, origin time.Time
+}
+
+func (f *from) Now() time.Time                         { return f.start.Add(time.Since(f.origin)) }
+func (f *from) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (f *from) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Or returns the clock, or the real clock if it is nil. It saves every user of an optional clock checking for nil.
+func Or(c Clock) Clock {
+	if c == nil {
+		return Real
+	}
+
+	return c
+}
+
+// SleepContext waits for the duration to pass on the clock, unless the context is done first, in which case it returns
+// the error of the context.
+func SleepContext(ctx context.Context, c Clock, d time.Duration) error {
+	// Select chooses at random when both are ready, so a context that is already done must be checked first.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	select {
+	case <-Or(c).After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// WithTimeout is the same as context.WithTimeout, but the timeout passes on the clock rather than the clock on the wall.
+// Once it has, the error of the context is context.DeadlineExceeded.
+func WithTimeout(parent context.Context, c Clock, d time.Duration) (context.Context, context.CancelFunc) {
+	c = Or(c)
+	if c == Real {
+		return context.WithTimeout(parent, d)
+	}
+
+	ctx, cancel := context.WithCancelCause(parent)
+	tc := &timeoutContext{Context: ctx}
+
+	// The timer is abandoned once the context is done, whether because it expired or not.
+	expired := c.After(d)
+	go func() {
+		select {
+		case <-expired:
+			cancel(context.DeadlineExceeded)
+		case <-ctx.Done():
+		}
+	}()
+
+	return tc, func() { cancel(context.Canceled) }
+}
+
+// timeoutContext is a context that is cancelled once its timeout passes on a clock. The deadline is not reported by
+// Deadline; what uses it (such as the net package) compares it with the clock on the wall.
+type timeoutContext struct {
+	context.Context
+}
+
+// Err reports the deadline passing as context.DeadlineExceeded, rather than the context.Canceled it was cancelled with.
+func (t *timeoutContext) Err() error {
+	err := t.Context.Err()
+	if err != nil && errors.Is(context.Cause(t.Context), context.DeadlineExceeded) {
+		return context.DeadlineExceeded
+	}
+
+	return err
+}
@@ -0,0 +1,105 @@
+package clock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitForWaiters blocks until something is waiting on the clock, such that advancing it wakes it.
+func waitForWaiters(f *Fake) {
+	for f.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSleepContext(t *testing.T) {
+	clk := NewFake(time.Date(2023, 9, 9, 12, 0, 0, 0, time.UTC))
+
+	t.Run("sleeps until the clock is advanced", func(t *testing.T) {
+		done := make(chan error)
+		go func() { done <- SleepContext(context.Background(), clk, time.Minute) }()
+
+		waitForWaiters(clk)
+		clk.Advance(59 * time.Second)
+
+		select {
+		case err := <-done:
+			t.Fatalf("expected to still be sleeping, got %v", err)
+		default:
+		}
+
+		clk.Advance(time.Second)
+
+		if err := <-done; err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("returns the error of the context once it is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		done := make(chan error)
+		go func() { done <- SleepContext(ctx, clk, time.Minute) }()
+
+		waitForWaiters(clk)
+		cancel()
+
+		if err := <-done; !errors.Is(err, context.Canceled) {
+			t.Errorf("expected %v, got %v", context.Canceled, err)
+		}
+	})
+
+	t.Run("returns immediately if the context is already done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if err := SleepContext(ctx, clk, 0); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected %v, got %v", context.Canceled, err)
+		}
+	})
+}
+
+func TestWithTimeout(t *testing.T) {
+	start := time.Date(2023, 9, 9, 12, 0, 0, 0, time.UTC)
+
+	t.Run("expires once the clock passes the timeout", func(t *testing.T) {
+		clk := NewFake(start)
+
+		ctx, cancel := WithTimeout(context.Background(), clk, time.Second)
+		defer cancel()
+
+		clk.Advance(time.Second)
+		<-ctx.Done()
+
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			t.Errorf("expected %v, got %v", context.DeadlineExceeded, ctx.Err())
+		}
+	})
+
+	t.Run("is cancelled by its cancel function", func(t *testing.T) {
+		clk := NewFake(start)
+
+		ctx, cancel := WithTimeout(context.Background(), clk, time.Second)
+		cancel()
+		<-ctx.Done()
+
+		if !errors.Is(ctx.Err(), context.Canceled) {
+			t.Errorf("expected %v, got %v", context.Canceled, ctx.Err())
+		}
+	})
+
+	t.Run("does not expire on the wall clock", func(t *testing.T) {
+		clk := NewFake(start)
+
+		ctx, cancel := WithTimeout(context.Background(), clk, time.Millisecond)
+		defer cancel()
+
+		select {
+		case <-ctx.Done():
+			t.Fatalf("expected the context not to be done, got %v", ctx.Err())
+		case <-time.After(10 * time.Millisecond):
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fake is a clock that only moves when told to. Anything waiting on it (with Sleep or After) is woken once the clock
+// is advanced past the time it is waiting for. It is safe to use concurrently.
+type Fake struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []waiter
+}
+
+// waiter is something waiting for the clock to reach a time.
+type waiter struct {
+	until time.Time
+	ch    chan time.Time
+}
+
+// NewFake creates a fake clock, stopped at the supplied time.
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.now
+}
+
+func (f *Fake) Sleep(d time.Duration) {
+	<-f.After(d)
+}
+
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// The channel is buffered, such that advancing the clock never blocks on a waiter that has gone away.
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- f.now
+		return ch
+	}
+
+	f.waiters = append(f.waiters, waiter{until: f.now.Add(d), ch: ch})
+
+	return ch
+}
+
+// Advance moves the clock forward by the duration, waking everything waiting for a time that has now passed (in the
+// order they would have woken).
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.set(f.now.Add(d))
+}
+
+// Set moves the clock to the time. Moving it backwards wakes nothing.
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.set(t)
+}
+
+// Waiters is the number of things waiting for the clock to advance. Tests can check it to know that (for example) a
+// goroutine has started sleeping, before advancing the clock.
+func (f *Fake) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return len(f.waiters)
+}
+
+// set moves the clock, and wakes the waiters whose time has come. The lock must be held.
+func (f *Fake) set(t time.Time) {
+	f.now = t
+
+	sort.SliceStable(f.waiters, func(i, j int) bool { return f.waiters[i].until.Before(f.waiters[j].until) })
+
+	i := 0
+	for ; i < len(f.waiters) && !f.waiters[i].until.After(t); i++ {
+		f.waiters[i].ch <- t
+	}
+
+	f.waiters = f.waiters[i:]
+}
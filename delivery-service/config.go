@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/carriers"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/clock"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/config"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/experiments"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/quota"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/server"
+)
+
+// flagSettings are the flags that set a setting of the configuration, and the path of that setting.
+var flagSettings = map[string]string{
+	"a":            "listen.http",
+	"h3":           "listen.http3",
+	"admin-addr":   "listen.admin",
+	"metrics-addr": "telemetry.metrics_addr",
+	"log-level":    "telemetry.log_level",
+}
+
+// configFile returns the file of configuration; from -config or, if it is not set, $DELIVERY_CONFIG.
+func configFile() string {
+	if *configPath != "" {
+		return *configPath
+	}
+
+	return os.Getenv("DELIVERY_CONFIG")
+}
+
+// resolveConfig loads the configuration from the file (if there is one), the environment and the flags that were set,
+// in increasing order of precedence. It is not validated.
+func resolveConfig() (*config.Config, error) {
+	flags := config.Layer{Source: config.SourceFlag, Values: map[string]string{}}
+	flag.Visit(func(f *flag.Flag) {
+		if p, ok := flagSettings[f.Name]; ok {
+			flags.Values[p] = f.Value.String()
+		}
+	})
+
+	return config.Load(configFile(), config.Env(os.Environ()), flags)
+}
+
+// loadConfig resolves the configuration, and validates it.
+func loadConfig() (*config.Config, error) {
+	c, err := resolveConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return c, c.Validate()
+}
+
+// reload loads the configuration again and, if it is valid, applies what changed to the running service. Settings
+// that can only change with a restart are logged, but otherwise ignored.
+func reload(clk clock.Clock, cassette *carriers.Cassette, limiter *quota.Limiter, seeds *carriers.Seeds, srv *server.Server) error {
+	if configFile() == "" {
+		return errors.New("there is no configuration file to reload")
+	}
+
+	next, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	changes, err := config.Diff(cfg, next)
+	if err != nil {
+		return err
+	}
+
+	if len(changes) == 0 {
+		log.Info("configuration reloaded, without changes", "path", configFile())
+		return nil
+	}
+
+	// The experiments and carriers are replaced as a whole, such that requests in progress finish with those they
+	// started with.
+	exps, err := experiments.New(next.Experiments, experiments.Defaults...)
+	if err != nil {
+		return err
+	}
+
+	c, err := bootstrapCarriers(clk, next, cassette, exps, limiter, seeds)
+	if err != nil {
+		return err
+	}
+
+	// Set checks every limit before it applies any, such that if they cannot be set the service is left as it was.
+	if err := limiter.Set(next.Limits()); err != nil {
+		return err
+	}
+
+	srv.SetExperiments(exps)
+	srv.SetCarriers(c)
+
+	// Hint: The level has already been validated.
+	l, _ := next.LogLevel()
+	level.Set(l)
+
+	cfg = next
+	log.Info("configuration reloaded", "path", configFile(), slog.Group("changes", config.Attrs(changes)...))
+
+	for _, ch := range changes {
+		if ch.RequiresRestart() {
+			log.Warn("configuration changed that requires a restart to take effect", "setting", ch.Path)
+		}
+	}
+
+	return nil
+}
+
+// configCommand runs the "config" subcommand. "config print" writes the effective configuration to stdout, along with
+// where each value came from. For example,
+//
+//	DELIVERY_TIMEOUTS_CARRIER=1s ./delivery-service -config config.json -a :8080 config print
+//
+// It returns the exit code for the process; 1 if the configuration is invalid (after printing it).
+func configCommand(args []string) int {
+	if len(args) != 1 || args[0] != "print" {
+		log.Error(`config requires exactly one argument; "print"`)
+		return 2
+	}
+
+	c, err := resolveConfig()
+	if err != nil {
+		log.Error("failed to load configuration", "error", err, "path", configFile())
+		return 1
+	}
+
+	values, err := c.Values()
+	if err != nil {
+		log.Error("failed to print configuration", "error", err)
+		return 1
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SETTING\tVALUE\tSOURCE")
+
+	for _, p := range config.Paths(values) {
+		fmt.Fprintf(tw, "%s\t%v\t%s\n", p, values[p], c.Source(p))
+	}
+
+	if err := tw.Flush(); err != nil {
+		log.Error("failed to print configuration", "error", err)
+		return 1
+	}
+
+	if err := c.Validate(); err != nil {
+		log.Error("the configuration is invalid", "error", err)
+		return 1
+	}
+
+	return 0
+}
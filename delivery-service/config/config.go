@@ -0,0 +1,419 @@
+// package config is the configuration of the service: where it listens, which carriers it queries (and how), how long
+// it waits for them, how it prices their options and how it reports on itself. It is layered; each setting is taken
+// from (in order of precedence) flags, DELIVERY_* environment variables, a file or the defaults. The configuration can
+// be reloaded while the service is running; see Diff.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"time"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/carriers"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/experiments"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/lifecycle"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/pricing"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/quota"
+)
+
+var (
+	ErrFailedToLoad  = errors.New("failed to load configuration")
+	ErrInvalidConfig = errors.New("invalid configuration")
+)
+
+// Config is the configuration of the service. Fields that are not set are given their defaults; see SetDefaults.
+type Config struct {
+	Listen      Listen                   `json:"listen"`
+	Carriers    []Carrier                `json:"carriers"`
+	Timeouts    Timeouts                 `json:"timeouts"`
+	Pricing     pricing.Rules            `json:"pricing"`
+	Experiments []experiments.Experiment `json:"experiments"`
+	Telemetry   Telemetry                `json:"telemetry"`
+
+	// sources are where each setting came from, keyed by its path. Settings that are not in it are defaults.
+	sources map[string]Source
+}
+
+// Listen are the addresses the service listens on. They can only be changed with a restart.
+type Listen struct {
+	// HTTP is the (TCP) address the API is served on.
+	HTTP string `json:"http"`
+
+	// HTTP3 is the (UDP) address the API is additionally served on over HTTP/3. If empty, HTTP/3 is not served.
+	HTTP3 string `json:"http3"`
+
+	// Admin is the (TCP) address the routes for operators, such as the usage of every client, are served on.
+	Admin string `json:"admin"`
+}
+
+// Carrier is a (simulated) provider to query, optionally with its behaviour changed from that described in the
+// README. Fields that are nil are left as they are.
+type Carrier struct {
+	// Name is the name of the provider, such as "svx".
+	Name string `json:"name"`
+
+	// Disabled providers are not queried, as if they were not listed.
+	Disabled bool `json:"disabled,omitempty"`
+
+	// Shadow providers are queried, but their options are only compared with those of the others; never returned.
+	Shadow bool `json:"shadow,omitempty"`
+
+	// Base and PerKg are the costs of the provider, in the base unit of its currency.
+	Base  *int64 `json:"base,omitempty"`
+	PerKg *int64 `json:"per_kg,omitempty"`
+
+	// Latency is the maximum time the provider takes to respond.
+	Latency *Duration `json:"latency,omitempty"`
+
+	// FailureRate is the probability (between 0 and 1) that a query fails.
+	FailureRate *float64 `json:"failure_rate,omitempty"`
+
+	// Limit is how often the provider can be queried. If nil, it is not limited.
+	Limit *Limit `json:"limit,omitempty"`
+}
+
+// Limit is how often a provider can be queried; see quota.Limit.
+type Limit struct {
+	// Rate is the number of requests per second, and Burst the number that can be sent at once.
+	Rate  float64 `json:"rate,omitempty"`
+	Burst int     `json:"burst,omitempty"`
+
+	// Daily is the number of requests each day, starting at midnight UTC.
+	Daily int64 `json:"daily,omitempty"`
+
+	// Queue is how long a query waits for the rate to allow it, before the provider is excluded instead.
+	Queue Duration `json:"queue,omitempty"`
+}
+
+// Timeouts are how long the service waits.
+type Timeouts struct {
+	// Carrier is how long a single carrier has to respond to a query, before it is abandoned.
+	Carrier Duration `json:"carrier"`
+
+	// Lifecycle is how long each component of the service has to start, become ready and stop. It can only be changed
+	// with a restart.
+	Lifecycle Duration `json:"lifecycle"`
+}
+
+// Telemetry is how the service reports on itself.
+type Telemetry struct {
+	// LogLevel is the least severe level that is logged: "debug", "info", "warn" or "error".
+	LogLevel string `json:"log_level"`
+
+	// MetricsAddr is the address on which metrics are served for Prometheus. It can only be changed with a restart.
+	MetricsAddr string `json:"metrics_addr"`
+}
+
+// Defaults are the values given to the fields that are not set.
+var Defaults = Config{
+	Listen: Listen{
+		HTTP:  "localhost:9093",
+		Admin: "localhost:9096",
+	},
+	Timeouts: Timeouts{
+		Carrier:   Duration(5 * time.Second),
+		Lifecycle: Duration(lifecycle.DefaultTimeout),
+	},
+	Telemetry: Telemetry{
+		LogLevel:    "info",
+		MetricsAddr: "localhost:9094",
+	},
+}
+
+// Load reads the configuration from the file (if there is one), then sets the values of each layer in turn, such that
+// later layers take precedence over earlier ones (and all of them over the file). Fields that are still not set are
+// given their defaults. Fields in the file that are not known are rejected, such that typos are not silently ignored.
+// The configuration is not validated.
+func Load(path string, layers ...Layer) (*Config, error) {
+	c := &Config{sources: map[string]Source{}}
+
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrFailedToLoad, err)
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+
+		if err := dec.Decode(c); err != nil {
+			return nil, fmt.Errorf("%w: %s: %s", ErrFailedToLoad, path, err)
+		}
+
+		// Hint: The file has already been decoded, so cannot fail to be decoded again.
+		raw := map[string]any{}
+		json.Unmarshal(b, &raw)
+
+		c.fromFile(raw)
+	}
+
+	for _, l := range layers {
+		if err := c.apply(l); err != nil {
+			return nil, err
+		}
+	}
+
+	c.SetDefaults()
+
+	return c, nil
+}
+
+// New returns the configuration used when there is no file, or any other layer; the defaults.
+func New() *Config {
+	c := &Config{sources: map[string]Source{}}
+	c.SetDefaults()
+
+	return c
+}
+
+// SetDefaults gives the fields that are not set their defaults. If no carriers are listed, every simulated provider
+// is queried.
+func (c *Config) SetDefaults() {
+	if c.Listen.HTTP == "" {
+		c.Listen.HTTP = Defaults.Listen.HTTP
+	}
+
+	if c.Listen.Admin == "" {
+		c.Listen.Admin = Defaults.Listen.Admin
+	}
+
+	if c.Carriers == nil {
+		for _, s := range carriers.Simulations() {
+			c.Carriers = append(c.Carriers, Carrier{Name: s.Name})
+		}
+	}
+
+	if c.Pricing == nil {
+		c.Pricing = pricing.Rules{}
+	}
+
+	if c.Experiments == nil {
+		c.Experiments = []experiments.Experiment{}
+	}
+
+	if c.Timeouts.Carrier == 0 {
+		c.Timeouts.Carrier = Defaults.Timeouts.Carrier
+	}
+
+	if c.Timeouts.Lifecycle == 0 {
+		c.Timeouts.Lifecycle = Defaults.Timeouts.Lifecycle
+	}
+
+	if c.Telemetry.LogLevel == "" {
+		c.Telemetry.LogLevel = Defaults.Telemetry.LogLevel
+	}
+
+	if c.Telemetry.MetricsAddr == "" {
+		c.Telemetry.MetricsAddr = Defaults.Telemetry.MetricsAddr
+	}
+}
+
+// Validate returns every reason the configuration cannot be used, or nil if it can.
+func (c *Config) Validate() error {
+	errs := []error{}
+
+	addrs := []struct {
+		name, addr string
+		optional   bool
+	}{
+		{"listen.http", c.Listen.HTTP, false},
+		{"listen.http3", c.Listen.HTTP3, true},
+		{"listen.admin", c.Listen.Admin, false},
+		{"telemetry.metrics_addr", c.Telemetry.MetricsAddr, false},
+	}
+
+	for _, a := range addrs {
+		if a.addr == "" && a.optional {
+			continue
+		}
+
+		if _, _, err := net.SplitHostPort(a.addr); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", a.name, err))
+		}
+	}
+
+	known := map[string]bool{}
+	for _, s := range carriers.Simulations() {
+		known[s.Name] = true
+	}
+
+	seen := map[string]bool{}
+	for i, ca := range c.Carriers {
+		switch {
+		case !known[ca.Name]:
+			errs = append(errs, fmt.Errorf("carriers[%d]: unknown provider %q", i, ca.Name))
+		case seen[ca.Name]:
+			errs = append(errs, fmt.Errorf("carriers[%d]: provider %q is listed more than once", i, ca.Name))
+		}
+
+		seen[ca.Name] = true
+
+		if (ca.Base != nil && *ca.Base < 0) || (ca.PerKg != nil && *ca.PerKg < 0) {
+			errs = append(errs, fmt.Errorf("carriers[%d]: costs cannot be negative", i))
+		}
+
+		if ca.Latency != nil && *ca.Latency < 0 {
+			errs = append(errs, fmt.Errorf("carriers[%d]: latency cannot be negative", i))
+		}
+
+		if ca.FailureRate != nil && (*ca.FailureRate < 0 || *ca.FailureRate > 1) {
+			errs = append(errs, fmt.Errorf("carriers[%d]: failure_rate must be between 0 and 1", i))
+		}
+
+		if ca.Limit != nil {
+			l := ca.quota()
+			if err := l.Validate(); err != nil {
+				errs = append(errs, fmt.Errorf("carriers[%d]: limit: %w", i, err))
+			}
+		}
+	}
+
+	if c.Timeouts.Carrier < 0 || c.Timeouts.Lifecycle < 0 {
+		errs = append(errs, errors.New("timeouts cannot be negative"))
+	}
+
+	for i := range c.Pricing {
+		if err := c.Pricing[i].Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("pricing[%d]: %w", i, err))
+		}
+	}
+
+	// Only the clients of an experiment are offered its carriers, so they must be live; not disabled or a shadow.
+	live := map[string]bool{}
+	for _, ca := range c.Carriers {
+		live[ca.Name] = !ca.Disabled && !ca.Shadow
+	}
+
+	names := map[string]bool{}
+	for i, e := range c.Experiments {
+		if err := e.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("experiments[%d]: %w", i, err))
+		}
+
+		if names[e.Name] {
+			errs = append(errs, fmt.Errorf("experiments[%d]: experiment %q is defined more than once", i, e.Name))
+		}
+
+		names[e.Name] = true
+
+		for _, ca := range e.Carriers {
+			if !live[ca] {
+				errs = append(errs, fmt.Errorf("experiments[%d]: provider %q is not a live carrier", i, ca))
+			}
+		}
+	}
+
+	if _, err := c.LogLevel(); err != nil {
+		errs = append(errs, fmt.Errorf("telemetry.log_level: %w", err))
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %w", ErrInvalidConfig, errors.Join(errs...))
+}
+
+// LogLevel returns the level of Telemetry.LogLevel.
+func (c *Config) LogLevel() (slog.Level, error) {
+	var l slog.Level
+	err := l.UnmarshalText([]byte(c.Telemetry.LogLevel))
+
+	return l, err
+}
+
+// Simulations returns the simulated providers that are enabled (and not shadows), in the order they are listed, changed
+// as configured.
+func (c *Config) Simulations(sims []*carriers.Simulated) []*carriers.Simulated {
+	return c.simulations(sims, false)
+}
+
+// Shadows returns the simulated providers that are enabled as shadows, as in Simulations.
+func (c *Config) Shadows(sims []*carriers.Simulated) []*carriers.Simulated {
+	return c.simulations(sims, true)
+}
+
+func (c *Config) simulations(sims []*carriers.Simulated, shadow bool) []*carriers.Simulated {
+	byName := map[string]*carriers.Simulated{}
+	for _, s := range sims {
+		byName[s.Name] = s
+	}
+
+	out := []*carriers.Simulated{}
+	for _, ca := range c.Carriers {
+		s, ok := byName[ca.Name]
+		if !ok || ca.Disabled || ca.Shadow != shadow {
+			continue
+		}
+
+		if ca.Base != nil {
+			s.Base = *ca.Base
+		}
+
+		if ca.PerKg != nil {
+			s.PerKg = *ca.PerKg
+		}
+
+		if ca.Latency != nil {
+			s.Latency = time.Duration(*ca.Latency)
+		}
+
+		if ca.FailureRate != nil {
+			s.FailureRate = *ca.FailureRate
+		}
+
+		out = append(out, s)
+	}
+
+	return out
+}
+
+// Limits returns the limits of the providers that have them.
+func (c *Config) Limits() []quota.Limit {
+	limits := []quota.Limit{}
+	for _, ca := range c.Carriers {
+		if ca.Limit != nil {
+			limits = append(limits, ca.quota())
+		}
+	}
+
+	return limits
+}
+
+func (ca *Carrier) quota() quota.Limit {
+	return quota.Limit{
+		Provider: ca.Name,
+		Rate:     ca.Limit.Rate,
+		Burst:    ca.Limit.Burst,
+		Daily:    ca.Limit.Daily,
+		Queue:    time.Duration(ca.Limit.Queue),
+	}
+}
+
+// Duration is a time.Duration that is written as a string, such as "1.5s".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(v)
+
+	return nil
+}
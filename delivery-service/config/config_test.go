@@ -0,0 +1,155 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/experiments"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/pricing"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		change func(c *Config)
+
+		// want are what the error is expected to contain; if none, the configuration is expected to be valid.
+		want []string
+	}{
+		{
+			name:   "defaults",
+			change: func(c *Config) {},
+		},
+		{
+			name: "every setting",
+			change: func(c *Config) {
+				c.Listen.HTTP3 = "localhost:9093"
+				c.Carriers = []Carrier{
+					{Name: "svx", Base: ptr(int64(0)), Latency: ptr(Duration(time.Second)), FailureRate: ptr(1.0)},
+					{Name: "mmc", Shadow: true, Limit: &Limit{Rate: 1, Burst: 2, Daily: 100, Queue: Duration(time.Second)}},
+					{Name: "hid", Disabled: true},
+				}
+				c.Pricing = pricing.Rules{{Provider: "svx", Markup: -500}}
+				c.Experiments = []experiments.Experiment{{Name: "svx", Percentage: 100, Carriers: []string{"svx"}}}
+				c.Telemetry.LogLevel = "debug"
+			},
+		},
+		{
+			name:   "address without a port",
+			change: func(c *Config) { c.Listen.HTTP = "localhost" },
+			want:   []string{"listen.http: "},
+		},
+		{
+			name:   "empty address",
+			change: func(c *Config) { c.Telemetry.MetricsAddr = "" },
+			want:   []string{"telemetry.metrics_addr: "},
+		},
+		{
+			name:   "unknown provider",
+			change: func(c *Config) { c.Carriers = []Carrier{{Name: "xyz"}} },
+			want:   []string{`carriers[0]: unknown provider "xyz"`},
+		},
+		{
+			name:   "provider listed twice",
+			change: func(c *Config) { c.Carriers = []Carrier{{Name: "svx"}, {Name: "mmc"}, {Name: "svx", Shadow: true}} },
+			want:   []string{`carriers[2]: provider "svx" is listed more than once`},
+		},
+		{
+			name:   "negative cost",
+			change: func(c *Config) { c.Carriers = []Carrier{{Name: "svx", PerKg: ptr(int64(-1))}} },
+			want:   []string{"carriers[0]: costs cannot be negative"},
+		},
+		{
+			name:   "negative latency",
+			change: func(c *Config) { c.Carriers = []Carrier{{Name: "svx", Latency: ptr(Duration(-time.Second))}} },
+			want:   []string{"carriers[0]: latency cannot be negative"},
+		},
+		{
+			name:   "failure rate above 1",
+			change: func(c *Config) { c.Carriers = []Carrier{{Name: "svx", FailureRate: ptr(1.5)}} },
+			want:   []string{"carriers[0]: failure_rate must be between 0 and 1"},
+		},
+		{
+			name:   "negative limit",
+			change: func(c *Config) { c.Carriers = []Carrier{{Name: "svx", Limit: &Limit{Daily: -1}}} },
+			want:   []string{"carriers[0]: limit: "},
+		},
+		{
+			name:   "negative timeout",
+			change: func(c *Config) { c.Timeouts.Lifecycle = Duration(-time.Second) },
+			want:   []string{"timeouts cannot be negative"},
+		},
+		{
+			name:   "markup that leaves nothing",
+			change: func(c *Config) { c.Pricing = pricing.Rules{{}, {Markup: -10_000}} },
+			want:   []string{"pricing[1]: "},
+		},
+		{
+			name:   "invalid experiment",
+			change: func(c *Config) { c.Experiments = []experiments.Experiment{{Name: "more", Percentage: 101}} },
+			want:   []string{"experiments[0]: "},
+		},
+		{
+			name: "experiment defined twice",
+			change: func(c *Config) {
+				c.Experiments = []experiments.Experiment{{Name: "more", Percentage: 10}, {Name: "more", Percentage: 20}}
+			},
+			want: []string{`experiments[1]: experiment "more" is defined more than once`},
+		},
+		{
+			name: "experiment of a shadow",
+			change: func(c *Config) {
+				c.Carriers = []Carrier{{Name: "svx"}, {Name: "mmc", Shadow: true}, {Name: "hid", Disabled: true}}
+				c.Experiments = []experiments.Experiment{{Name: "more", Percentage: 10, Carriers: []string{"mmc", "hid", "svx"}}}
+			},
+			want: []string{
+				`experiments[0]: provider "mmc" is not a live carrier`,
+				`experiments[0]: provider "hid" is not a live carrier`,
+			},
+		},
+		{
+			name:   "unknown log level",
+			change: func(c *Config) { c.Telemetry.LogLevel = "loud" },
+			want:   []string{"telemetry.log_level: "},
+		},
+		{
+			name: "every reason",
+			change: func(c *Config) {
+				c.Listen.Admin = "admin"
+				c.Carriers = []Carrier{{Name: "xyz"}}
+				c.Telemetry.LogLevel = "loud"
+			},
+			want: []string{"listen.admin: ", `carriers[0]: unknown provider "xyz"`, "telemetry.log_level: "},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := New()
+			tc.change(c)
+
+			err := c.Validate()
+			if len(tc.want) == 0 {
+				if err != nil {
+					t.Fatalf("expected the configuration to be valid, got %v", err)
+				}
+
+				return
+			}
+
+			if !errors.Is(err, ErrInvalidConfig) {
+				t.Fatalf("expected %v, got %v", ErrInvalidConfig, err)
+			}
+
+			for _, w := range tc.want {
+				if !strings.Contains(err.Error(), w) {
+					t.Errorf("expected the error to contain %q, got %q", w, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+// restart are the paths of the settings that can only be changed with a restart. Changes to any setting within them
+// are reported, but do not take effect until then.
+var restart = []string{"listen.", "timeouts.lifecycle", "telemetry.metrics_addr"}
+
+// Change is a single setting that differs between two configurations.
+type Change struct {
+	// Path identifies the setting, such as "timeouts.carrier". Carriers are identified by name, such as
+	// "carriers.svx.failure_rate", and pricing rules by their position, such as "pricing.0.markup". The order of the
+	// carriers is the setting "carriers", as a list of their names.
+	Path string
+
+	// From and To are the values before and after. A setting that was added has no From, and one that was removed
+	// no To.
+	From, To any
+}
+
+// RequiresRestart returns whether the change only takes effect once the service is restarted.
+func (c Change) RequiresRestart() bool {
+	for _, p := range restart {
+		if strings.HasPrefix(c.Path, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// LogValue logs the change as a group of its values.
+func (c Change) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Any("from", c.From),
+		slog.Any("to", c.To),
+		slog.Bool("requires_restart", c.RequiresRestart()),
+	)
+}
+
+// Diff returns the settings that differ between the configurations, ordered by path.
+func Diff(from, to *Config) ([]Change, error) {
+	a, err := flatten(from)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := flatten(to)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []Change{}
+	for p, v := range a {
+		if w, ok := b[p]; !ok || fmt.Sprint(v) != fmt.Sprint(w) {
+			changes = append(changes, Change{Path: p, From: v, To: b[p]})
+		}
+	}
+
+	for p, w := range b {
+		if _, ok := a[p]; !ok {
+			changes = append(changes, Change{Path: p, To: w})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+
+	return changes, nil
+}
+
+// Attrs returns the changes as attributes for a log, each keyed by its path.
+func Attrs(changes []Change) []any {
+	attrs := make([]any, 0, len(changes))
+	for _, c := range changes {
+		attrs = append(attrs, slog.Any(c.Path, c))
+	}
+
+	return attrs
+}
+
+// flatten returns every setting of the configuration, keyed by its path.
+func flatten(c *Config) (map[string]any, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+
+	out := map[string]any{}
+	walk("", v, out)
+
+	return out, nil
+}
+
+func walk(prefix string, v any, out map[string]any) {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			walk(join(prefix, k), e, out)
+		}
+	case []any:
+		// Empty lists are kept, such that they can be told apart from missing ones.
+		if len(v) == 0 {
+			out[prefix] = v
+		}
+
+		names := []string{}
+		for i, e := range v {
+			// Elements with a name (such as carriers) are identified by it, such that reordering them is not a change
+			// to every setting.
+			key := fmt.Sprint(i)
+			if m, ok := e.(map[string]any); ok {
+				if n, ok := m["name"].(string); ok {
+					key = n
+					names = append(names, n)
+				}
+			}
+
+			walk(join(prefix, key), e, out)
+		}
+
+		// The order of named elements matters too (carriers are queried, and their options returned, in order), so it
+		// is kept as the value of the list itself.
+		if len(names) > 0 {
+			out[prefix] = names
+		}
+	default:
+		out[prefix] = v
+	}
+}
+
+func join(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+
+	return prefix + "." + key
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	// with returns the defaults, querying the carriers.
+	with := func(cs ...Carrier) *Config {
+		c := New()
+		c.Carriers = cs
+
+		return c
+	}
+
+	svx, mmc, hid := Carrier{Name: "svx"}, Carrier{Name: "mmc"}, Carrier{Name: "hid"}
+
+	for _, tc := range []struct {
+		name     string
+		from, to *Config
+		want     []Change
+	}{
+		{
+			name: "nothing",
+			from: with(svx, mmc),
+			to:   with(svx, mmc),
+			want: []Change{},
+		},
+		{
+			name: "carrier added",
+			from: with(svx, mmc),
+			to:   with(svx, mmc, hid),
+			want: []Change{
+				{Path: "carriers", From: []string{"svx", "mmc"}, To: []string{"svx", "mmc", "hid"}},
+				{Path: "carriers.hid.name", To: "hid"},
+			},
+		},
+		{
+			name: "carrier removed",
+			from: with(svx, mmc, Carrier{Name: "hid", FailureRate: ptr(0.5)}),
+			to:   with(svx, mmc),
+			want: []Change{
+				{Path: "carriers", From: []string{"svx", "mmc", "hid"}, To: []string{"svx", "mmc"}},
+				{Path: "carriers.hid.failure_rate", From: 0.5},
+				{Path: "carriers.hid.name", From: "hid"},
+			},
+		},
+		{
+			name: "carriers reordered",
+			from: with(svx, mmc, Carrier{Name: "hid", Shadow: true}),
+			to:   with(Carrier{Name: "hid", Shadow: true}, svx, mmc),
+			want: []Change{
+				{Path: "carriers", From: []string{"svx", "mmc", "hid"}, To: []string{"hid", "svx", "mmc"}},
+			},
+		},
+		{
+			name: "carrier disabled",
+			from: with(svx, mmc),
+			to:   with(svx, Carrier{Name: "mmc", Disabled: true}),
+			want: []Change{
+				{Path: "carriers.mmc.disabled", To: true},
+			},
+		},
+		{
+			name: "carrier no longer a shadow",
+			from: with(svx, Carrier{Name: "mmc", Shadow: true}),
+			to:   with(svx, mmc),
+			want: []Change{
+				{Path: "carriers.mmc.shadow", From: true},
+			},
+		},
+		{
+			name: "limit changed",
+			from: with(Carrier{Name: "svx", Limit: &Limit{Rate: 1, Queue: Duration(time.Second)}}, mmc),
+			to: with(
+				Carrier{Name: "svx", Limit: &Limit{Rate: 2, Daily: 100, Queue: Duration(time.Second)}},
+				Carrier{Name: "mmc", Limit: &Limit{Rate: 1}},
+			),
+			want: []Change{
+				{Path: "carriers.mmc.limit.rate", To: 1.0},
+				{Path: "carriers.svx.limit.daily", To: 100.0},
+				{Path: "carriers.svx.limit.rate", From: 1.0, To: 2.0},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Diff(tc.from, tc.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRequiresRestart(t *testing.T) {
+	from, to := New(), New()
+	to.Listen.HTTP = "localhost:8080"
+	to.Timeouts.Carrier = Duration(time.Second)
+	to.Timeouts.Lifecycle = Duration(time.Minute)
+
+	got, err := Diff(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]bool{"listen.http": true, "timeouts.carrier": false, "timeouts.lifecycle": true}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d changes, got %v", len(want), got)
+	}
+
+	for _, c := range got {
+		if c.RequiresRestart() != want[c.Path] {
+			t.Errorf("%s: expected requires restart to be %v, got %v", c.Path, want[c.Path], c.RequiresRestart())
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// EnvPrefix is the prefix of the environment variables that configure the service. See Env.
+const EnvPrefix = "DELIVERY_"
+
+// Source is where the value of a setting came from. Each source takes precedence over those before it.
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceEnv     Source = "env"
+	SourceFlag    Source = "flag"
+)
+
+// Layer is a set of values, keyed by the path of their setting (such as "timeouts.carrier"), from a single source.
+type Layer struct {
+	Source Source
+	Values map[string]string
+}
+
+// setting is a single value that can be set by a layer. Lists (carriers, pricing and experiments) are set as a whole,
+// as JSON.
+type setting struct {
+	path string
+	set  func(c *Config, v string) error
+}
+
+var settings = []setting{
+	{"listen.http", func(c *Config, v string) error { c.Listen.HTTP = v; return nil }},
+	{"listen.http3", func(c *Config, v string) error { c.Listen.HTTP3 = v; return nil }},
+	{"listen.admin", func(c *Config, v string) error { c.Listen.Admin = v; return nil }},
+	{"carriers", func(c *Config, v string) error { c.Carriers = nil; return json.Unmarshal([]byte(v), &c.Carriers) }},
+	{"timeouts.carrier", func(c *Config, v string) error { return setDuration(&c.Timeouts.Carrier, v) }},
+	{"timeouts.lifecycle", func(c *Config, v string) error { return setDuration(&c.Timeouts.Lifecycle, v) }},
+	{"pricing", func(c *Config, v string) error { c.Pricing = nil; return json.Unmarshal([]byte(v), &c.Pricing) }},
+	{"experiments", func(c *Config, v string) error { c.Experiments = nil; return json.Unmarshal([]byte(v), &c.Experiments) }},
+	{"telemetry.log_level", func(c *Config, v string) error { c.Telemetry.LogLevel = v; return nil }},
+	{"telemetry.metrics_addr", func(c *Config, v string) error { c.Telemetry.MetricsAddr = v; return nil }},
+}
+
+// Settings returns the paths of every setting a layer can set.
+func Settings() []string {
+	paths := make([]string, 0, len(settings))
+	for _, s := range settings {
+		paths = append(paths, s.path)
+	}
+
+	return paths
+}
+
+// EnvName returns the environment variable for the setting; for example, DELIVERY_TIMEOUTS_CARRIER for
+// "timeouts.carrier".
+func EnvName(path string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(path, ".", "_"))
+}
+
+// Env returns the layer of the environment variables (formatted as by os.Environ) that configure the service.
+// Variables that are empty are ignored.
+func Env(environ []string) Layer {
+	names := map[string]string{}
+	for _, s := range settings {
+		names[EnvName(s.path)] = s.path
+	}
+
+	l := Layer{Source: SourceEnv, Values: map[string]string{}}
+	for _, kv := range environ {
+		k, v, _ := strings.Cut(kv, "=")
+		if p, ok := names[k]; ok && v != "" {
+			l.Values[p] = v
+		}
+	}
+
+	return l
+}
+
+// Source returns where the setting (or the setting it is within, such as "carriers" for "carriers.svx.latency") came
+// from.
+func (c *Config) Source(path string) Source {
+	for p := path; p != ""; {
+		if s, ok := c.sources[p]; ok {
+			return s
+		}
+
+		i := strings.LastIndex(p, ".")
+		if i < 0 {
+			break
+		}
+
+		p = p[:i]
+	}
+
+	return SourceDefault
+}
+
+// Values returns every value of the configuration, keyed by its path; as in Change.
+func (c *Config) Values() (map[string]any, error) {
+	return flatten(c)
+}
+
+// Paths returns the paths of Values, ordered.
+func Paths(values map[string]any) []string {
+	paths := make([]string, 0, len(values))
+	for p := range values {
+		paths = append(paths, p)
+	}
+
+	sort.Strings(paths)
+
+	return paths
+}
+
+// apply sets the values of the layer, recording it as their source.
+func (c *Config) apply(l Layer) error {
+	for _, s := range settings {
+		v, ok := l.Values[s.path]
+		if !ok {
+			continue
+		}
+
+		if err := s.set(c, v); err != nil {
+			return fmt.Errorf("%w: %s (from %s): %s", ErrFailedToLoad, s.path, l.Source, err)
+		}
+
+		c.sources[s.path] = l.Source
+	}
+
+	return nil
+}
+
+// fromFile records the file as the source of the settings it contains.
+func (c *Config) fromFile(raw map[string]any) {
+	for _, s := range settings {
+		var v any = raw
+		for _, k := range strings.Split(s.path, ".") {
+			m, ok := v.(map[string]any)
+			if !ok {
+				v = nil
+				break
+			}
+
+			v = m[k]
+		}
+
+		if v != nil {
+			c.sources[s.path] = SourceFile
+		}
+	}
+}
+
+func setDuration(d *Duration, v string) error {
+	p, err := time.ParseDuration(v)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(p)
+
+	return nil
+}
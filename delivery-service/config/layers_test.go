@@ -0,0 +1,146 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// write writes the configuration to a file, returning its path.
+func write(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	path := write(t, `{
+		"listen": {"http": "file:1", "admin": "file:2"},
+		"carriers": [{"name": "svx"}, {"name": "mmc"}],
+		"timeouts": {"carrier": "1s", "lifecycle": "1m"}
+	}`)
+
+	env := Env([]string{
+		"DELIVERY_LISTEN_HTTP=env:1",
+		"DELIVERY_LISTEN_ADMIN=env:2",
+		`DELIVERY_CARRIERS=[{"name": "hid", "latency": "50ms"}]`,
+
+		// Variables that are empty, not a setting, or without the prefix are ignored.
+		"DELIVERY_LISTEN_HTTP3=",
+		"DELIVERY_TIMEOUTS=2s",
+		"TIMEOUTS_CARRIER=2s",
+	})
+
+	flags := Layer{Source: SourceFlag, Values: map[string]string{
+		"listen.http":            "flag:1",
+		"timeouts.lifecycle":     "2m",
+		"telemetry.metrics_addr": "flag:3",
+	}}
+
+	c, err := Load(path, env, flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		path   string
+		got    any
+		want   any
+		source Source
+	}{
+		// Set by every layer, so taken from the flag.
+		{"listen.http", c.Listen.HTTP, "flag:1", SourceFlag},
+
+		// Set by the file and the environment, but no flag.
+		{"listen.admin", c.Listen.Admin, "env:2", SourceEnv},
+		{"carriers", len(c.Carriers), 1, SourceEnv},
+		{"carriers.hid.latency", *c.Carriers[0].Latency, Duration(50 * time.Millisecond), SourceEnv},
+
+		// Set by the file and a flag.
+		{"timeouts.lifecycle", c.Timeouts.Lifecycle, Duration(2 * time.Minute), SourceFlag},
+
+		// Set by the file alone.
+		{"timeouts.carrier", c.Timeouts.Carrier, Duration(time.Second), SourceFile},
+
+		// Set by a flag alone.
+		{"telemetry.metrics_addr", c.Telemetry.MetricsAddr, "flag:3", SourceFlag},
+
+		// Set by nothing, so the default.
+		{"listen.http3", c.Listen.HTTP3, "", SourceDefault},
+		{"telemetry.log_level", c.Telemetry.LogLevel, Defaults.Telemetry.LogLevel, SourceDefault},
+		{"pricing", len(c.Pricing), 0, SourceDefault},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%s: expected %v, got %v", tc.path, tc.want, tc.got)
+		}
+
+		if s := c.Source(tc.path); s != tc.source {
+			t.Errorf("%s: expected the source to be %s, got %s", tc.path, tc.source, s)
+		}
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	c, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Listen != Defaults.Listen || c.Timeouts != Defaults.Timeouts || c.Telemetry != Defaults.Telemetry {
+		t.Errorf("expected %+v, got %+v", Defaults, c)
+	}
+
+	values, err := c.Values()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range Paths(values) {
+		if s := c.Source(p); s != SourceDefault {
+			t.Errorf("%s: expected the source to be %s, got %s", p, SourceDefault, s)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		file   string
+		layers []Layer
+	}{
+		{
+			name: "unknown field in the file",
+			file: `{"timeouts": {"carriers": "1s"}}`,
+		},
+		{
+			name: "duration in the file",
+			file: `{"timeouts": {"carrier": "soon"}}`,
+		},
+		{
+			name:   "duration in the environment",
+			layers: []Layer{Env([]string{"DELIVERY_TIMEOUTS_CARRIER=soon"})},
+		},
+		{
+			name:   "list from a flag",
+			layers: []Layer{{Source: SourceFlag, Values: map[string]string{"carriers": "svx"}}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := ""
+			if tc.file != "" {
+				path = write(t, tc.file)
+			}
+
+			if _, err := Load(path, tc.layers...); !errors.Is(err, ErrFailedToLoad) {
+				t.Errorf("expected %v, got %v", ErrFailedToLoad, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,306 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+// DefaultSubject is the subject events are published to on a broker, unless another is supplied.
+const DefaultSubject = "delivery-options.quotes"
+
+// BufferSize is the number of batches of events that can wait to be sent to the broker. Once it is full, further
+// events are dropped (and counted in events.dropped) rather than slowing down the requests that publish them.
+const BufferSize = 1024
+
+// timeout is how long connecting to the broker, and each write to it, can take.
+const timeout = 5 * time.Second
+
+// Broker is a publisher that sends events to a message broker speaking the NATS client protocol, such as a
+// nats-server started locally with:
+//
+//	docker run -p 4222:4222 nats
+//
+// The protocol is simple enough (lines of text over TCP) that it is implemented here, rather than adding a client
+// library. Only publishing is supported.
+//
+// Events are not sent as they are published, but buffered and sent in the background; such that a broker that is slow
+// (or has gone away) does not slow down the requests. Events that cannot be buffered, or sent, are dropped.
+//
+// See
+// 1. https://docs.nats.io/reference/reference-protocols/nats-protocol
+type Broker struct {
+	addr    string
+	subject string
+
+	opts struct {
+		m metric.Meter
+	}
+
+	metrics struct {
+		dropped metric.Int64Counter
+	}
+
+	// queue holds the batches waiting to be sent, until the broker is closed.
+	mu     sync.RWMutex
+	queue  chan batch
+	closed bool
+
+	// drained is closed once everything left in the queue has been sent (or dropped) after closing.
+	drained chan struct{}
+
+	// conn is written to both when sending, and when answering the broker; wmu serialises the writes.
+	wmu  sync.Mutex
+	conn net.Conn
+}
+
+// batch is the events of a single call to Publish, encoded as they are sent.
+type batch struct {
+	msg    []byte
+	events int
+}
+
+// Option modifies the broker as it is dialled.
+type Option func(b *Broker) error
+
+var Defaults = []Option{
+	WithMeter(otel.Meter("github.com/andrewhowdencom/courses.pito/delivery-service/events")),
+}
+
+// WithMeter applies a specific meter provider to the broker. Used mostly in testing.
+func WithMeter(m metric.Meter) Option {
+	return func(b *Broker) error {
+		b.opts.m = m
+
+		return nil
+	}
+}
+
+// DialBroker connects to the broker at the address (for example, "localhost:4222"). Events are published to the
+// subject. As with the carriers, the default options should be extended when this function is used.
+func DialBroker(addr, subject string, opts ...Option) (*Broker, error) {
+	b := &Broker{
+		addr:    addr,
+		subject: subject,
+		queue:   make(chan batch, BufferSize),
+		drained: make(chan struct{}),
+	}
+
+	for _, o := range opts {
+		if err := o(b); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrFailedToOpen, err)
+		}
+	}
+
+	// If there is no meter, add one so we're safe.
+	if b.opts.m == nil {
+		b.opts.m = noop.NewMeterProvider().Meter("noop")
+	}
+
+	var err error
+	if b.metrics.dropped, err = b.opts.m.Int64Counter(
+		"events.dropped",
+		metric.WithDescription("Events that were never published to the broker, by reason (full or failed)"),
+	); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFailedToOpen, err)
+	}
+
+	b.wmu.Lock()
+	err = b.connect()
+	b.wmu.Unlock()
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFailedToOpen, err)
+	}
+
+	go b.drain()
+
+	return b, nil
+}
+
+// Publish queues the events to be sent to the broker. It does not wait for them to be sent; an error is only returned
+// if they could not be queued.
+func (b *Broker) Publish(ctx context.Context, events ...*Quote) error {
+	msg := []byte{}
+	for _, e := range events {
+		payload, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrFailedToPublish, err)
+		}
+
+		msg = append(msg, fmt.Sprintf("PUB %s %d\r\n", b.subject, len(payload))...)
+		msg = append(append(msg, payload...), "\r\n"...)
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.closed {
+		return fmt.Errorf("%w: broker is closed", ErrFailedToPublish)
+	}
+
+	select {
+	case b.queue <- batch{msg: msg, events: len(events)}:
+		return nil
+	default:
+		b.metrics.dropped.Add(ctx, int64(len(events)), metric.WithAttributes(attribute.String("reason", "full")))
+
+		return fmt.Errorf("%w: buffer of %d batches is full", ErrFailedToPublish, BufferSize)
+	}
+}
+
+// drain sends what is queued to the broker, until the queue is closed.
+func (b *Broker) drain() {
+	defer close(b.drained)
+
+	for bt := range b.queue {
+		// Hint: The error is only counted. Should the events be retried?
+		if err := b.send(bt.msg); err != nil {
+			b.metrics.dropped.Add(context.Background(), int64(bt.events), metric.WithAttributes(attribute.String("reason", "failed")))
+		}
+	}
+
+	b.wmu.Lock()
+	defer b.wmu.Unlock()
+
+	if b.conn != nil {
+		b.conn.Close()
+		b.conn = nil
+	}
+}
+
+// send writes the message to the broker. If the broker went away, it tries to reconnect once before giving up; unless
+// the broker is being closed, such that closing does not wait for a broker that is gone.
+func (b *Broker) send(msg []byte) error {
+	b.mu.RLock()
+	closed := b.closed
+	b.mu.RUnlock()
+
+	b.wmu.Lock()
+	defer b.wmu.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		if b.conn == nil {
+			if closed {
+				return errors.New("not connected")
+			}
+
+			if err := b.connect(); err != nil {
+				return err
+			}
+		}
+
+		b.conn.SetWriteDeadline(time.Now().Add(timeout))
+
+		_, err := b.conn.Write(msg)
+		if err == nil {
+			return nil
+		}
+
+		b.conn.Close()
+		b.conn = nil
+
+		if attempt > 0 {
+			return err
+		}
+	}
+}
+
+// Close stops accepting events, and waits for those already queued to be sent (or dropped).
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+
+	b.closed = true
+	close(b.queue)
+	b.mu.Unlock()
+
+	<-b.drained
+
+	return nil
+}
+
+// connect opens the connection, and completes the handshake. The write lock (wmu) must be held.
+func (b *Broker) connect() error {
+	conn, err := net.DialTimeout("tcp", b.addr, timeout)
+	if err != nil {
+		return err
+	}
+
+	// The broker introduces itself with an INFO line, to which we reply with our own options.
+	r := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(timeout))
+
+	line, err := r.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	if !strings.HasPrefix(line, "INFO ") {
+		conn.Close()
+		return fmt.Errorf("unexpected greeting from broker: %q", strings.TrimSpace(line))
+	}
+
+	conn.SetReadDeadline(time.Time{})
+	conn.SetWriteDeadline(time.Now().Add(timeout))
+
+	if _, err := conn.Write([]byte(`CONNECT {"verbose":false,"pedantic":false,"name":"delivery-service"}` + "\r\n")); err != nil {
+		conn.Close()
+		return err
+	}
+
+	b.conn = conn
+	go b.read(conn, r)
+
+	return nil
+}
+
+// read handles what the broker sends until the connection closes. The broker periodically checks we are still there
+// with a PING, and disconnects us unless we reply. Everything else (such as errors) is discarded.
+//
+// Once the connection closes, it is forgotten such that the next send reconnects. Otherwise, the first write after the
+// broker went away would (usually) succeed, and its events be lost without being counted.
+func (b *Broker) read(conn net.Conn, r *bufio.Reader) {
+	defer func() {
+		b.wmu.Lock()
+		defer b.wmu.Unlock()
+
+		if b.conn == conn {
+			b.conn.Close()
+			b.conn = nil
+		}
+	}()
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		if strings.TrimSpace(line) == "PING" {
+			b.wmu.Lock()
+			conn.SetWriteDeadline(time.Now().Add(timeout))
+			_, err = conn.Write([]byte("PONG\r\n"))
+			b.wmu.Unlock()
+
+			if err != nil {
+				return
+			}
+		}
+	}
+}
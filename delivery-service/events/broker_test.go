@@ -0,0 +1,245 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// fakeBroker speaks just enough of the NATS protocol to be published to. Every line (or payload) it reads is sent on
+// lines, prefixed with the number of the connection it was read from.
+type fakeBroker struct {
+	l     net.Listener
+	conns chan net.Conn
+	lines chan string
+}
+
+func newFakeBroker(t *testing.T) *fakeBroker {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fakeBroker{l: l, conns: make(chan net.Conn, 10), lines: make(chan string, 100)}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for n := 1; ; n++ {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			f.conns <- conn
+
+			go f.serve(n, conn)
+		}
+	}()
+
+	return f
+}
+
+func (f *fakeBroker) serve(n int, conn net.Conn) {
+	if _, err := conn.Write([]byte(`INFO {"server_id":"fake"}` + "\r\n")); err != nil {
+		return
+	}
+
+	prefix := strconv.Itoa(n) + ": "
+	r := bufio.NewReader(conn)
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		f.lines <- prefix + line
+
+		// The payload of a message follows its PUB line, and is as long as the PUB line says.
+		if fields := strings.Fields(line); len(fields) == 3 && fields[0] == "PUB" {
+			size, _ := strconv.Atoi(fields[2])
+
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+
+			f.lines <- prefix + string(payload)
+		}
+	}
+}
+
+// next returns the next line read by the broker, or fails the test if there is none.
+func (f *fakeBroker) next(t *testing.T) string {
+	t.Helper()
+
+	select {
+	case line := <-f.lines:
+		return line
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the broker to read a line, but it did not")
+		return ""
+	}
+}
+
+func TestBroker(t *testing.T) {
+	f := newFakeBroker(t)
+
+	b, err := DialBroker(f.l.Addr().String(), "test.quotes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	t.Run("connects", func(t *testing.T) {
+		got := f.next(t)
+		if !strings.HasPrefix(got, "1: CONNECT {") || !strings.HasSuffix(got, "}\r\n") {
+			t.Errorf("expected a CONNECT line, got %q", got)
+		}
+	})
+
+	t.Run("publishes each event as a message", func(t *testing.T) {
+		if err := b.Publish(context.Background(), &Quote{QuoteID: "q-1"}, &Quote{QuoteID: "q-2"}); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, id := range []string{"q-1", "q-2"} {
+			pub := f.next(t)
+			payload := f.next(t)
+
+			q := &Quote{}
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(payload, "1: ")), q); err != nil {
+				t.Fatalf("expected a quote, got %q: %s", payload, err)
+			}
+
+			if want := "1: PUB test.quotes " + strconv.Itoa(len(payload)-len("1: \r\n")) + "\r\n"; pub != want {
+				t.Errorf("expected %q, got %q", want, pub)
+			}
+
+			if q.QuoteID != id || !strings.HasSuffix(payload, "\r\n") {
+				t.Errorf("expected %s, terminated by CRLF, got %q", id, payload)
+			}
+		}
+	})
+
+	t.Run("answers pings", func(t *testing.T) {
+		conn := <-f.conns
+		if _, err := conn.Write([]byte("PING\r\n")); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := f.next(t); got != "1: PONG\r\n" {
+			t.Errorf("expected a PONG, got %q", got)
+		}
+
+		f.conns <- conn
+	})
+
+	t.Run("reconnects once the broker closes the connection", func(t *testing.T) {
+		conn := <-f.conns
+		conn.Close()
+
+		// Wait for the broker to notice.
+		for {
+			b.wmu.Lock()
+			gone := b.conn == nil
+			b.wmu.Unlock()
+
+			if gone {
+				break
+			}
+
+			time.Sleep(time.Millisecond)
+		}
+
+		if err := b.Publish(context.Background(), &Quote{QuoteID: "q-3"}); err != nil {
+			t.Fatal(err)
+		}
+
+		if got := f.next(t); !strings.HasPrefix(got, "2: CONNECT {") {
+			t.Errorf("expected a second connection, got %q", got)
+		}
+
+		if got := f.next(t); !strings.HasPrefix(got, "2: PUB test.quotes ") {
+			t.Errorf("expected the event to be published on the second connection, got %q", got)
+		}
+
+		f.next(t)
+	})
+
+	t.Run("rejects events once closed", func(t *testing.T) {
+		if err := b.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := b.Publish(context.Background(), &Quote{}); !errors.Is(err, ErrFailedToPublish) {
+			t.Errorf("expected %v, got %v", ErrFailedToPublish, err)
+		}
+	})
+}
+
+func TestBrokerDropped(t *testing.T) {
+	f := newFakeBroker(t)
+
+	reader := sdkmetric.NewManualReader()
+	meter := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test")
+
+	b, err := DialBroker(f.l.Addr().String(), DefaultSubject, WithMeter(meter))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	// While the connection is held, nothing can be sent; the queue fills up, and then events are dropped.
+	b.wmu.Lock()
+
+	var dropped int64
+	for i := 0; i < BufferSize+2; i++ {
+		if err := b.Publish(context.Background(), &Quote{}, &Quote{}); err != nil {
+			dropped += 2
+		}
+	}
+
+	b.wmu.Unlock()
+
+	if dropped == 0 {
+		t.Fatalf("expected events to be dropped once %d batches were queued", BufferSize)
+	}
+
+	rm := metricdata.ResourceMetrics{}
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+
+	var counted int64
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "events.dropped" {
+				continue
+			}
+
+			for _, dp := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				if v, _ := dp.Attributes.Value(attribute.Key("reason")); v.AsString() == "full" {
+					counted += dp.Value
+				}
+			}
+		}
+	}
+
+	if counted != dropped {
+		t.Errorf("expected %d events to be counted as dropped, got %d", dropped, counted)
+	}
+}
@@ -0,0 +1,179 @@
+// package events publishes what the service does to an event stream, such that it can be analysed elsewhere (for
+// example, to see which carriers win the most business) without slowing down the requests themselves.
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/carriers"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/money"
+)
+
+var (
+	ErrFailedToOpen    = errors.New("failed to open event stream")
+	ErrFailedToPublish = errors.New("failed to publish event")
+)
+
+// TypeQuote is the type of the event published for every quote that is served to a client.
+const TypeQuote = "delivery-options.quote.served"
+
+// SchemaVersion is the version of the event schema. It is incremented whenever a field is removed or changes meaning;
+// fields may be added without changing it, so consumers should ignore fields they do not know.
+const SchemaVersion = 1
+
+// Quote is the event published for every delivery option that is quoted to a client, after a successful query of the
+// carriers. Each option is a separate event, such that consumers do not need to unpack the response. For example,
+//
+//	{
+//	  "id": "6d1f0d6f6c3b9d8a2f1c0e4b7a9d3e21",
+//	  "type": "delivery-options.quote.served",
+//	  "version": 1,
+//	  "time": "2023-09-09T12:00:00Z",
+//	  "quote_id": "177cc9ae2d3a3344fa50b9294e10e654",
+//	  "provider": "svx",
+//	  "package": {"width": 10, "height": 10, "depth": 10, "weight": 1000},
+//	  "cost": {"total": 590, "currency": "EUR"},
+//	  "arrival": "2023-09-11T18:00:00Z",
+//	  "expires": "2023-09-09T12:15:00Z"
+//	}
+type Quote struct {
+	// ID uniquely identifies the event, such that consumers can discard duplicates.
+	ID string `json:"id"`
+
+	// Type is always TypeQuote, and Version the SchemaVersion the event was written with.
+	Type    string `json:"type"`
+	Version int    `json:"version"`
+
+	// Time is when the quote was served.
+	Time time.Time `json:"time"`
+
+	// QuoteID identifies the quote, such that it can be joined with its booking.
+	QuoteID string `json:"quote_id"`
+
+	Provider string            `json:"provider"`
+	Package  *carriers.Package `json:"package"`
+
+	// Cost is the cost as quoted by the provider, before any conversion into the currency of the client.
+	Cost    *money.Money `json:"cost"`
+	Arrival time.Time    `json:"arrival"`
+	Expires time.Time    `json:"expires"`
+
+	// Mode, Emissions and PickupPointID are only present if the option had them.
+	Mode          carriers.TransportMode `json:"mode,omitempty"`
+	Emissions     *carriers.Emissions    `json:"emissions,omitempty"`
+	PickupPointID string                 `json:"pickup_point_id,omitempty"`
+}
+
+// NewQuote creates the event for an option that was quoted for the package at the supplied time.
+func NewQuote(pkg *carriers.Package, opt *carriers.DeliveryOption, at time.Time) (*Quote, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	// Only the cost as quoted is published; not the version formatted for a specific client.
+	cost := *opt.Cost
+	cost.Display = ""
+
+	q := &Quote{
+		ID:        hex.EncodeToString(id),
+		Type:      TypeQuote,
+		Version:   SchemaVersion,
+		Time:      at.UTC(),
+		QuoteID:   opt.QuoteID,
+		Provider:  opt.Provider,
+		Package:   pkg,
+		Cost:      &cost,
+		Arrival:   opt.Arrival,
+		Expires:   opt.Expires,
+		Mode:      opt.Mode,
+		Emissions: opt.Emissions,
+	}
+
+	if opt.PickupPoint != nil {
+		q.PickupPointID = opt.PickupPoint.ID
+	}
+
+	return q, nil
+}
+
+// Publisher sends events to a stream.
+type Publisher interface {
+	// Publish sends the events. Either all of them are published, or an error is returned; however, some may have been
+	// published before the error occurred.
+	Publish(ctx context.Context, events ...*Quote) error
+
+	// Close releases whatever the publisher holds open.
+	Close() error
+}
+
+// Discard is a publisher that drops every event. It is used when there is nowhere to publish to.
+var Discard Publisher = discard{}
+
+type discard struct{}
+
+func (discard) Publish(context.Context, ...*Quote) error { return nil }
+func (discard) Close() error                             { return nil }
+
+// Memory is a publisher that keeps every event in memory. It is mostly useful in testing, and when exploring the
+// events locally.
+//
+// Hint: Events are never removed, so memory grows with every query.
+type Memory struct {
+	mu     sync.Mutex
+	events []*Quote
+}
+
+func (m *Memory) Publish(_ context.Context, events ...*Quote) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.events = append(m.events, events...)
+
+	return nil
+}
+
+// Events returns every event published so far, oldest first.
+func (m *Memory) Events() []*Quote {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]*Quote{}, m.events...)
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
+
+// Open creates the publisher described by the target, which is one of:
+//
+//   - "" (nothing), to discard events
+//   - "memory", to keep events in memory
+//   - "file:<path>", to append events to a file
+//   - "nats://<host>:<port>[/<subject>]", to publish events to a broker (on DefaultSubject, unless one is supplied)
+func Open(target string) (Publisher, error) {
+	switch {
+	case target == "":
+		return Discard, nil
+	case target == "memory":
+		return &Memory{}, nil
+	case strings.HasPrefix(target, "file:"):
+		return OpenFile(strings.TrimPrefix(target, "file:"))
+	case strings.HasPrefix(target, "nats://"):
+		addr, subject, _ := strings.Cut(strings.TrimPrefix(target, "nats://"), "/")
+		if subject == "" {
+			subject = DefaultSubject
+		}
+
+		return DialBroker(addr, subject, Defaults...)
+	default:
+		return nil, fmt.Errorf("%w: unknown target %q", ErrFailedToOpen, target)
+	}
+}
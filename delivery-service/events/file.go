@@ -0,0 +1,51 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// File is a publisher that appends events to a file, as newline delimited JSON.
+type File struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// OpenFile opens (or creates) the file that events are appended to.
+func OpenFile(path string) (*File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFailedToOpen, err)
+	}
+
+	return &File{f: f}, nil
+}
+
+func (f *File) Publish(_ context.Context, events ...*Quote) error {
+	// Each batch is written at once, such that events from concurrent requests are never interleaved.
+	b := []byte{}
+	for _, e := range events {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrFailedToPublish, err)
+		}
+
+		b = append(append(b, line...), '\n')
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, err := f.f.Write(b); err != nil {
+		return fmt.Errorf("%w: %s", ErrFailedToPublish, err)
+	}
+
+	return nil
+}
+
+func (f *File) Close() error {
+	return f.f.Close()
+}
@@ -0,0 +1,82 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/carriers"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/money"
+)
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	at := time.Date(2023, 9, 9, 12, 0, 0, 0, time.UTC)
+
+	published := []*Quote{}
+	for _, id := range []string{"q-1", "q-2", "q-3"} {
+		q, err := NewQuote(&carriers.Package{Weight: 1000}, &carriers.DeliveryOption{
+			QuoteID:  id,
+			Provider: "svx",
+			Cost:     &money.Money{Total: 590, Currency: "EUR", Display: "€5.90"},
+			Mode:     carriers.ModeRoad,
+		}, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		published = append(published, q)
+	}
+
+	// Events are appended, including to a file that already has events in it.
+	for _, batch := range [][]*Quote{published[:2], published[2:]} {
+		f, err := OpenFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := f.Publish(context.Background(), batch...); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	read := []*Quote{}
+	for sc := bufio.NewScanner(r); sc.Scan(); {
+		q := &Quote{}
+		if err := json.Unmarshal(sc.Bytes(), q); err != nil {
+			t.Fatalf("expected each line to be an event, got %q: %s", sc.Text(), err)
+		}
+
+		read = append(read, q)
+	}
+
+	if len(read) != len(published) {
+		t.Fatalf("expected %d events, got %d", len(published), len(read))
+	}
+
+	for i, q := range read {
+		p := published[i]
+		if q.ID != p.ID || q.QuoteID != p.QuoteID || q.Type != TypeQuote || q.Version != SchemaVersion || !q.Time.Equal(at) || q.Mode != p.Mode {
+			t.Errorf("expected %+v, got %+v", p, q)
+		}
+
+		// Only the cost as quoted is published.
+		if q.Cost.Total != 590 || q.Cost.Display != "" {
+			t.Errorf("expected the cost as quoted, got %+v", q.Cost)
+		}
+	}
+}
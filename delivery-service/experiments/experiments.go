@@ -0,0 +1,295 @@
+// package experiments exposes changes (such as a new carrier, or a different price) to a percentage of clients, such
+// that they can be rolled out gradually and compared with what they replace. Each client is assigned a variant of each
+// experiment by hashing its key, so sees the same variant on every request.
+package experiments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/carriers"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/pricing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+var (
+	ErrFailedToApplyOption   = errors.New("failed to apply option")
+	ErrFailedToCreateMetrics = errors.New("failed to create metric from provider")
+	ErrInvalidExperiment     = errors.New("invalid experiment")
+)
+
+// Variant is the version of an experiment a client sees.
+type Variant string
+
+const (
+	// Control is the variant without the change; what clients see if there is no experiment.
+	Control Variant = "control"
+
+	// Treatment is the variant with the change.
+	Treatment Variant = "treatment"
+)
+
+// Experiment is a change that only the clients assigned the Treatment see.
+type Experiment struct {
+	// Name identifies the experiment in telemetry. Changing it assigns every client again.
+	Name string `json:"name"`
+
+	// Percentage is the share of clients (between 0 and 100) that are assigned the Treatment.
+	Percentage float64 `json:"percentage"`
+
+	// Carriers are the providers only queried for the Treatment. Clients assigned the Control are not offered their
+	// options.
+	Carriers []string `json:"carriers,omitempty"`
+
+	// Pricing are the rules applied for the Treatment, after those that apply to every client.
+	Pricing pricing.Rules `json:"pricing,omitempty"`
+}
+
+// Validate checks the experiment can be assigned.
+func (e *Experiment) Validate() error {
+	if e.Name == "" {
+		return fmt.Errorf("%w: experiments must have a name", ErrInvalidExperiment)
+	}
+
+	if e.Percentage < 0 || e.Percentage > 100 {
+		return fmt.Errorf("%w: %s: percentage must be between 0 and 100", ErrInvalidExperiment, e.Name)
+	}
+
+	for i := range e.Pricing {
+		if err := e.Pricing[i].Validate(); err != nil {
+			return fmt.Errorf("%w: %s: pricing[%d]: %s", ErrInvalidExperiment, e.Name, i, err)
+		}
+	}
+
+	return nil
+}
+
+// Assign returns the variant of the experiment for the client. The same client is always assigned the same variant,
+// and clients are assigned independently for each experiment.
+func (e *Experiment) Assign(client string) Variant {
+	h := fnv.New64a()
+	h.Write([]byte(e.Name + "/" + client))
+
+	// The hash is reduced to hundredths of a percent, such that percentages as small as 0.01 can be rolled out.
+	if float64(h.Sum64()%10_000) < e.Percentage*100 {
+		return Treatment
+	}
+
+	return Control
+}
+
+// Assignments are the variants a client is assigned, keyed by experiment.
+type Assignments map[string]Variant
+
+// Attributes are the assignments as attributes for telemetry, such as "experiment.new-carrier" = "treatment", ordered
+// by experiment.
+func (a Assignments) Attributes() []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, 0, len(a))
+	for name, v := range a {
+		attrs = append(attrs, attribute.String("experiment."+name, string(v)))
+	}
+
+	sort.Slice(attrs, func(i, j int) bool { return attrs[i].Key < attrs[j].Key })
+
+	return attrs
+}
+
+type contextKey struct{}
+
+// NewContext returns a context that carries the assignments, such that the carriers queried with it see the variants
+// of the client (and add them to their telemetry).
+func NewContext(ctx context.Context, a Assignments) context.Context {
+	return context.WithValue(carriers.ContextWithAttributes(ctx, a.Attributes()...), contextKey{}, a)
+}
+
+// FromContext returns the assignments the context carries. Without any, every experiment is the Control.
+func FromContext(ctx context.Context) Assignments {
+	a, _ := ctx.Value(contextKey{}).(Assignments)
+
+	return a
+}
+
+type Option func(s *Set) error
+
+var Defaults = []Option{
+	WithMeter(otel.Meter("github.com/andrewhowdencom/courses.pito/delivery-service/experiments")),
+}
+
+// Set is the experiments that are running.
+type Set struct {
+	opts struct {
+		m metric.Meter
+	}
+
+	metrics struct {
+		requests metric.Int64Counter
+		options  metric.Int64Counter
+		bookings metric.Int64Counter
+	}
+
+	experiments []Experiment
+}
+
+// New creates the set of experiments. As with the carriers, the default options should be extended when this function
+// is used. The experiments are validated.
+func New(experiments []Experiment, opts ...Option) (*Set, error) {
+	s := &Set{experiments: experiments}
+
+	seen := map[string]bool{}
+	for i := range experiments {
+		if err := experiments[i].Validate(); err != nil {
+			return nil, err
+		}
+
+		if seen[experiments[i].Name] {
+			return nil, fmt.Errorf("%w: %s is defined more than once", ErrInvalidExperiment, experiments[i].Name)
+		}
+
+		seen[experiments[i].Name] = true
+	}
+
+	for _, o := range opts {
+		if err := o(s); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrFailedToApplyOption, err)
+		}
+	}
+
+	// If there is no meter, add one so we're safe.
+	if s.opts.m == nil {
+		s.opts.m = noop.NewMeterProvider().Meter("noop")
+	}
+
+	var err error
+	if s.metrics.requests, err = s.opts.m.Int64Counter(
+		"experiment.requests",
+		metric.WithDescription("Requests for delivery options, by experiment and variant"),
+	); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFailedToCreateMetrics, err)
+	}
+
+	if s.metrics.options, err = s.opts.m.Int64Counter(
+		"experiment.options",
+		metric.WithDescription("Delivery options served, by experiment, variant and provider"),
+	); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFailedToCreateMetrics, err)
+	}
+
+	if s.metrics.bookings, err = s.opts.m.Int64Counter(
+		"experiment.bookings",
+		metric.WithDescription("Delivery options booked, by experiment, variant and provider"),
+	); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFailedToCreateMetrics, err)
+	}
+
+	return s, nil
+}
+
+// WithMeter applies a specific meter provider to the set. Used mostly in testing.
+func WithMeter(m metric.Meter) Option {
+	return func(s *Set) error {
+		s.opts.m = m
+
+		return nil
+	}
+}
+
+// Experiments returns the experiments in the set.
+func (s *Set) Experiments() []Experiment {
+	return s.experiments
+}
+
+// Assign returns the variant of every experiment for the client.
+func (s *Set) Assign(client string) Assignments {
+	a := make(Assignments, len(s.experiments))
+	for i := range s.experiments {
+		a[s.experiments[i].Name] = s.experiments[i].Assign(client)
+	}
+
+	return a
+}
+
+// Served records that a client with the assignments requested delivery options, and was served the options.
+func (s *Set) Served(ctx context.Context, a Assignments, opts []*carriers.DeliveryOption) {
+	for name, v := range a {
+		attrs := []attribute.KeyValue{attribute.String("experiment", name), attribute.String("variant", string(v))}
+		s.metrics.requests.Add(ctx, 1, metric.WithAttributes(attrs...))
+
+		for _, o := range opts {
+			s.metrics.options.Add(ctx, 1, metric.WithAttributes(append(attrs, attribute.String("provider", o.Provider))...))
+		}
+	}
+}
+
+// Booked records that a client with the assignments booked the option.
+func (s *Set) Booked(ctx context.Context, a Assignments, opt *carriers.DeliveryOption) {
+	for name, v := range a {
+		s.metrics.bookings.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("experiment", name),
+			attribute.String("variant", string(v)),
+			attribute.String("provider", opt.Provider),
+		))
+	}
+}
+
+// Middleware excludes the carriers of each experiment for clients assigned the Control, and applies the pricing of
+// each experiment for those assigned the Treatment; according to the assignments carried by the context of each query.
+func (s *Set) Middleware() carriers.Middleware {
+	return carriers.Middleware{
+		Name: "experiments",
+		Wrap: func(c carriers.Carrier) carriers.Carrier {
+			return &experimented{Decorator: carriers.Decorator{Carrier: c}, set: s}
+		},
+	}
+}
+
+type experimented struct {
+	carriers.Decorator
+
+	set *Set
+}
+
+func (e *experimented) Query(pkg *carriers.Package) ([]*carriers.DeliveryOption, error) {
+	return e.QueryContext(context.Background(), pkg)
+}
+
+func (e *experimented) QueryContext(ctx context.Context, pkg *carriers.Package) ([]*carriers.DeliveryOption, error) {
+	a := FromContext(ctx)
+	provider := e.ProviderName()
+
+	rules := pricing.Rules{}
+	for _, ex := range e.set.experiments {
+		v := a[ex.Name]
+		if v == "" {
+			v = Control
+		}
+
+		for _, c := range ex.Carriers {
+			if c == provider && v == Control {
+				return nil, fmt.Errorf("%w: only offered to the %s of experiment %s", carriers.ErrExcluded, Treatment, ex.Name)
+			}
+		}
+
+		if v == Treatment {
+			rules = append(rules, ex.Pricing...)
+		}
+	}
+
+	opts, err := e.Decorator.QueryContext(ctx, pkg)
+	if err != nil {
+		return opts, err
+	}
+
+	for _, o := range opts {
+		if err := rules.Apply(o); err != nil {
+			return nil, err
+		}
+	}
+
+	return opts, nil
+}
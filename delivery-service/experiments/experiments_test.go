@@ -0,0 +1,165 @@
+package experiments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/carriers"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/money"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/pricing"
+)
+
+// fake is a carrier that quotes a single option costing €10.00, and counts how often it is queried.
+type fake struct {
+	name    string
+	queries int
+}
+
+func (f *fake) Query(pkg *carriers.Package) ([]*carriers.DeliveryOption, error) {
+	f.queries++
+
+	return []*carriers.DeliveryOption{{Provider: f.name, Cost: &money.Money{Total: 1000, Currency: "EUR"}}}, nil
+}
+
+func (f *fake) ProviderName() string {
+	return f.name
+}
+
+// clients returns n client IDs, as usage.Identify identifies clients without an API key; by their IP address.
+func clients(n int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("ip:10.%d.%d.%d", i>>16, (i>>8)&0xff, i&0xff)
+	}
+
+	return ids
+}
+
+func TestAssignSticky(t *testing.T) {
+	e := Experiment{Name: "new-carrier", Percentage: 50}
+
+	for _, id := range clients(100) {
+		want := e.Assign(id)
+
+		// The same client is assigned the same variant every time, and by every instance of the service.
+		again := Experiment{Name: "new-carrier", Percentage: 50}
+		for i := 0; i < 3; i++ {
+			if got := again.Assign(id); got != want {
+				t.Fatalf("%s: expected %s, got %s", id, want, got)
+			}
+		}
+	}
+}
+
+func TestAssignPercentage(t *testing.T) {
+	ids := clients(20_000)
+
+	for _, pct := range []float64{0, 1, 10, 25, 50, 99.5, 100} {
+		t.Run(fmt.Sprint(pct), func(t *testing.T) {
+			e := Experiment{Name: "new-carrier", Percentage: pct}
+
+			treated := 0
+			for _, id := range ids {
+				if e.Assign(id) == Treatment {
+					treated++
+				}
+			}
+
+			// The hash spreads the clients evenly, so the share treated is within a percentage point.
+			got := 100 * float64(treated) / float64(len(ids))
+			if math.Abs(got-pct) > 1 || (pct == 0 && treated != 0) || (pct == 100 && treated != len(ids)) {
+				t.Errorf("expected %v%% to be treated, got %.2f%%", pct, got)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	e := Experiment{
+		Name:       "new-carrier",
+		Percentage: 50,
+		Carriers:   []string{"new"},
+		Pricing:    pricing.Rules{{Markup: 1_000}},
+	}
+
+	s, err := New([]Experiment{e})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first client assigned each variant.
+	ids := map[Variant]string{}
+	for _, id := range clients(100) {
+		if _, ok := ids[e.Assign(id)]; !ok {
+			ids[e.Assign(id)] = id
+		}
+	}
+
+	for _, tc := range []struct {
+		name string
+		ctx  context.Context
+
+		// carrier is the provider queried; want the cost of its option, or if zero that it is excluded.
+		carrier string
+		want    int64
+	}{
+		{
+			name:    "control of an experimented carrier",
+			ctx:     NewContext(context.Background(), s.Assign(ids[Control])),
+			carrier: "new",
+		},
+		{
+			name:    "no assignments of an experimented carrier",
+			ctx:     context.Background(),
+			carrier: "new",
+		},
+		{
+			name:    "treatment of an experimented carrier",
+			ctx:     NewContext(context.Background(), s.Assign(ids[Treatment])),
+			carrier: "new",
+			want:    1100,
+		},
+		{
+			name:    "control of another carrier",
+			ctx:     NewContext(context.Background(), s.Assign(ids[Control])),
+			carrier: "svx",
+			want:    1000,
+		},
+		{
+			name:    "treatment of another carrier",
+			ctx:     NewContext(context.Background(), s.Assign(ids[Treatment])),
+			carrier: "svx",
+			want:    1100,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := &fake{name: tc.carrier}
+			c := s.Middleware().Wrap(f)
+
+			opts, err := carriers.QueryContext(tc.ctx, c, &carriers.Package{})
+
+			if tc.want == 0 {
+				if !errors.Is(err, carriers.ErrExcluded) {
+					t.Errorf("expected %v, got %v (and %d options)", carriers.ErrExcluded, err, len(opts))
+				}
+
+				if f.queries != 0 {
+					t.Errorf("expected the carrier not to be queried, got %d queries", f.queries)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(opts) != 1 || opts[0].Cost.Total != tc.want {
+				t.Errorf("expected a single option costing %d, got %v", tc.want, opts)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/usage"
+)
+
+// usageExport writes the usage of every client, for a single month, as CSV to stdout. For example,
+//
+//	./delivery-service -usage-db usage.db usage-export 2023-09 > usage-2023-09.csv
+//
+// The database can only be opened by a single process at a time, so the server must be stopped first. It returns the
+// exit code for the process.
+func usageExport(args []string) int {
+	if len(args) != 1 {
+		log.Error("usage-export requires exactly one argument; the month to export, formatted as " + usage.MonthFormat)
+		return 2
+	}
+
+	if *usageDB == "" {
+		log.Error("usage-export requires the usage database to be supplied with -usage-db")
+		return 2
+	}
+
+	from, to, err := usage.Month(args[0])
+	if err != nil {
+		log.Error("failed to parse month", "error", err, "month", args[0])
+		return 2
+	}
+
+	store, err := usage.Open(*usageDB)
+	if err != nil {
+		log.Error("failed to open usage database", "error", err, "path", *usageDB)
+		return 1
+	}
+	defer store.Close()
+
+	rows, err := store.Report(from, to, "")
+	if err != nil {
+		log.Error("failed to read usage", "error", err)
+		return 1
+	}
+
+	if err := usage.WriteCSV(os.Stdout, rows); err != nil {
+		log.Error("failed to write usage", "error", err)
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,126 @@
+// package geo provides (very) approximate locations for postal codes, and the distances between them.
+package geo
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+var (
+	ErrMalformedPostalCode = errors.New("malformed postal code")
+	ErrUnknownPostalCode   = errors.New("unknown postal code")
+)
+
+// postalcodes is a list of the German postal regions ("Leitregionen"; the first two digits of the postal code),
+// along with the coordinates of the largest town in that region. It is accurate to within tens of kilometers, which
+// is enough to estimate distances, but nothing more.
+//
+//go:embed postalcodes.csv
+var postalcodes []byte
+
+// regions is the parsed version of the embedded table, keyed by the two digit prefix.
+var regions map[string]Point
+
+// EarthRadius is the mean radius of the earth, in meters.
+const EarthRadius = 6_371_000
+
+// RoadFactor is the ratio between the distance "as the crow flies" and the distance a vehicle has to travel. Roads
+// are rarely straight.
+//
+// See:
+// 1. https://en.wikipedia.org/wiki/Circuity_factor
+const RoadFactor = 1.3
+
+// LocalDistance is the least distance a package travels, in meters. Postal codes in the same region share a location,
+// but a package sent between them still has to be collected and delivered.
+const LocalDistance = 10_000
+
+// Point is a location on the earth.
+type Point struct {
+	// Latitude and Longitude, in degrees.
+	Latitude, Longitude float64
+
+	// Name is a human readable name for the location.
+	Name string
+}
+
+// Locate finds the approximate location of a five digit (German) postal code, such as "10115".
+func Locate(postalCode string) (Point, error) {
+	if len(postalCode) != 5 {
+		return Point{}, fmt.Errorf("%w: %q", ErrMalformedPostalCode, postalCode)
+	}
+
+	if _, err := strconv.ParseUint(postalCode, 10, 32); err != nil {
+		return Point{}, fmt.Errorf("%w: %q", ErrMalformedPostalCode, postalCode)
+	}
+
+	p, ok := regions[postalCode[:2]]
+	if !ok {
+		return Point{}, fmt.Errorf("%w: %q", ErrUnknownPostalCode, postalCode)
+	}
+
+	return p, nil
+}
+
+// Distance estimates the distance travelled between two postal codes, in meters. It is the great circle distance
+// between both points, adjusted by the RoadFactor, but never less than the LocalDistance.
+func Distance(from, to string) (int64, error) {
+	a, err := Locate(from)
+	if err != nil {
+		return 0, err
+	}
+
+	b, err := Locate(to)
+	if err != nil {
+		return 0, err
+	}
+
+	return max(LocalDistance, int64(a.DistanceTo(b)*RoadFactor)), nil
+}
+
+// DistanceTo is the great circle distance between two points, in meters.
+//
+// See:
+// 1. https://en.wikipedia.org/wiki/Haversine_formula
+func (p Point) DistanceTo(o Point) float64 {
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := rad(o.Latitude - p.Latitude)
+	dLon := rad(o.Longitude - p.Longitude)
+
+	h := math.Pow(math.Sin(dLat/2), 2) +
+		math.Cos(rad(p.Latitude))*math.Cos(rad(o.Latitude))*math.Pow(math.Sin(dLon/2), 2)
+
+	return 2 * EarthRadius * math.Asin(math.Sqrt(h))
+}
+
+func init() {
+	// The table is embedded in the binary, so any failure here is a programming error rather than something that
+	// can be handled at runtime.
+	records, err := csv.NewReader(bytes.NewReader(postalcodes)).ReadAll()
+	if err != nil {
+		panic(fmt.Sprintf("geo: failed to read embedded postal code table: %s", err))
+	}
+
+	regions = make(map[string]Point, len(records))
+
+	// The first record is the header.
+	for _, r := range records[1:] {
+		lat, err := strconv.ParseFloat(r[1], 64)
+		if err != nil {
+			panic(fmt.Sprintf("geo: malformed latitude for %s: %s", r[0], err))
+		}
+
+		lon, err := strconv.ParseFloat(r[2], 64)
+		if err != nil {
+			panic(fmt.Sprintf("geo: malformed longitude for %s: %s", r[0], err))
+		}
+
+		regions[r[0]] = Point{Latitude: lat, Longitude: lon, Name: r[3]}
+	}
+}
@@ -0,0 +1,34 @@
+package geo
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDistance(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		from, to string
+		min, max int64
+		err      error
+	}{
+		{"berlin to munich", "10115", "80331", 600_000, 900_000, nil},
+		{"symmetric", "80331", "10115", 600_000, 900_000, nil},
+		{"same region", "10115", "10117", LocalDistance, LocalDistance, nil},
+		{"same postal code", "10115", "10115", LocalDistance, LocalDistance, nil},
+		{"too short", "1011", "80331", 0, 0, ErrMalformedPostalCode},
+		{"not a number", "80331", "1O115", 0, 0, ErrMalformedPostalCode},
+		{"unknown region", "00000", "80331", 0, 0, ErrUnknownPostalCode},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := Distance(tc.from, tc.to)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+
+			if d < tc.min || d > tc.max {
+				t.Errorf("expected between %d and %d, got %d", tc.min, tc.max, d)
+			}
+		})
+	}
+}
@@ -0,0 +1,327 @@
+// package lifecycle starts and stops the components of the service in order. Each component declares what it depends
+// on; components are started after their dependencies are ready, and stopped before them.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/clock"
+)
+
+var (
+	ErrDuplicateComponent = errors.New("component already registered")
+	ErrUnknownDependency  = errors.New("unknown dependency")
+	ErrDependencyCycle    = errors.New("dependency cycle")
+	ErrFailedToStart      = errors.New("failed to start component")
+	ErrFailedToStop       = errors.New("failed to stop component")
+)
+
+// DefaultTimeout is how long a component has to start, become ready or stop, unless it sets its own.
+const DefaultTimeout = 10 * time.Second
+
+// State is where a component is in its lifecycle.
+type State string
+
+const (
+	StatePending  State = "pending"
+	StateStarting State = "starting"
+	StateReady    State = "ready"
+	StateStopping State = "stopping"
+	StateStopped  State = "stopped"
+	StateFailed   State = "failed"
+)
+
+// Component is a part of the service that needs to be started and stopped. All hooks are optional.
+type Component struct {
+	// Name identifies the component, both in logs and to the components that depend on it.
+	Name string
+
+	// DependsOn are the names of the components that must be ready before this one is started.
+	DependsOn []string
+
+	// Start starts the component. It must not block once the component is running; long running work belongs in a
+	// goroutine.
+	Start func(ctx context.Context) error
+
+	// Ready returns nil once the component is able to do its work. It is called repeatedly after Start, until it
+	// succeeds or the timeout expires.
+	Ready func(ctx context.Context) error
+
+	// Stop stops the component, releasing anything it holds.
+	Stop func(ctx context.Context) error
+
+	// Timeout bounds each of the hooks. If zero, DefaultTimeout is used.
+	Timeout time.Duration
+}
+
+// Status is the state of a single component.
+type Status struct {
+	Name  string `json:"name"`
+	State State  `json:"state"`
+
+	// Error is why the component failed, if it did.
+	Error string `json:"error,omitempty"`
+
+	// Since is when the component entered the state.
+	Since time.Time `json:"since"`
+}
+
+// Manager starts and stops components.
+type Manager struct {
+	log *slog.Logger
+
+	mu         sync.Mutex
+	components []*Component
+	status     map[string]*Status
+
+	// started are the components that have been started, in the order they were started.
+	started []*Component
+
+	// clock is what hooks are timed out, and changes of state recorded, with.
+	clock clock.Clock
+}
+
+// Option modifies the manager as it is created.
+type Option func(m *Manager)
+
+// New creates a manager that logs each change of state to the logger.
+func New(log *slog.Logger, opts ...Option) *Manager {
+	m := &Manager{
+		log:    log,
+		status: make(map[string]*Status),
+	}
+
+	for _, o := range opts {
+		o(m)
+	}
+
+	m.clock = clock.Or(m.clock)
+
+	return m
+}
+
+// WithClock sets the clock that hooks are timed out, and changes of state recorded, with.
+func WithClock(c clock.Clock) Option {
+	return func(m *Manager) {
+		m.clock = c
+	}
+}
+
+// Register adds a component. Components may be registered in any order, as long as all are registered before Start.
+func (m *Manager) Register(c *Component) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.status[c.Name]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateComponent, c.Name)
+	}
+
+	m.components = append(m.components, c)
+	m.status[c.Name] = &Status{Name: c.Name, State: StatePending, Since: m.clock.Now()}
+
+	return nil
+}
+
+// Start starts every component, in dependency order, waiting for each to be ready before starting the next. If any
+// fails, those already started are stopped again and the error returned.
+func (m *Manager) Start(ctx context.Context) error {
+	m.mu.Lock()
+	order, err := m.order()
+	m.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	for _, c := range order {
+		if err := m.start(ctx, c); err != nil {
+			m.set(c.Name, StateFailed, err)
+
+			// Hint: Errors while stopping are logged, but the error that caused them is the one returned.
+			m.Stop(context.Background())
+
+			return fmt.Errorf("%w: %s: %s", ErrFailedToStart, c.Name, err)
+		}
+
+		m.mu.Lock()
+		m.started = append(m.started, c)
+		m.mu.Unlock()
+
+		m.set(c.Name, StateReady, nil)
+	}
+
+	return nil
+}
+
+// Stop stops every started component, in the reverse order to which they were started. Every component is stopped,
+// even if stopping an earlier one fails; the errors are joined together.
+func (m *Manager) Stop(ctx context.Context) error {
+	m.mu.Lock()
+	started := m.started
+	m.started = nil
+	m.mu.Unlock()
+
+	var errs []error
+	for i := len(started) - 1; i >= 0; i-- {
+		c := started[i]
+
+		m.set(c.Name, StateStopping, nil)
+
+		if c.Stop != nil {
+			if err := m.hook(ctx, c, c.Stop); err != nil {
+				m.set(c.Name, StateFailed, err)
+				errs = append(errs, fmt.Errorf("%w: %s: %s", ErrFailedToStop, c.Name, err))
+
+				continue
+			}
+		}
+
+		m.set(c.Name, StateStopped, nil)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Status returns the state of every component, in the order they were registered.
+func (m *Manager) Status() []Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make([]Status, 0, len(m.components))
+	for _, c := range m.components {
+		out = append(out, *m.status[c.Name])
+	}
+
+	return out
+}
+
+// Healthy indicates whether every component is ready.
+func (m *Manager) Healthy() bool {
+	for _, s := range m.Status() {
+		if s.State != StateReady {
+			return false
+		}
+	}
+
+	return true
+}
+
+// start starts a single component, and waits for it to be ready.
+func (m *Manager) start(ctx context.Context, c *Component) error {
+	m.set(c.Name, StateStarting, nil)
+
+	if c.Start != nil {
+		if err := m.hook(ctx, c, c.Start); err != nil {
+			return err
+		}
+	}
+
+	if c.Ready == nil {
+		return nil
+	}
+
+	return m.hook(ctx, c, func(ctx context.Context) error {
+		for {
+			err := c.Ready(ctx)
+			if err == nil {
+				return nil
+			}
+
+			if clock.SleepContext(ctx, m.clock, 100*time.Millisecond) != nil {
+				return fmt.Errorf("not ready: %w", err)
+			}
+		}
+	})
+}
+
+// hook calls the function with a context bounded by the timeout of the component.
+func (m *Manager) hook(ctx context.Context, c *Component, fn func(ctx context.Context) error) error {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	ctx, cancel := clock.WithTimeout(ctx, m.clock, timeout)
+	defer cancel()
+
+	return fn(ctx)
+}
+
+// set records (and logs) the component entering a new state.
+func (m *Manager) set(name string, state State, err error) {
+	m.mu.Lock()
+	s := m.status[name]
+	s.State = state
+	s.Since = m.clock.Now()
+	s.Error = ""
+	if err != nil {
+		s.Error = err.Error()
+	}
+	m.mu.Unlock()
+
+	if err != nil {
+		m.log.Error("component changed state", "component", name, "state", state, "error", err)
+		return
+	}
+
+	m.log.Info("component changed state", "component", name, "state", state)
+}
+
+// order sorts the components such that every component comes after its dependencies, keeping the order they were
+// registered in otherwise. The lock must be held.
+func (m *Manager) order() ([]*Component, error) {
+	byName := make(map[string]*Component, len(m.components))
+	for _, c := range m.components {
+		byName[c.Name] = c
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	marks := make(map[string]int, len(m.components))
+	order := make([]*Component, 0, len(m.components))
+
+	var visit func(c *Component) error
+	visit = func(c *Component) error {
+		switch marks[c.Name] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("%w: through %s", ErrDependencyCycle, c.Name)
+		}
+
+		marks[c.Name] = visiting
+
+		for _, d := range c.DependsOn {
+			dep, ok := byName[d]
+			if !ok {
+				return fmt.Errorf("%w: %s depends on %s", ErrUnknownDependency, c.Name, d)
+			}
+
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+
+		marks[c.Name] = visited
+		order = append(order, c)
+
+		return nil
+	}
+
+	for _, c := range m.components {
+		if err := visit(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
+}
@@ -0,0 +1,314 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/clock"
+)
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// recorder records the hooks of components as they are called.
+type recorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+// component creates a component whose Start and Stop hooks are recorded, and fail with the supplied errors.
+func (r *recorder) component(name string, startErr, stopErr error, dependsOn ...string) *Component {
+	return &Component{
+		Name:      name,
+		DependsOn: dependsOn,
+		Start: func(context.Context) error {
+			r.record("start " + name)
+			return startErr
+		},
+		Stop: func(context.Context) error {
+			r.record("stop " + name)
+			return stopErr
+		},
+	}
+}
+
+func (r *recorder) record(call string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls = append(r.calls, call)
+}
+
+func (r *recorder) Calls() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string{}, r.calls...)
+}
+
+func TestStartStop(t *testing.T) {
+	r := &recorder{}
+	m := New(discard)
+
+	// Registered in any order; started after their dependencies, and otherwise in the order they were registered.
+	for _, c := range []*Component{
+		r.component("server", nil, nil, "store", "telemetry"),
+		r.component("telemetry", nil, nil),
+		r.component("store", nil, nil, "telemetry"),
+		r.component("tracker", nil, nil),
+	} {
+		if err := m.Register(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := m.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if !m.Healthy() {
+		t.Errorf("expected every component to be ready, got %+v", m.Status())
+	}
+
+	if err := m.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"start telemetry", "start store", "start server", "start tracker",
+		"stop tracker", "stop server", "stop store", "stop telemetry",
+	}
+
+	if got := r.Calls(); !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	for _, s := range m.Status() {
+		if s.State != StateStopped {
+			t.Errorf("expected %s to be stopped, got %s", s.Name, s.State)
+		}
+	}
+}
+
+func TestOrderErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		components [][]string
+		err        error
+	}{
+		{"unknown dependency", [][]string{{"a", "b"}}, ErrUnknownDependency},
+		{"depends on itself", [][]string{{"a", "a"}}, ErrDependencyCycle},
+		{"cycle", [][]string{{"a", "c"}, {"b", "a"}, {"c", "b"}}, ErrDependencyCycle},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &recorder{}
+			m := New(discard)
+
+			for _, c := range tc.components {
+				if err := m.Register(r.component(c[0], nil, nil, c[1:]...)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := m.Start(context.Background()); !errors.Is(err, tc.err) {
+				t.Errorf("expected %v, got %v", tc.err, err)
+			}
+
+			if calls := r.Calls(); len(calls) != 0 {
+				t.Errorf("expected nothing to be started, got %v", calls)
+			}
+		})
+	}
+}
+
+func TestRegisterDuplicate(t *testing.T) {
+	m := New(discard)
+
+	if err := m.Register(&Component{Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Register(&Component{Name: "a"}); !errors.Is(err, ErrDuplicateComponent) {
+		t.Errorf("expected %v, got %v", ErrDuplicateComponent, err)
+	}
+}
+
+func TestStartRollback(t *testing.T) {
+	r := &recorder{}
+	m := New(discard)
+
+	broken := errors.New("broken")
+
+	for _, c := range []*Component{
+		r.component("a", nil, nil),
+		r.component("b", nil, broken),
+		r.component("c", broken, nil, "b"),
+		r.component("d", nil, nil, "c"),
+	} {
+		if err := m.Register(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := m.Start(context.Background()); !errors.Is(err, ErrFailedToStart) || !strings.Contains(err.Error(), "c") {
+		t.Fatalf("expected c to fail to start, got %v", err)
+	}
+
+	// Those that were started are stopped in reverse; even once one of them fails to stop.
+	want := []string{"start a", "start b", "start c", "stop b", "stop a"}
+	if got := r.Calls(); !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	states := map[string]State{}
+	for _, s := range m.Status() {
+		states[s.Name] = s.State
+	}
+
+	if want := map[string]State{"a": StateStopped, "b": StateFailed, "c": StateFailed, "d": StatePending}; !maps.Equal(states, want) {
+		t.Errorf("expected %v, got %v", want, states)
+	}
+
+	if m.Healthy() {
+		t.Error("expected the manager not to be healthy")
+	}
+}
+
+func TestStopErrors(t *testing.T) {
+	r := &recorder{}
+	m := New(discard)
+
+	broken := errors.New("broken")
+
+	for _, c := range []*Component{
+		r.component("a", nil, broken),
+		r.component("b", nil, broken),
+	} {
+		if err := m.Register(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := m.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	err := m.Stop(context.Background())
+	if !errors.Is(err, ErrFailedToStop) || !strings.Contains(err.Error(), "a") || !strings.Contains(err.Error(), "b") {
+		t.Errorf("expected both to fail to stop, got %v", err)
+	}
+
+	// Components are only stopped once.
+	if err := m.Stop(context.Background()); err != nil {
+		t.Errorf("expected nothing to stop, got %v", err)
+	}
+
+	if want := []string{"start a", "start b", "stop b", "stop a"}; !slices.Equal(r.Calls(), want) {
+		t.Errorf("expected %v, got %v", want, r.Calls())
+	}
+}
+
+// waitForWaiters blocks until n things are waiting on the clock, such that advancing it wakes them.
+func waitForWaiters(f *clock.Fake, n int) {
+	for f.Waiters() < n {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestReady(t *testing.T) {
+	clk := clock.NewFake(time.Date(2023, 9, 9, 12, 0, 0, 0, time.UTC))
+	m := New(discard, WithClock(clk))
+
+	// Ready is polled until it succeeds.
+	var polls int
+	if err := m.Register(&Component{
+		Name:    "a",
+		Timeout: time.Minute,
+		Ready: func(context.Context) error {
+			if polls++; polls < 3 {
+				return errors.New("not yet")
+			}
+
+			return nil
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() { done <- m.Start(context.Background()) }()
+
+	// The timeout of the hook, and the wait before polling again.
+	for i := 0; i < 2; i++ {
+		waitForWaiters(clk, 2)
+		clk.Advance(100 * time.Millisecond)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if polls != 3 {
+		t.Errorf("expected to be polled 3 times, got %d", polls)
+	}
+
+	if s := m.Status()[0]; s.State != StateReady || !s.Since.Equal(clk.Now()) {
+		t.Errorf("expected to be ready at %s, got %+v", clk.Now(), s)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		c    Component
+		want string
+	}{
+		{"start", Component{Start: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}}, context.DeadlineExceeded.Error()},
+		{"ready", Component{Ready: func(context.Context) error { return errors.New("not yet") }}, "not ready: not yet"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			clk := clock.NewFake(time.Date(2023, 9, 9, 12, 0, 0, 0, time.UTC))
+			m := New(discard, WithClock(clk))
+
+			c := tc.c
+			c.Name = "a"
+			c.Timeout = time.Second
+
+			if err := m.Register(&c); err != nil {
+				t.Fatal(err)
+			}
+
+			done := make(chan error)
+			go func() { done <- m.Start(context.Background()) }()
+
+			waitForWaiters(clk, 1)
+
+			// Not on the clock on the wall.
+			select {
+			case err := <-done:
+				t.Fatalf("expected to still be starting, got %v", err)
+			case <-time.After(10 * time.Millisecond):
+			}
+
+			clk.Advance(time.Second)
+
+			if err := <-done; !errors.Is(err, ErrFailedToStart) || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("expected to fail with %q, got %v", tc.want, err)
+			}
+
+			if s := m.Status()[0]; s.State != StateFailed {
+				t.Errorf("expected to have failed, got %+v", s)
+			}
+		})
+	}
+}
@@ -1,79 +1,552 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"flag"
+	"fmt"
 	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/andrewhowdencom/courses.pito/delivery-service/carriers"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/clock"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/config"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/events"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/experiments"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/lifecycle"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/money"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/pickup"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/pricing"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/quota"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/quotelog"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/quotes"
 	"github.com/andrewhowdencom/courses.pito/delivery-service/server"
 	"github.com/andrewhowdencom/courses.pito/delivery-service/telemetry"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/tracking"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/usage"
 	"go.opentelemetry.io/contrib/instrumentation/runtime"
 )
 
-// flags that influence the programs behavior
-var addr = flag.String("a", "localhost:9093", "the address on which the server should listen")
+// flags that influence the programs behavior. Only those in flagSettings set a setting of the configuration; the others
+// choose the files and modes the service starts with, so are only flags. They are not read from the environment or the
+// file, not reloaded, and not printed by "config print".
+var configPath = flag.String("config", "", "a file of configuration (see the README), reloaded on SIGHUP. If empty, $DELIVERY_CONFIG is used (if set)")
+var addr = flag.String("a", "localhost:9093", "the address on which the server should listen. Overrides listen.http of the configuration")
+var metricsAddr = flag.String("metrics-addr", "localhost:9094", "the address on which metrics are served. Overrides telemetry.metrics_addr of the configuration")
+var logLevel = flag.String("log-level", "info", `the least severe level that is logged: "debug", "info", "warn" or "error". Overrides telemetry.log_level of the configuration`)
+var pickupPoints = flag.String("pickup-points", "", "a file of pickup points, that carriers can deliver to instead of the door")
+var quoteStore = flag.String("quotes", "", "a file in which to keep quotes, so they can be booked after a restart. If empty, quotes are kept in memory")
+var signingKeys = flag.String("signing-keys", "", "a file of keys used to sign quotes. If empty, a key is generated that only lasts until the next restart")
+var usageDB = flag.String("usage-db", "", "a database in which to keep the usage of each client. If empty, usage is kept in memory")
+var adminAddr = flag.String("admin-addr", "localhost:9096", "the address on which the admin routes (such as /usage) are served. Overrides listen.admin of the configuration")
+var h3Addr = flag.String("h3", "", "the (UDP) address on which the server should additionally serve HTTP/3. If empty, HTTP/3 is not served. Overrides listen.http3 of the configuration")
+var tlsCert = flag.String("tls-cert", "", "the certificate (PEM) used for HTTP/3. If empty, a self-signed certificate is generated")
+var tlsKey = flag.String("tls-key", "", "the private key (PEM) of the certificate used for HTTP/3")
+var seed = flag.Int64("seed", 0, "seeds the randomness of the simulated providers, such that the same requests (in the same order) get the same options, latencies and failures, and starts the clock at a fixed time. If not set, they are random")
+var quoteLog = flag.String("quote-log", "", "a file in which to log every set of options served, for analytics. It is rotated as it grows. If empty, nothing is logged")
+var analyticsAddr = flag.String("analytics-addr", "localhost:9095", "the address on which the analytics subcommand serves its report")
+var eventsTarget = flag.String("events", "", `where to publish the quotes served, for analytics: "memory", "file:<path>" or "nats://<host>:<port>[/<subject>]". If empty, they are not published`)
+var record = flag.String("record", "", "a cassette file to which to record what each provider returns, such that it can be replayed later")
+var replay = flag.String("replay", "", "a cassette file from which to replay what each provider returned, instead of querying them")
+var exchangeRates = flag.String("exchange-rates", "", "a file of exchange rates, used to convert costs into the currency requested by clients")
 
 var log *slog.Logger
 
+// level is the least severe level that is logged. It is set from the configuration, and changes as it is reloaded.
+var level = new(slog.LevelVar)
+
+// cfg is the configuration of the service, as it was last (successfully) loaded.
+var cfg *config.Config
+
 func main() {
+	// Parse the flags
+	flag.Parse()
+
+	// Bootstrap the logger
+	log = slog.New(slog.NewJSONHandler(
+		os.Stderr, &slog.HandlerOptions{Level: level},
+	))
+
+	// Bind the log to the telemetry package.
+	telemetry.Log = log
+
+	// Subcommands run instead of the server.
+	switch flag.Arg(0) {
+	case "usage-export":
+		os.Exit(usageExport(flag.Args()[1:]))
+	case "analytics":
+		os.Exit(analyze(flag.Args()[1:]))
+	case "config":
+		os.Exit(configCommand(flag.Args()[1:]))
+	}
+
 	log.Info("application started")
 
+	var err error
+	if cfg, err = loadConfig(); err != nil {
+		log.Error("failed to load configuration", "error", err, "path", configFile())
+		os.Exit(1)
+	}
+
+	// Hint: The level has already been validated.
+	l, _ := cfg.LogLevel()
+	level.Set(l)
+
 	// Bind signal handlers
 	ch := make(chan os.Signal, 1)
 
-	// SIGINT is the signal to terminate ("interrupt") the process.
-	signal.Notify(ch, syscall.SIGINT)
+	// SIGINT is the signal to terminate ("interrupt") the process, and SIGHUP to reload its configuration.
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGHUP)
 
-	carriers, err := carriers.New(carriers.Defaults...)
-	if err != nil {
-		log.Error("failed to bootstrap carriers", "error", err)
+	// Everything tells the time with the same clock. If seeded, it starts at the same time on every run, such that what
+	// the providers return does not depend on when the service was started. The sources of randomness of the providers
+	// are created once, such that they continue their sequence on reload.
+	clk := clock.Real
+
+	var seeds *carriers.Seeds
+	if seeded() {
+		clk = clock.From(seedEpoch)
+		seeds = carriers.NewSeeds(*seed)
 	}
 
-	// Setup the server
-	srv := server.New(carriers)
+	// Each part of the application is a component, started once the components it depends on are ready and stopped
+	// before them. The components share what they create through these variables.
+	lc := lifecycle.New(log, lifecycle.WithClock(clk))
+
+	var (
+		prom     = telemetry.NewPrometheusHTTP(cfg.Telemetry.MetricsAddr)
+		cassette *carriers.Cassette
+		exps     *experiments.Set
+		limiter  *quota.Limiter
+		carriers *carriers.Carriers
+		qs       *quotes.Store
+		us       *usage.Store
+		tracker  *tracking.Tracker
+		pub      events.Publisher
+		ql       *quotelog.Log
+		srv      *server.Server
+
+		stopTracker, stopUsage context.CancelFunc
+	)
+
+	components := []*lifecycle.Component{
+		{
+			Name: "telemetry",
+			Start: func(ctx context.Context) error {
+				// Bootstrap the metrics
+				if err := telemetry.SetupOTelMetrics(prom.Reader); err != nil {
+					return err
+				}
+
+				// Bootstrap the traces, which are logged (at the debug level) for want of a tracing backend.
+				if err := telemetry.SetupOTelTraces(telemetry.LogExporter{}); err != nil {
+					return err
+				}
+
+				// Start exporting runtime metrics (e.g. gc, memory, uptime)
+				return runtime.Start()
+			},
+			Stop: func(ctx context.Context) error {
+				return errors.Join(telemetry.ShutdownOTelTraces(ctx), telemetry.ShutdownOTelMetrics(ctx))
+			},
+		},
+		{
+			Name:      "metrics-server",
+			DependsOn: []string{"telemetry"},
+			Start: func(ctx context.Context) error {
+				return prom.Listen()
+			},
+			Ready: dialer(cfg.Telemetry.MetricsAddr),
+			Stop:  prom.Shutdown,
+		},
+		{
+			Name:      "carriers",
+			DependsOn: []string{"telemetry"},
+			Start: func(ctx context.Context) (err error) {
+				if cassette, err = openCassette(); err != nil {
+					return err
+				}
+
+				if exps, err = experiments.New(cfg.Experiments, experiments.Defaults...); err != nil {
+					return err
+				}
+
+				// The limiter is created once, such that what each carrier has used of its quota is kept on reload.
+				if limiter, err = quota.New(append(quota.Defaults, quota.WithClock(clk), quota.WithLogger(log))...); err != nil {
+					return err
+				}
+
+				if err = limiter.Set(cfg.Limits()); err != nil {
+					return err
+				}
+
+				carriers, err = bootstrapCarriers(clk, cfg, cassette, exps, limiter, seeds)
+				return err
+			},
+			Stop: func(ctx context.Context) error {
+				if cassette == nil {
+					return nil
+				}
 
-	// Run the server, but in its own goroutine without blocking this thread.
-	go func() {
-		if err := srv.Listen(*addr); err != nil {
-			log.Error("failed to start server", "error", err, "addr", *addr)
+				return cassette.Close()
+			},
+		},
+		{
+			// Quotes are kept in memory, unless there is a file to persist them in.
+			Name: "quotes",
+			Start: func(ctx context.Context) (err error) {
+				qs, err = quotes.Open(*quoteStore, quotes.WithClock(clk))
+				return err
+			},
+			Stop: func(ctx context.Context) error {
+				return qs.Close()
+			},
+		},
+		{
+			// Account for how much each client uses the service, flushing it to disk periodically.
+			Name: "usage",
+			Start: func(ctx context.Context) (err error) {
+				if us, err = usage.Open(*usageDB, usage.WithClock(clk)); err != nil {
+					return err
+				}
+
+				var usageCtx context.Context
+				usageCtx, stopUsage = context.WithCancel(context.Background())
+				go us.Run(usageCtx, 10*time.Second)
+
+				return nil
+			},
+			Stop: func(ctx context.Context) error {
+				stopUsage()
+				return us.Close()
+			},
+		},
+		{
+			// Follow shipments through their (simulated) lifecycle, logging each change of state.
+			Name: "tracker",
+			Start: func(ctx context.Context) error {
+				trackerOpts := []tracking.Option{tracking.WithClock(clk)}
+				if seeded() {
+					trackerOpts = append(trackerOpts, tracking.WithRand(rand.New(rand.NewSource(*seed))))
+				}
+
+				tracker = tracking.New(tracking.Profiles, trackerOpts...)
+				tracker.Subscribe(func(e tracking.Event) {
+					log.Info("shipment changed state", "shipment", e.ShipmentID, "provider", e.Provider, "state", e.State)
+				})
+
+				var trackerCtx context.Context
+				trackerCtx, stopTracker = context.WithCancel(context.Background())
+				go tracker.Run(trackerCtx, time.Second)
+
+				return nil
+			},
+			Stop: func(ctx context.Context) error {
+				stopTracker()
+				return nil
+			},
+		},
+		{
+			// Publish the quotes served for analytics, if there is somewhere to publish them.
+			Name: "events",
+			Start: func(ctx context.Context) (err error) {
+				pub, err = events.Open(*eventsTarget)
+				return err
+			},
+			Stop: func(ctx context.Context) error {
+				return pub.Close()
+			},
+		},
+		{
+			// Log the options served for analytics, if there is somewhere to log them.
+			Name: "quote-log",
+			Start: func(ctx context.Context) (err error) {
+				if *quoteLog == "" {
+					return nil
+				}
+
+				ql, err = quotelog.Open(*quoteLog, quotelog.DefaultMaxSize, quotelog.DefaultMaxBackups)
+				return err
+			},
+			Stop: func(ctx context.Context) error {
+				if ql == nil {
+					return nil
+				}
+
+				return ql.Close()
+			},
+		},
+		{
+			Name:      "server",
+			DependsOn: []string{"telemetry", "carriers", "quotes", "usage", "tracker", "events", "quote-log"},
+			Start: func(ctx context.Context) error {
+				srvOpts, err := serverOptions()
+				if err != nil {
+					return err
+				}
+
+				srvOpts = append(srvOpts,
+					server.WithClock(clk),
+					server.WithQuoteStore(qs),
+					server.WithTracker(tracker),
+					server.WithUsageStore(us),
+					server.WithEventPublisher(pub),
+					server.WithLifecycle(lc),
+					server.WithExperiments(exps),
+				)
+
+				if ql != nil {
+					srvOpts = append(srvOpts, server.WithQuoteLog(ql))
+				}
+
+				if srv, err = server.New(carriers, srvOpts...); err != nil {
+					return err
+				}
+
+				// Bind the address here, such that a failure (for example, the port being in use) fails the start.
+				l, err := net.Listen("tcp", cfg.Listen.HTTP)
+				if err != nil {
+					return err
+				}
+
+				// Run the server, but in its own goroutine without blocking this thread. The server returns
+				// ErrServerClosed once it is shut down, which is expected.
+				admin, err := net.Listen("tcp", cfg.Listen.Admin)
+				if err != nil {
+					l.Close()
+					return err
+				}
+
+				go func() {
+					if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+						log.Error("failed to serve", "error", err, "addr", l.Addr())
+					}
+				}()
+
+				go func() {
+					if err := srv.ServeAdmin(admin); err != nil && !errors.Is(err, http.ErrServerClosed) {
+						log.Error("failed to serve admin routes", "error", err, "addr", admin.Addr())
+					}
+				}()
+
+				if cfg.Listen.HTTP3 == "" {
+					return nil
+				}
+
+				conn, err := net.ListenPacket("udp", cfg.Listen.HTTP3)
+				if err != nil {
+					return err
+				}
+
+				go func() {
+					// Hint: Once closed, the HTTP/3 server returns an error that is not ErrServerClosed.
+					if err := srv.ServeHTTP3(conn); err != nil && !errors.Is(err, http.ErrServerClosed) {
+						log.Info("stopped serving HTTP/3", "error", err, "addr", conn.LocalAddr())
+					}
+				}()
+
+				return nil
+			},
+			Ready: dialer(cfg.Listen.HTTP),
+			Stop: func(ctx context.Context) error {
+				return srv.Shutdown(ctx)
+			},
+		},
+	}
+
+	for _, c := range components {
+		c.Timeout = time.Duration(cfg.Timeouts.Lifecycle)
+
+		if err := lc.Register(c); err != nil {
+			log.Error("failed to register component", "error", err, "component", c.Name)
 			os.Exit(1)
 		}
-	}()
+	}
+
+	if err := lc.Start(context.Background()); err != nil {
+		log.Error("failed to start", "error", err)
+		os.Exit(1)
+	}
 
 	log.Info("awaiting shutdown signal (SIGINT)")
-	<-ch
+	for sig := range ch {
+		if sig == syscall.SIGINT {
+			break
+		}
+
+		// Hint: A configuration that fails to reload is logged, and the service continues with the one it had.
+		if err := reload(clk, cassette, limiter, seeds, srv); err != nil {
+			log.Error("failed to reload configuration", "error", err, "path", configFile())
+		}
+	}
 	log.Info("received shutdown signal")
 
-	if err := srv.Shutdown(); err != nil {
-		log.Error("failed to shutdown server", "error", err)
+	if err := lc.Stop(context.Background()); err != nil {
+		log.Error("failed to stop", "error", err)
 		os.Exit(1)
 	}
 
 	os.Exit(0)
 }
 
-func init() {
-	// Parse the flags
-	flag.Parse()
+// seedEpoch is the time the clock starts at, if seeded.
+var seedEpoch = time.Date(2023, 9, 9, 0, 0, 0, 0, time.UTC)
 
-	// Bootstrap the logger
-	log = slog.New(slog.NewJSONHandler(
-		os.Stderr, nil,
-	))
+// seeded returns whether a seed was supplied. Any seed (including 0) makes the providers reproducible.
+func seeded() bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "seed" {
+			set = true
+		}
+	})
 
-	// Bind the log to the telemetry package.
-	telemetry.Log = log
+	return set
+}
+
+// openCassette opens the cassette to record to, or replay from, if there is one.
+func openCassette() (*carriers.Cassette, error) {
+	switch {
+	case *record != "" && *replay != "":
+		return nil, fmt.Errorf("cannot both record to %s and replay from %s", *record, *replay)
+	case *record != "":
+		return carriers.CreateCassette(*record, log)
+	case *replay != "":
+		return carriers.LoadCassette(*replay)
+	}
+
+	return nil, nil
+}
+
+// bootstrapCarriers registers the configured providers, along with the pickup points (if any) they deliver to. If
+// recording, each provider is wrapped such that what it returns is written to the cassette; if replaying, the
+// providers in the cassette are registered instead (those recorded as shadows, as shadows). The experiments are the outermost middleware, such that carriers
+// excluded by them are not queried (or traced) at all. The quota of each provider is inside the tracing, such that
+// time spent queued is traced, but outside the timeout, such that it is not abandoned for it.
+func bootstrapCarriers(clk clock.Clock, cfg *config.Config, cassette *carriers.Cassette, exps *experiments.Set, limiter *quota.Limiter, seeds *carriers.Seeds) (*carriers.Carriers, error) {
+	sims := carriers.Simulations()
+	if seeds != nil {
+		sims = seeds.Simulations()
+	}
+
+	carrierOpts := []carriers.Option{carriers.WithMiddleware(exps.Middleware())}
+	carrierOpts = append(carrierOpts, carriers.Defaults...)
+	carrierOpts = append(carrierOpts,
+		carriers.WithClock(clk),
+		carriers.WithMiddleware(
+			limiter.Middleware(),
+			carriers.Timeout(time.Duration(cfg.Timeouts.Carrier), clk),
+			pricing.Middleware(cfg.Pricing),
+		),
+	)
+
+	switch {
+	case *replay != "":
+		// The emissions model is not recorded, so is taken from the simulation of the same name (if there is one).
+		models := map[string]carriers.EmissionsModel{}
+		for _, s := range sims {
+			models[s.Name] = s.Model
+		}
+
+		for _, p := range cassette.Providers() {
+			carrierOpts = append(carrierOpts, carriers.WithCarrier(&carriers.Replayer{Name: p, Cassette: cassette, Model: models[p], Clock: clk}))
+		}
+
+		// Shadows are replayed as shadows, such that they are compared with the others rather than returned.
+		for _, p := range cassette.Shadows() {
+			carrierOpts = append(carrierOpts, carriers.WithShadow(&carriers.Replayer{Name: p, Cassette: cassette, Model: models[p], Clock: clk}))
+		}
+	default:
+		// Recording is the innermost middleware, such that what is recorded is what the provider returned.
+		if *record != "" {
+			carrierOpts = append(carrierOpts, carriers.WithMiddleware(carriers.Record(cassette, clk)))
+		}
+
+		for _, s := range cfg.Simulations(sims) {
+			s.Clock = clk
+			carrierOpts = append(carrierOpts, carriers.WithCarrier(s))
+		}
 
-	// Bootstrap the metrics
-	if err := telemetry.SetupOTelMetrics(telemetry.WithPrometheusHTTP("localhost:9094")); err != nil {
-		log.Error("failed to bootstrap metrics", "err", err)
+		for _, s := range cfg.Shadows(sims) {
+			s.Clock = clk
+			carrierOpts = append(carrierOpts, carriers.WithShadow(s))
+		}
+	}
+
+	// Pickup points are optional. Without them, carriers only deliver to the door.
+	if *pickupPoints != "" {
+		dir, err := pickup.Load(*pickupPoints)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load pickup points from %s: %w", *pickupPoints, err)
+		}
+
+		carrierOpts = append(carrierOpts, carriers.WithPickupPoints(dir))
+	}
+
+	return carriers.New(carrierOpts...)
+}
+
+// serverOptions loads the optional configuration of the server from the files supplied by flags.
+func serverOptions() ([]server.Option, error) {
+	srvOpts := []server.Option{}
+
+	// Exchange rates are optional. Without them, clients cannot request a currency.
+	if *exchangeRates != "" {
+		rates, err := money.LoadRates(*exchangeRates)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load exchange rates from %s: %w", *exchangeRates, err)
+		}
+
+		srvOpts = append(srvOpts, server.WithExchangeRates(rates))
 	}
 
-	// Start exporting runtime metrics (e.g. gc, memory, uptime)
-	if err := runtime.Start(); err != nil {
-		log.Error("failed to enable runtime metrics", "err", err)
+	// Signing keys are optional. Without them, the server generates its own.
+	if *signingKeys != "" {
+		keys, err := quotes.LoadKeys(*signingKeys)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load signing keys from %s: %w", *signingKeys, err)
+		}
+
+		srvOpts = append(srvOpts, server.WithSigningKeys(keys))
+	}
+
+	// HTTP/3 is optional, and requires TLS. Without a certificate, one is generated for the address.
+	if cfg.Listen.HTTP3 != "" {
+		var cert tls.Certificate
+		var err error
+
+		if *tlsCert != "" {
+			cert, err = tls.LoadX509KeyPair(*tlsCert, *tlsKey)
+		} else {
+			host, _, _ := net.SplitHostPort(cfg.Listen.HTTP3)
+			cert, err = server.SelfSignedCertificate(host)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to load certificate for HTTP/3: %w", err)
+		}
+
+		srvOpts = append(srvOpts, server.WithHTTP3(cfg.Listen.HTTP3, &tls.Config{Certificates: []tls.Certificate{cert}}))
+	}
+
+	return srvOpts, nil
+}
+
+// dialer returns a readiness check that succeeds once something is accepting connections on the address.
+func dialer(addr string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+
+		return conn.Close()
 	}
 }
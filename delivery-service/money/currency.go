@@ -0,0 +1,86 @@
+package money
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// iso4217 is a copy of the "active currencies" list of the ISO 4217 standard, trimmed to the fields this package
+// needs. Funds and precious metals (which have no minor unit) are omitted.
+//
+// See:
+// 1. https://www.six-group.com/en/products-services/financial-information/data-standards.html
+//
+//go:embed iso4217.csv
+var iso4217 []byte
+
+// currencies is the parsed version of the embedded table, keyed by the alphabetic code.
+var currencies map[string]Currency
+
+// Currency is an entry in the ISO 4217 table.
+type Currency struct {
+	// Code is the alphabetic code, such as "EUR"
+	Code string
+
+	// Numeric is the three digit numeric code, such as "978". It is kept as a string as the leading zeros are
+	// significant.
+	Numeric string
+
+	// MinorUnits is the number of decimal places between the base (non decimal) unit and the major unit. For
+	// example, the Euro has 2 (100 cents in a Euro), the Yen has 0 and the Kuwaiti Dinar has 3.
+	MinorUnits int
+
+	// Name is the English name of the currency.
+	Name string
+}
+
+// LookupCurrency finds the currency with the supplied ISO code, returning ErrUnknownCurrency if it is not within the
+// table.
+func LookupCurrency(code string) (Currency, error) {
+	c, ok := currencies[strings.ToUpper(code)]
+	if !ok {
+		return Currency{}, fmt.Errorf("%w: %q", ErrUnknownCurrency, code)
+	}
+
+	return c, nil
+}
+
+// Scale is the number of base units within a single major unit. For example, 100 for the Euro.
+func (c Currency) Scale() int64 {
+	s := int64(1)
+	for i := 0; i < c.MinorUnits; i++ {
+		s *= 10
+	}
+
+	return s
+}
+
+func init() {
+	// The table is embedded in the binary, so any failure here is a programming error rather than something that
+	// can be handled at runtime.
+	records, err := csv.NewReader(bytes.NewReader(iso4217)).ReadAll()
+	if err != nil {
+		panic(fmt.Sprintf("money: failed to read embedded currency table: %s", err))
+	}
+
+	currencies = make(map[string]Currency, len(records))
+
+	// The first record is the header.
+	for _, r := range records[1:] {
+		mu, err := strconv.Atoi(r[2])
+		if err != nil {
+			panic(fmt.Sprintf("money: malformed minor units for %s: %s", r[0], err))
+		}
+
+		currencies[r[0]] = Currency{
+			Code:       r[0],
+			Numeric:    r[1],
+			MinorUnits: mu,
+			Name:       r[3],
+		}
+	}
+}
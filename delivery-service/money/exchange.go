@@ -0,0 +1,158 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+)
+
+var (
+	ErrNoRate            = errors.New("no exchange rate")
+	ErrFailedToLoadRates = errors.New("failed to load exchange rates")
+)
+
+// Rates is a table of exchange rates, all relative to a single base currency. It is loaded from a file such as:
+//
+//	{
+//	  "source": "European Central Bank",
+//	  "timestamp": "2023-09-11T16:00:00Z",
+//	  "base": "EUR",
+//	  "rates": {"GBP": "0.8571", "USD": "1.0724"}
+//	}
+//
+// Rates are kept as decimal strings, rather than floating point numbers, so that they are used exactly as published.
+type Rates struct {
+	// Source is where the rates were published, such as a central bank.
+	Source string `json:"source"`
+
+	// Timestamp is the time at which the rates were published.
+	Timestamp time.Time `json:"timestamp"`
+
+	// Base is the currency that all other rates are relative to. A unit of the base currency is worth "rate" units
+	// of each other currency.
+	Base string `json:"base"`
+
+	// Rates are the rates themselves, keyed by ISO code.
+	Rates map[string]string `json:"rates"`
+
+	// parsed are the rates, converted into exact fractions.
+	parsed map[string]*big.Rat
+}
+
+// Conversion is the result of converting an amount into another currency, along with where the rate came from.
+type Conversion struct {
+	// Amount is the converted amount.
+	Amount *Money `json:"amount"`
+
+	// Rate is the number of units of the target currency per unit of the source currency.
+	Rate string `json:"rate"`
+
+	// Source is where the rate was published.
+	Source string `json:"source"`
+
+	// Timestamp is when the rate was published.
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// LoadRates reads a table of exchange rates from a JSON file on disk.
+func LoadRates(path string) (*Rates, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFailedToLoadRates, err)
+	}
+	defer f.Close()
+
+	r := &Rates{}
+	if err := json.NewDecoder(f).Decode(r); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFailedToLoadRates, err)
+	}
+
+	if err := r.parse(); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFailedToLoadRates, err)
+	}
+
+	return r, nil
+}
+
+// Supports indicates whether there is a rate for the supplied currency.
+func (r *Rates) Supports(currency string) bool {
+	_, ok := r.parsed[currency]
+
+	return ok
+}
+
+// Convert converts the amount into the supplied currency, rounding the result to the base unit of that currency with
+// the supplied mode. Rates between two non-base currencies are derived via the base currency.
+func (r *Rates) Convert(m *Money, to string, mode RoundingMode) (*Conversion, error) {
+	fc, err := LookupCurrency(m.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	tc, err := LookupCurrency(to)
+	if err != nil {
+		return nil, err
+	}
+
+	from, ok := r.parsed[fc.Code]
+	if !ok {
+		return nil, fmt.Errorf("%w: from %s", ErrNoRate, fc.Code)
+	}
+
+	into, ok := r.parsed[tc.Code]
+	if !ok {
+		return nil, fmt.Errorf("%w: to %s", ErrNoRate, tc.Code)
+	}
+
+	// The rate between the two currencies, in major units.
+	rate := new(big.Rat).Quo(into, from)
+
+	// The amount is in base units of the source currency, and needs to end up in base units of the target. This
+	// matters when (for example) converting from the Euro (2 minor units) into the Yen (none).
+	amount := new(big.Rat).SetInt64(m.Total)
+	amount.Mul(amount, rate)
+	amount.Mul(amount, new(big.Rat).SetFrac64(tc.Scale(), fc.Scale()))
+
+	total, err := divide(amount.Num(), amount.Denom(), mode)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Conversion{
+		Amount:    &Money{Total: total, Currency: tc.Code},
+		Rate:      rate.FloatString(6),
+		Source:    r.Source,
+		Timestamp: r.Timestamp,
+	}, nil
+}
+
+// parse validates the currencies and converts the decimal strings into exact fractions.
+func (r *Rates) parse() error {
+	base, err := LookupCurrency(r.Base)
+	if err != nil {
+		return err
+	}
+
+	r.parsed = map[string]*big.Rat{
+		base.Code: big.NewRat(1, 1),
+	}
+
+	for code, s := range r.Rates {
+		c, err := LookupCurrency(code)
+		if err != nil {
+			return err
+		}
+
+		rate, ok := new(big.Rat).SetString(s)
+		if !ok || rate.Sign() <= 0 {
+			return fmt.Errorf("malformed rate for %s: %q", c.Code, s)
+		}
+
+		r.parsed[c.Code] = rate
+	}
+
+	return nil
+}
@@ -0,0 +1,182 @@
+package money
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Locale describes how amounts of money are written for a given language (and, optionally, region).
+//
+// See:
+// 1. https://cldr.unicode.org/translation/number-currency-formats
+type Locale struct {
+	// Tag is the BCP 47 language tag of the locale, such as "de" or "en-GB".
+	Tag string
+
+	// Decimal separates the major and minor units.
+	Decimal string
+
+	// Group separates each group of three digits in the major unit.
+	Group string
+
+	// SymbolFirst indicates whether the currency symbol is written before the amount.
+	SymbolFirst bool
+
+	// SymbolSpace indicates whether the symbol is separated from the amount by a (non breaking) space.
+	SymbolSpace bool
+}
+
+// DefaultLocale is used when there is no better match for the locale the client requested.
+var DefaultLocale = locales["en"]
+
+// locales are the formats that are supported. It is deliberately a small set; lookups fall back from the region
+// specific tag, to the language, to DefaultLocale.
+var locales = map[string]Locale{
+	"en":    {Tag: "en", Decimal: ".", Group: ",", SymbolFirst: true},
+	"en-IE": {Tag: "en-IE", Decimal: ".", Group: ",", SymbolFirst: true},
+	"de":    {Tag: "de", Decimal: ",", Group: ".", SymbolSpace: true},
+	"de-CH": {Tag: "de-CH", Decimal: ".", Group: "’", SymbolFirst: true, SymbolSpace: true},
+	"es":    {Tag: "es", Decimal: ",", Group: ".", SymbolSpace: true},
+	"fr":    {Tag: "fr", Decimal: ",", Group: "\u202f", SymbolSpace: true},
+	"it":    {Tag: "it", Decimal: ",", Group: ".", SymbolSpace: true},
+	"ja":    {Tag: "ja", Decimal: ".", Group: ",", SymbolFirst: true},
+	"nl":    {Tag: "nl", Decimal: ",", Group: ".", SymbolFirst: true, SymbolSpace: true},
+	"pl":    {Tag: "pl", Decimal: ",", Group: "\u00a0", SymbolSpace: true},
+	"pt":    {Tag: "pt", Decimal: ",", Group: ".", SymbolFirst: true, SymbolSpace: true},
+	"sv":    {Tag: "sv", Decimal: ",", Group: "\u00a0", SymbolSpace: true},
+}
+
+// symbols are the commonly used symbols for currencies. Currencies without a symbol are written with their ISO code.
+var symbols = map[string]string{
+	"AUD": "A$",
+	"BRL": "R$",
+	"CAD": "CA$",
+	"CHF": "CHF",
+	"CNY": "CN¥",
+	"CZK": "Kč",
+	"DKK": "kr.",
+	"EUR": "€",
+	"GBP": "£",
+	"HKD": "HK$",
+	"INR": "₹",
+	"JPY": "¥",
+	"KRW": "₩",
+	"MXN": "MX$",
+	"NOK": "kr",
+	"NZD": "NZ$",
+	"PLN": "zł",
+	"SEK": "kr",
+	"USD": "$",
+}
+
+// LookupLocale finds the format for the supplied language tag, falling back from the region to the language. It
+// indicates whether a match was found at all.
+func LookupLocale(tag string) (Locale, bool) {
+	if l, ok := locales[canonicalTag(tag)]; ok {
+		return l, true
+	}
+
+	lang, _, _ := strings.Cut(tag, "-")
+	if l, ok := locales[strings.ToLower(lang)]; ok {
+		return l, true
+	}
+
+	return DefaultLocale, false
+}
+
+// Decimal writes the amount as a plain decimal number in the major unit of the currency, with as many decimal places
+// as the currency has minor units. For example, 590 EUR is "5.90" and 590 JPY is "590".
+func (m *Money) Decimal() (string, error) {
+	c, err := LookupCurrency(m.Currency)
+	if err != nil {
+		return "", err
+	}
+
+	neg, major, minor := split(m.Total, c)
+	if neg {
+		major = "-" + major
+	}
+
+	if minor == "" {
+		return major, nil
+	}
+
+	return major + "." + minor, nil
+}
+
+// Format writes the amount as a person would expect to read it in the supplied locale. For example, 123456 EUR is
+// "€1,234.56" in "en" but "1.234,56 €" in "de".
+func (m *Money) Format(l Locale) (string, error) {
+	c, err := LookupCurrency(m.Currency)
+	if err != nil {
+		return "", err
+	}
+
+	neg, major, minor := split(m.Total, c)
+
+	// Group the major unit into thousands, from the right.
+	var b strings.Builder
+	for i, d := range major {
+		if i > 0 && (len(major)-i)%3 == 0 {
+			b.WriteString(l.Group)
+		}
+		b.WriteRune(d)
+	}
+
+	if minor != "" {
+		b.WriteString(l.Decimal)
+		b.WriteString(minor)
+	}
+
+	symbol, ok := symbols[c.Code]
+	if !ok {
+		symbol = c.Code
+	}
+
+	// Codes are always spaced, or they run into the digits ("KWD1.234").
+	space := ""
+	if l.SymbolSpace || !ok {
+		space = "\u00a0"
+	}
+
+	out := b.String() + space + symbol
+	if l.SymbolFirst {
+		out = symbol + space + b.String()
+	}
+
+	if neg {
+		out = "-" + out
+	}
+
+	return out, nil
+}
+
+// split breaks the total into its sign, and the digits of the major and minor units.
+func split(total int64, c Currency) (neg bool, major, minor string) {
+	// Working with the digits as a string avoids overflow when taking the absolute value of math.MinInt64.
+	digits := strings.TrimPrefix(strconv.FormatInt(total, 10), "-")
+	neg = total < 0
+
+	if c.MinorUnits == 0 {
+		return neg, digits, ""
+	}
+
+	// Pad with leading zeros so that there is always at least one digit in the major unit.
+	if len(digits) <= c.MinorUnits {
+		digits = strings.Repeat("0", c.MinorUnits-len(digits)+1) + digits
+	}
+
+	cut := len(digits) - c.MinorUnits
+
+	return neg, digits[:cut], digits[cut:]
+}
+
+// canonicalTag normalises the case of a language tag, such that "EN-gb" becomes "en-GB".
+func canonicalTag(tag string) string {
+	lang, region, ok := strings.Cut(tag, "-")
+	if !ok {
+		return strings.ToLower(lang)
+	}
+
+	return strings.ToLower(lang) + "-" + strings.ToUpper(region)
+}
@@ -0,0 +1,94 @@
+package money
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestLookupLocale(t *testing.T) {
+	for _, tc := range []struct {
+		tag   string
+		want  string
+		found bool
+	}{
+		{"de", "de", true},
+		{"de-CH", "de-CH", true},
+		{"DE-ch", "de-CH", true},
+		{"de-AT", "de", true},
+		{"EN", "en", true},
+		{"xx", DefaultLocale.Tag, false},
+		{"", DefaultLocale.Tag, false},
+	} {
+		t.Run(tc.tag, func(t *testing.T) {
+			l, found := LookupLocale(tc.tag)
+			if l.Tag != tc.want || found != tc.found {
+				t.Errorf("expected %s (%t), got %s (%t)", tc.want, tc.found, l.Tag, found)
+			}
+		})
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   Money
+		want string
+		err  error
+	}{
+		{"two minor units", Money{Total: 590, Currency: "EUR"}, "5.90", nil},
+		{"less than a major unit", Money{Total: 5, Currency: "EUR"}, "0.05", nil},
+		{"negative", Money{Total: -5, Currency: "EUR"}, "-0.05", nil},
+		{"zero", Money{Total: 0, Currency: "EUR"}, "0.00", nil},
+		{"no minor units", Money{Total: 590, Currency: "JPY"}, "590", nil},
+		{"three minor units", Money{Total: 1234, Currency: "KWD"}, "1.234", nil},
+		{"minimum", Money{Total: math.MinInt64, Currency: "EUR"}, "-92233720368547758.08", nil},
+		{"unknown currency", Money{Total: 1, Currency: "XXY"}, "", ErrUnknownCurrency},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.in.Decimal()
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		in     Money
+		locale string
+		want   string
+		err    error
+	}{
+		{"symbol first", Money{Total: 123456, Currency: "EUR"}, "en", "€1,234.56", nil},
+		{"symbol last, spaced", Money{Total: 123456, Currency: "EUR"}, "de", "1.234,56\u00a0€", nil},
+		{"symbol first, spaced", Money{Total: 123456, Currency: "CHF"}, "de-CH", "CHF\u00a01’234.56", nil},
+		{"narrow space group", Money{Total: 123456, Currency: "EUR"}, "fr", "1\u202f234,56\u00a0€", nil},
+		{"no group", Money{Total: 99999, Currency: "EUR"}, "en", "€999.99", nil},
+		{"many groups", Money{Total: 123456789012, Currency: "USD"}, "en", "$1,234,567,890.12", nil},
+		{"negative", Money{Total: -123456, Currency: "EUR"}, "en", "-€1,234.56", nil},
+		{"negative, symbol last", Money{Total: -5, Currency: "EUR"}, "de", "-0,05\u00a0€", nil},
+		{"no minor units", Money{Total: 1234, Currency: "JPY"}, "ja", "¥1,234", nil},
+		{"code without symbol", Money{Total: 1234, Currency: "KWD"}, "en", "KWD\u00a01.234", nil},
+		{"unknown currency", Money{Total: 1, Currency: "XXY"}, "en", "", ErrUnknownCurrency},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			l, _ := LookupLocale(tc.locale)
+
+			got, err := tc.in.Format(l)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
@@ -1,6 +1,20 @@
 // package money is a utility package providing functions to handle money.
 package money
 
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+var (
+	ErrUnknownCurrency     = errors.New("unknown currency")
+	ErrCurrencyMismatch    = errors.New("currencies do not match")
+	ErrOverflow            = errors.New("amount overflows")
+	ErrInvalidAllocation   = errors.New("invalid allocation")
+	ErrInvalidRoundingMode = errors.New("invalid rounding mode")
+)
+
 // Money is an amount of cash, represented in the base (non decimal) unit of that currency.
 type Money struct {
 	Total int64 `json:"total"`
@@ -9,4 +23,105 @@ type Money struct {
 	//
 	// * https://www.iso.org/iso-4217-currency-codes.html).
 	Currency string `json:"currency"`
+
+	// Display is the amount formatted for a person to read, in the locale they requested. It is optional, and only
+	// populated when the amount is about to be shown to someone. See Format.
+	Display string `json:"display,omitempty"`
+}
+
+// New creates an amount of money in the base (non decimal) unit of the currency, validating that the currency is
+// known.
+func New(total int64, currency string) (*Money, error) {
+	c, err := LookupCurrency(currency)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Money{Total: total, Currency: c.Code}, nil
+}
+
+// FromMajor creates an amount of money from the major unit of the currency. For example, FromMajor(5, "EUR") is
+// 500 cents, but FromMajor(5, "JPY") is 5 yen.
+func FromMajor(major int64, currency string) (*Money, error) {
+	c, err := LookupCurrency(currency)
+	if err != nil {
+		return nil, err
+	}
+
+	total, err := mul(major, c.Scale())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Money{Total: total, Currency: c.Code}, nil
+}
+
+// Validate checks that the currency of the money is a known ISO 4217 currency.
+func (m *Money) Validate() error {
+	_, err := LookupCurrency(m.Currency)
+
+	return err
+}
+
+// Add returns the sum of both amounts. Both amounts must be in the same currency.
+func (m *Money) Add(o *Money) (*Money, error) {
+	if err := m.same(o); err != nil {
+		return nil, err
+	}
+
+	if (o.Total > 0 && m.Total > math.MaxInt64-o.Total) || (o.Total < 0 && m.Total < math.MinInt64-o.Total) {
+		return nil, fmt.Errorf("%w: %d + %d", ErrOverflow, m.Total, o.Total)
+	}
+
+	return &Money{Total: m.Total + o.Total, Currency: m.Currency}, nil
+}
+
+// Subtract returns the difference between this and the other amount. Both amounts must be in the same currency.
+func (m *Money) Subtract(o *Money) (*Money, error) {
+	if err := m.same(o); err != nil {
+		return nil, err
+	}
+
+	if (o.Total < 0 && m.Total > math.MaxInt64+o.Total) || (o.Total > 0 && m.Total < math.MinInt64+o.Total) {
+		return nil, fmt.Errorf("%w: %d - %d", ErrOverflow, m.Total, o.Total)
+	}
+
+	return &Money{Total: m.Total - o.Total, Currency: m.Currency}, nil
+}
+
+// Multiply returns the amount multiplied by a whole number, such as the quantity of an item.
+func (m *Money) Multiply(n int64) (*Money, error) {
+	total, err := mul(m.Total, n)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Money{Total: total, Currency: m.Currency}, nil
+}
+
+// same validates that both amounts are in the same, known currency.
+func (m *Money) same(o *Money) error {
+	if err := m.Validate(); err != nil {
+		return err
+	}
+
+	if m.Currency != o.Currency {
+		return fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+	}
+
+	return nil
+}
+
+// mul multiplies two integers, returning an error rather than silently wrapping if the result does not fit.
+func mul(a, b int64) (int64, error) {
+	if a == 0 || b == 0 {
+		return 0, nil
+	}
+
+	r := a * b
+	if r/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return 0, fmt.Errorf("%w: %d * %d", ErrOverflow, a, b)
+	}
+
+	return r, nil
 }
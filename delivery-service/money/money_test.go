@@ -0,0 +1,59 @@
+package money
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestArithmetic(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		op   func() (*Money, error)
+		want int64
+		err  error
+	}{
+		{"add", func() (*Money, error) {
+			return (&Money{Total: 100, Currency: "EUR"}).Add(&Money{Total: 50, Currency: "EUR"})
+		}, 150, nil},
+		{"add overflow", func() (*Money, error) {
+			return (&Money{Total: math.MaxInt64, Currency: "EUR"}).Add(&Money{Total: 1, Currency: "EUR"})
+		}, 0, ErrOverflow},
+		{"add underflow", func() (*Money, error) {
+			return (&Money{Total: math.MinInt64, Currency: "EUR"}).Add(&Money{Total: -1, Currency: "EUR"})
+		}, 0, ErrOverflow},
+		{"add mismatch", func() (*Money, error) {
+			return (&Money{Total: 1, Currency: "EUR"}).Add(&Money{Total: 1, Currency: "USD"})
+		}, 0, ErrCurrencyMismatch},
+		{"add unknown", func() (*Money, error) {
+			return (&Money{Total: 1, Currency: "XXY"}).Add(&Money{Total: 1, Currency: "XXY"})
+		}, 0, ErrUnknownCurrency},
+		{"subtract", func() (*Money, error) {
+			return (&Money{Total: 100, Currency: "EUR"}).Subtract(&Money{Total: 150, Currency: "EUR"})
+		}, -50, nil},
+		{"subtract overflow", func() (*Money, error) {
+			return (&Money{Total: math.MinInt64, Currency: "EUR"}).Subtract(&Money{Total: 1, Currency: "EUR"})
+		}, 0, ErrOverflow},
+		{"multiply", func() (*Money, error) { return (&Money{Total: -3, Currency: "EUR"}).Multiply(7) }, -21, nil},
+		{"multiply overflow", func() (*Money, error) {
+			return (&Money{Total: math.MaxInt64 / 2, Currency: "EUR"}).Multiply(3)
+		}, 0, ErrOverflow},
+		{"multiply min by -1", func() (*Money, error) {
+			return (&Money{Total: math.MinInt64, Currency: "EUR"}).Multiply(-1)
+		}, 0, ErrOverflow},
+		{"from major", func() (*Money, error) { return FromMajor(5, "EUR") }, 500, nil},
+		{"from major without minor unit", func() (*Money, error) { return FromMajor(5, "JPY") }, 5, nil},
+		{"from major overflow", func() (*Money, error) { return FromMajor(math.MaxInt64/10, "EUR") }, 0, ErrOverflow},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.op()
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+
+			if err == nil && got.Total != tc.want {
+				t.Errorf("expected %d, got %d", tc.want, got.Total)
+			}
+		})
+	}
+}
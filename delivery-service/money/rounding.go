@@ -0,0 +1,149 @@
+package money
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// RoundingMode determines what happens to the fraction of a base unit that is left over after a calculation. Money
+// cannot represent half a cent, so every calculation that divides must say which way it goes.
+type RoundingMode int
+
+const (
+	// RoundDown truncates toward zero; 1.7 becomes 1 and -1.7 becomes -1.
+	RoundDown RoundingMode = iota
+
+	// RoundUp rounds away from zero; 1.2 becomes 2 and -1.2 becomes -2.
+	RoundUp
+
+	// RoundHalfUp rounds to the nearest unit, with halves rounded away from zero; 2.5 becomes 3.
+	RoundHalfUp
+
+	// RoundHalfEven rounds to the nearest unit, with halves rounded to the nearest even unit; 2.5 becomes 2 and 3.5
+	// becomes 4. Also known as "bankers rounding".
+	RoundHalfEven
+)
+
+// BasisPoints is a percentage expressed in hundredths of a percent, so 12.5% is 1250. It allows fractional percentages
+// without floating point numbers.
+type BasisPoints int64
+
+// ApplyPercentage returns the given percentage of the amount, rounded with the supplied mode. For example, 20% VAT on
+// 590 cents is
+//
+//	m.ApplyPercentage(2000, RoundHalfUp) // 118
+func (m *Money) ApplyPercentage(bp BasisPoints, mode RoundingMode) (*Money, error) {
+	n := new(big.Int).Mul(big.NewInt(m.Total), big.NewInt(int64(bp)))
+
+	total, err := divide(n, big.NewInt(10_000), mode)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Money{Total: total, Currency: m.Currency}, nil
+}
+
+// Allocate splits the amount into parts according to the supplied ratios, without losing any base units. Any amount
+// that cannot be evenly divided is given, one unit at a time, to the first parts; parts with a ratio of zero are always
+// allocated nothing. For example, allocating 100 cents by 1:1:1 yields 34, 33 and 33, and 101 cents by 0:1:1 yields 0,
+// 51 and 50.
+func (m *Money) Allocate(ratios ...int64) ([]*Money, error) {
+	if len(ratios) == 0 {
+		return nil, fmt.Errorf("%w: no ratios supplied", ErrInvalidAllocation)
+	}
+
+	sum := new(big.Int)
+	for _, r := range ratios {
+		if r < 0 {
+			return nil, fmt.Errorf("%w: ratio %d is negative", ErrInvalidAllocation, r)
+		}
+
+		sum.Add(sum, big.NewInt(r))
+	}
+
+	if sum.Sign() == 0 {
+		return nil, fmt.Errorf("%w: ratios sum to zero", ErrInvalidAllocation)
+	}
+
+	parts := make([]*Money, len(ratios))
+	remainder := m.Total
+
+	for i, r := range ratios {
+		n := new(big.Int).Mul(big.NewInt(m.Total), big.NewInt(r))
+
+		// Each share is smaller in magnitude than the total, so this cannot overflow.
+		share, _ := divide(n, sum, RoundDown)
+
+		parts[i] = &Money{Total: share, Currency: m.Currency}
+		remainder -= share
+	}
+
+	// Truncation always leaves less than a single unit per part with a share, so the remainder can be handed out one
+	// unit at a time to those parts. Parts with a ratio of zero were allocated exactly nothing, so get nothing more.
+	step := int64(1)
+	if remainder < 0 {
+		step = -1
+	}
+
+	for i := 0; remainder != 0; i++ {
+		if ratios[i%len(parts)] == 0 {
+			continue
+		}
+
+		parts[i%len(parts)].Total += step
+		remainder -= step
+	}
+
+	return parts, nil
+}
+
+// Split divides the amount into n equal parts, as per Allocate.
+func (m *Money) Split(n int) ([]*Money, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("%w: cannot split into %d parts", ErrInvalidAllocation, n)
+	}
+
+	ratios := make([]int64, n)
+	for i := range ratios {
+		ratios[i] = 1
+	}
+
+	return m.Allocate(ratios...)
+}
+
+// divide divides n by a positive d, rounding as per the mode, and returns an error if the result does not fit.
+func divide(n, d *big.Int, mode RoundingMode) (int64, error) {
+	q, r := new(big.Int).QuoRem(n, d, new(big.Int))
+
+	if r.Sign() != 0 {
+		// The direction "away from zero" follows the sign of the numerator, as the denominator is positive.
+		away := big.NewInt(int64(n.Sign()))
+
+		// Compare twice the remainder against the denominator to find out if we're below, at or above the half.
+		half := new(big.Int).Abs(r)
+		half.Lsh(half, 1)
+		cmp := half.Cmp(d)
+
+		switch mode {
+		case RoundDown:
+		case RoundUp:
+			q.Add(q, away)
+		case RoundHalfUp:
+			if cmp >= 0 {
+				q.Add(q, away)
+			}
+		case RoundHalfEven:
+			if cmp > 0 || (cmp == 0 && q.Bit(0) == 1) {
+				q.Add(q, away)
+			}
+		default:
+			return 0, fmt.Errorf("%w: %d", ErrInvalidRoundingMode, mode)
+		}
+	}
+
+	if !q.IsInt64() {
+		return 0, fmt.Errorf("%w: %s", ErrOverflow, q)
+	}
+
+	return q.Int64(), nil
+}
@@ -0,0 +1,95 @@
+package money
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestApplyPercentage(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		total int64
+		bp    BasisPoints
+		mode  RoundingMode
+		want  int64
+		err   error
+	}{
+		{"exact", 590, 2000, RoundHalfUp, 118, nil},
+		{"down", 17, 1000, RoundDown, 1, nil},
+		{"down negative", -17, 1000, RoundDown, -1, nil},
+		{"up", 12, 1000, RoundUp, 2, nil},
+		{"up negative", -12, 1000, RoundUp, -2, nil},
+		{"half up", 25, 1000, RoundHalfUp, 3, nil},
+		{"half up below half", 24, 1000, RoundHalfUp, 2, nil},
+		{"half up negative", -25, 1000, RoundHalfUp, -3, nil},
+		{"half even rounds down to even", 25, 1000, RoundHalfEven, 2, nil},
+		{"half even rounds up to even", 35, 1000, RoundHalfEven, 4, nil},
+		{"half even above half", 26, 1000, RoundHalfEven, 3, nil},
+		{"half even negative", -25, 1000, RoundHalfEven, -2, nil},
+		{"markup", 1000, 11250, RoundHalfUp, 1125, nil},
+		{"overflow", math.MaxInt64, 20000, RoundHalfUp, 0, ErrOverflow},
+		{"unknown mode", 25, 1000, RoundingMode(42), 0, ErrInvalidRoundingMode},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := (&Money{Total: tc.total, Currency: "EUR"}).ApplyPercentage(tc.bp, tc.mode)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+
+			if err == nil && got.Total != tc.want {
+				t.Errorf("expected %d, got %d", tc.want, got.Total)
+			}
+		})
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		total  int64
+		ratios []int64
+		want   []int64
+		err    error
+	}{
+		{"even", 99, []int64{1, 1, 1}, []int64{33, 33, 33}, nil},
+		{"remainder to the first parts", 100, []int64{1, 1, 1}, []int64{34, 33, 33}, nil},
+		{"weighted", 100, []int64{70, 20, 10}, []int64{70, 20, 10}, nil},
+		{"weighted remainder", 5, []int64{3, 7}, []int64{2, 3}, nil},
+		{"zero ratio gets nothing", 101, []int64{0, 1, 1}, []int64{0, 51, 50}, nil},
+		{"zero ratio between", 2, []int64{1, 0, 1, 1}, []int64{1, 0, 1, 0}, nil},
+		{"negative", -100, []int64{1, 1, 1}, []int64{-34, -33, -33}, nil},
+		{"negative zero ratio", -101, []int64{1, 0, 1}, []int64{-51, 0, -50}, nil},
+		{"large", math.MaxInt64, []int64{1, 1}, []int64{math.MaxInt64/2 + 1, math.MaxInt64 / 2}, nil},
+		{"no ratios", 100, nil, nil, ErrInvalidAllocation},
+		{"negative ratio", 100, []int64{1, -1}, nil, ErrInvalidAllocation},
+		{"zero sum", 100, []int64{0, 0}, nil, ErrInvalidAllocation},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			parts, err := (&Money{Total: tc.total, Currency: "EUR"}).Allocate(tc.ratios...)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			got := make([]int64, len(parts))
+			for i, p := range parts {
+				got[i] = p.Total
+			}
+
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestSplit(t *testing.T) {
+	if _, err := (&Money{Total: 100, Currency: "EUR"}).Split(0); !errors.Is(err, ErrInvalidAllocation) {
+		t.Errorf("expected %v, got %v", ErrInvalidAllocation, err)
+	}
+}
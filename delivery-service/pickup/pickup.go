@@ -0,0 +1,225 @@
+// package pickup models the places, other than the recipients door, that a package can be delivered to. That
+// includes staffed pickup points (such as a kiosk) and unstaffed parcel lockers.
+package pickup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/geo"
+)
+
+var (
+	ErrFailedToLoad = errors.New("failed to load pickup points")
+	ErrInvalidPoint = errors.New("invalid pickup point")
+	ErrUnknownPoint = errors.New("unknown pickup point")
+	ErrPointFull    = errors.New("pickup point is full")
+)
+
+// DefaultRadius is how far (in meters) from the destination a pickup point can be, and still be considered nearby.
+const DefaultRadius = 10_000
+
+// Kind is the type of pickup point.
+type Kind string
+
+const (
+	// KindPoint is a staffed location, such as a kiosk or post office.
+	KindPoint Kind = "pickup-point"
+
+	// KindLocker is an unstaffed set of lockers, usually open at all hours.
+	KindLocker Kind = "locker"
+)
+
+// days are the keys that can be used in the opening hours.
+var days = map[string]bool{"mon": true, "tue": true, "wed": true, "thu": true, "fri": true, "sat": true, "sun": true}
+
+// Point is a place that a package can be delivered to, and the recipient picks it up from.
+type Point struct {
+	// ID uniquely identifies the point.
+	ID string `json:"id"`
+
+	// Kind is whether this is a staffed point, or a locker.
+	Kind Kind `json:"kind"`
+
+	// Carrier is the provider that operates the point. Only that provider can deliver to it.
+	Carrier string `json:"carrier"`
+
+	// Name is the name a person would recognise the point by.
+	Name string `json:"name"`
+
+	// Address is the street address of the point.
+	Address string `json:"address"`
+
+	// PostalCode is the five digit postal code of the point.
+	PostalCode string `json:"postal_code"`
+
+	// Latitude and Longitude are the location of the point, in degrees.
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+
+	// Hours are the opening hours, keyed by the three letter (English) day of the week, such as "mon". The value is
+	// a range, such as "09:00-18:00". Days that are not listed are closed.
+	Hours map[string]string `json:"hours"`
+
+	// Capacity is how many packages the point can hold at once. See Remaining.
+	Capacity int `json:"capacity"`
+
+	// MaxWidth, MaxHeight and MaxDepth are the largest package (in millimeters) that the point accepts, and
+	// MaxWeight the heaviest (in grams). Zero means no limit.
+	MaxWidth  int64 `json:"max_width,omitempty"`
+	MaxHeight int64 `json:"max_height,omitempty"`
+	MaxDepth  int64 `json:"max_depth,omitempty"`
+	MaxWeight int64 `json:"max_weight,omitempty"`
+
+	// held is the number of packages booked to the point. Collecting packages is not modelled, so it only grows (until
+	// the service restarts).
+	held atomic.Int64
+}
+
+// Remaining is how many more packages can be booked to the point.
+func (p *Point) Remaining() int {
+	return p.Capacity - int(p.held.Load())
+}
+
+// Accepts indicates whether a package of the given dimensions (in millimeters) and weight (in grams) fits the point,
+// and whether the point has room for it.
+func (p *Point) Accepts(width, height, depth, weight int64) bool {
+	if p.Remaining() <= 0 {
+		return false
+	}
+
+	within := func(v, max int64) bool { return max == 0 || v <= max }
+
+	return within(width, p.MaxWidth) &&
+		within(height, p.MaxHeight) &&
+		within(depth, p.MaxDepth) &&
+		within(weight, p.MaxWeight)
+}
+
+// validate checks the point is complete, and that the opening hours can be understood.
+func (p *Point) validate() error {
+	if p.ID == "" || p.Carrier == "" {
+		return fmt.Errorf("%w: id and carrier are required", ErrInvalidPoint)
+	}
+
+	if p.Kind != KindPoint && p.Kind != KindLocker {
+		return fmt.Errorf("%w: %s has unknown kind %q", ErrInvalidPoint, p.ID, p.Kind)
+	}
+
+	for day, hours := range p.Hours {
+		if !days[day] {
+			return fmt.Errorf("%w: %s has unknown day %q", ErrInvalidPoint, p.ID, day)
+		}
+
+		open, close, ok := strings.Cut(hours, "-")
+		if !ok {
+			return fmt.Errorf("%w: %s has malformed hours %q", ErrInvalidPoint, p.ID, hours)
+		}
+
+		for _, t := range []string{open, close} {
+			// 24:00 is valid as a closing time, but not understood by the time package.
+			if t == "24:00" {
+				continue
+			}
+
+			if _, err := time.Parse("15:04", t); err != nil {
+				return fmt.Errorf("%w: %s has malformed hours %q", ErrInvalidPoint, p.ID, hours)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Directory is the set of all known pickup points.
+type Directory struct {
+	points []*Point
+
+	// byID is the points, keyed by their ID.
+	byID map[string]*Point
+}
+
+// Load reads a list of pickup points from a JSON file on disk.
+func Load(path string) (*Directory, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFailedToLoad, err)
+	}
+	defer f.Close()
+
+	d := &Directory{byID: map[string]*Point{}}
+	if err := json.NewDecoder(f).Decode(&d.points); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFailedToLoad, err)
+	}
+
+	for _, p := range d.points {
+		if err := p.validate(); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrFailedToLoad, err)
+		}
+
+		if _, ok := d.byID[p.ID]; ok {
+			return nil, fmt.Errorf("%w: %w: %s is listed more than once", ErrFailedToLoad, ErrInvalidPoint, p.ID)
+		}
+
+		d.byID[p.ID] = p
+	}
+
+	return d, nil
+}
+
+// Hold takes up one of the places of the point, for a package booked to it. It fails if the point is full.
+func (d *Directory) Hold(id string) error {
+	p, ok := d.byID[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownPoint, id)
+	}
+
+	for {
+		held := p.held.Load()
+		if held >= int64(p.Capacity) {
+			return fmt.Errorf("%w: %s", ErrPointFull, id)
+		}
+
+		if p.held.CompareAndSwap(held, held+1) {
+			return nil
+		}
+	}
+}
+
+// Release frees a place held (with Hold) for a package that was not booked to the point after all.
+func (d *Directory) Release(id string) {
+	if p, ok := d.byID[id]; ok {
+		p.held.Add(-1)
+	}
+}
+
+// Near returns the points within the radius (in meters) of the postal code, closest first.
+func (d *Directory) Near(postalCode string, radius float64) ([]*Point, error) {
+	origin, err := geo.Locate(postalCode)
+	if err != nil {
+		return nil, err
+	}
+
+	distances := map[*Point]float64{}
+	near := []*Point{}
+
+	for _, p := range d.points {
+		dist := origin.DistanceTo(geo.Point{Latitude: p.Latitude, Longitude: p.Longitude})
+		if dist > radius {
+			continue
+		}
+
+		distances[p] = dist
+		near = append(near, p)
+	}
+
+	sort.SliceStable(near, func(i, j int) bool { return distances[near[i]] < distances[near[j]] })
+
+	return near, nil
+}
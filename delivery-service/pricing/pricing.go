@@ -0,0 +1,98 @@
+// package pricing adjusts what the carriers charge before it is offered to clients; for example, adding a margin to
+// one provider, or discounting a mode of transport that should be encouraged.
+package pricing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/carriers"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/money"
+)
+
+var (
+	ErrInvalidRule = errors.New("invalid pricing rule")
+)
+
+// Rule adjusts the cost of the options it matches.
+type Rule struct {
+	// Provider and Mode restrict the rule to options from that provider, and by that mode of transport. If empty, the
+	// rule matches any.
+	Provider string                 `json:"provider,omitempty"`
+	Mode     carriers.TransportMode `json:"mode,omitempty"`
+
+	// Markup is added to (or, if negative, taken from) the cost, in basis points of the cost; 1250 adds 12.5%.
+	Markup money.BasisPoints `json:"markup"`
+}
+
+// Matches returns whether the rule applies to the option.
+func (r *Rule) Matches(opt *carriers.DeliveryOption) bool {
+	return (r.Provider == "" || r.Provider == opt.Provider) && (r.Mode == "" || r.Mode == opt.Mode)
+}
+
+// Validate checks that the rule does not make options free (or pay clients to book them).
+func (r *Rule) Validate() error {
+	if r.Markup <= -10_000 {
+		return fmt.Errorf("%w: a markup of %d basis points leaves nothing to charge", ErrInvalidRule, r.Markup)
+	}
+
+	return nil
+}
+
+// Rules are applied in order, such that each rule adjusts the cost as adjusted by the rules before it.
+type Rules []Rule
+
+// Apply adjusts the cost of the option by each rule that matches it, rounding half up.
+func (rs Rules) Apply(opt *carriers.DeliveryOption) error {
+	for i := range rs {
+		if !rs[i].Matches(opt) || opt.Cost == nil {
+			continue
+		}
+
+		cost, err := opt.Cost.ApplyPercentage(10_000+rs[i].Markup, money.RoundHalfUp)
+		if err != nil {
+			return err
+		}
+
+		opt.Cost = cost
+	}
+
+	return nil
+}
+
+// Middleware applies the rules to every option returned by each carrier, before any other middleware (outside of it)
+// sees them.
+func Middleware(rs Rules) carriers.Middleware {
+	return carriers.Middleware{
+		Name: "pricing",
+		Wrap: func(c carriers.Carrier) carriers.Carrier {
+			return &priced{Decorator: carriers.Decorator{Carrier: c}, rules: rs}
+		},
+	}
+}
+
+type priced struct {
+	carriers.Decorator
+
+	rules Rules
+}
+
+func (p *priced) Query(pkg *carriers.Package) ([]*carriers.DeliveryOption, error) {
+	return p.QueryContext(context.Background(), pkg)
+}
+
+func (p *priced) QueryContext(ctx context.Context, pkg *carriers.Package) ([]*carriers.DeliveryOption, error) {
+	opts, err := p.Decorator.QueryContext(ctx, pkg)
+	if err != nil {
+		return opts, err
+	}
+
+	for _, o := range opts {
+		if err := p.rules.Apply(o); err != nil {
+			return nil, err
+		}
+	}
+
+	return opts, nil
+}
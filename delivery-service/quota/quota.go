@@ -0,0 +1,377 @@
+// package quota limits how often each carrier is queried, such that the quotas their APIs enforce are not exceeded.
+// Each carrier has a token bucket, refilled at a number of requests per second, and a number of requests it can be
+// sent each (UTC) day. Carriers that have exhausted either are excluded from queries, rather than failing them.
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/carriers"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/clock"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+var (
+	ErrFailedToApplyOption   = errors.New("failed to apply option")
+	ErrFailedToCreateMetrics = errors.New("failed to create metric from provider")
+	ErrInvalidLimit          = errors.New("invalid limit")
+)
+
+// Limit is how often a single carrier can be queried.
+type Limit struct {
+	// Provider is the carrier that is limited.
+	Provider string
+
+	// Rate is the number of requests per second the carrier can be sent, on average. If zero, it is not limited.
+	Rate float64
+
+	// Burst is the number of requests that can be sent at once, after the carrier has not been queried for a while. If
+	// zero, it is the Rate (rounded up), or 1.
+	Burst int
+
+	// Daily is the number of requests the carrier can be sent each day, starting at midnight UTC. If zero, it is not
+	// limited.
+	Daily int64
+
+	// Queue is how long a query waits for the rate to allow it, before the carrier is excluded instead. If zero, queries
+	// do not wait. Queries never wait for the daily quota.
+	Queue time.Duration
+}
+
+// Validate checks the limit can be enforced.
+func (l *Limit) Validate() error {
+	switch {
+	case l.Provider == "":
+		return fmt.Errorf("%w: limits must have a provider", ErrInvalidLimit)
+	case l.Rate < 0 || math.IsInf(l.Rate, 0) || math.IsNaN(l.Rate):
+		return fmt.Errorf("%w: %s: rate must be a positive number of requests per second", ErrInvalidLimit, l.Provider)
+	case l.Burst < 0 || l.Daily < 0 || l.Queue < 0:
+		return fmt.Errorf("%w: %s: burst, daily and queue cannot be negative", ErrInvalidLimit, l.Provider)
+	}
+
+	return nil
+}
+
+// burst is the capacity of the bucket.
+func (l *Limit) burst() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+
+	return math.Max(1, math.Ceil(l.Rate))
+}
+
+// bucket is what a carrier has used of its limit.
+type bucket struct {
+	// tokens are the requests that can be sent now. It is negative while queries are queued for the rate.
+	tokens float64
+	last   time.Time
+
+	// used is the number of requests sent on day.
+	day  time.Time
+	used int64
+
+	// exhausted is the limit (rate or daily) the carrier was last excluded by, until it is queried again.
+	exhausted string
+}
+
+// refill adds the tokens accumulated since the bucket was last used, and resets the daily quota if the day changed.
+func (b *bucket) refill(l *Limit, now time.Time) {
+	b.tokens = math.Min(l.burst(), b.tokens+now.Sub(b.last).Seconds()*l.Rate)
+	b.last = now
+
+	if day := now.UTC().Truncate(24 * time.Hour); !day.Equal(b.day) {
+		b.day, b.used = day, 0
+	}
+}
+
+type Option func(l *Limiter) error
+
+var Defaults = []Option{
+	WithMeter(otel.Meter("github.com/andrewhowdencom/courses.pito/delivery-service/quota")),
+}
+
+// Limiter enforces the limits of each carrier. It outlives the carriers it limits, such that what was used of each
+// quota is kept when the carriers (or their limits) are replaced; see Set.
+type Limiter struct {
+	opts struct {
+		m   metric.Meter
+		log *slog.Logger
+	}
+
+	metrics struct {
+		exhausted metric.Int64Counter
+	}
+
+	mu      sync.Mutex
+	limits  map[string]Limit
+	buckets map[string]*bucket
+
+	clock clock.Clock
+}
+
+// New creates a limiter, without any limits. As with the carriers, the default options should be extended when this
+// function is used.
+func New(opts ...Option) (*Limiter, error) {
+	l := &Limiter{
+		limits:  map[string]Limit{},
+		buckets: map[string]*bucket{},
+	}
+
+	for _, o := range opts {
+		if err := o(l); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrFailedToApplyOption, err)
+		}
+	}
+
+	l.clock = clock.Or(l.clock)
+
+	// If there is no meter, add one so we're safe.
+	if l.opts.m == nil {
+		l.opts.m = noop.NewMeterProvider().Meter("noop")
+	}
+
+	if l.opts.log == nil {
+		l.opts.log = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+
+	var err error
+	if l.metrics.exhausted, err = l.opts.m.Int64Counter(
+		"carrier.quota.exhausted",
+		metric.WithDescription("Queries a carrier was excluded from, by provider and the limit (rate or daily) it exceeded"),
+	); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFailedToCreateMetrics, err)
+	}
+
+	if _, err = l.opts.m.Int64ObservableGauge(
+		"carrier.quota.remaining",
+		metric.WithDescription("The requests each carrier with a daily quota can still be sent today, by provider"),
+		metric.WithInt64Callback(l.observeRemaining),
+	); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFailedToCreateMetrics, err)
+	}
+
+	return l, nil
+}
+
+// WithMeter applies a specific meter provider to the limiter. Used mostly in testing.
+func WithMeter(m metric.Meter) Option {
+	return func(l *Limiter) error {
+		l.opts.m = m
+
+		return nil
+	}
+}
+
+// WithLogger sets the logger that carriers being excluded by (and queried again after) their limit are logged to.
+func WithLogger(log *slog.Logger) Option {
+	return func(l *Limiter) error {
+		l.opts.log = log
+
+		return nil
+	}
+}
+
+// WithClock sets the clock that the rate is measured, and queued queries wait, with.
+func WithClock(c clock.Clock) Option {
+	return func(l *Limiter) error {
+		l.clock = c
+
+		return nil
+	}
+}
+
+// Set replaces the limits. What each carrier has already used is kept; a carrier that was not limited before starts
+// with a full bucket, and its whole daily quota.
+func (l *Limiter) Set(limits []Limit) error {
+	next := make(map[string]Limit, len(limits))
+	for i := range limits {
+		if err := limits[i].Validate(); err != nil {
+			return err
+		}
+
+		next[limits[i].Provider] = limits[i]
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	for p, lim := range next {
+		b, ok := l.buckets[p]
+		if !ok {
+			l.buckets[p] = &bucket{tokens: lim.burst(), last: now, day: now.UTC().Truncate(24 * time.Hour)}
+			continue
+		}
+
+		b.refill(&lim, now)
+	}
+
+	for p := range l.buckets {
+		if _, ok := next[p]; !ok {
+			delete(l.buckets, p)
+		}
+	}
+
+	l.limits = next
+
+	return nil
+}
+
+// Remaining returns the requests the carrier can still be sent today, and whether it has a daily quota at all.
+func (l *Limiter) Remaining(provider string) (int64, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lim, ok := l.limits[provider]
+	if !ok || lim.Daily == 0 {
+		return 0, false
+	}
+
+	b := l.buckets[provider]
+	b.refill(&lim, l.clock.Now())
+
+	return lim.Daily - b.used, true
+}
+
+// reserve takes a request from the limit of the carrier, returning how long the query must wait for the rate to allow
+// it, and the day it counts towards. If the carrier cannot be queried, the error is (wrapped) carriers.ErrExcluded.
+func (l *Limiter) reserve(ctx context.Context, provider string) (time.Duration, time.Time, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lim, ok := l.limits[provider]
+	if !ok {
+		return 0, time.Time{}, nil
+	}
+
+	b := l.buckets[provider]
+	b.refill(&lim, l.clock.Now())
+
+	if lim.Daily > 0 && b.used >= lim.Daily {
+		return 0, time.Time{}, l.exclude(ctx, provider, b, "daily", fmt.Errorf("%w: daily quota of %d requests exhausted", carriers.ErrExcluded, lim.Daily))
+	}
+
+	var wait time.Duration
+	if lim.Rate > 0 {
+		if b.tokens < 1 {
+			wait = time.Duration((1 - b.tokens) / lim.Rate * float64(time.Second))
+		}
+
+		if wait > lim.Queue {
+			return 0, time.Time{}, l.exclude(ctx, provider, b, "rate", fmt.Errorf("%w: rate limit of %g requests per second exceeded", carriers.ErrExcluded, lim.Rate))
+		}
+
+		// The token is taken now, even if the query must wait for it, such that queries queued after it wait longer.
+		b.tokens--
+	}
+
+	b.used++
+
+	if b.exhausted != "" {
+		l.opts.log.InfoContext(ctx, "carrier queried again, after it was excluded by its limit", "provider", provider, "limit", b.exhausted)
+		b.exhausted = ""
+	}
+
+	return wait, b.day, nil
+}
+
+// exclude counts the carrier as excluded by the limit, and returns err. The first time the carrier is excluded by the
+// limit (until it is queried again) it is logged, such that the reason it is missing from responses is seen without
+// the quote log, and without a log line for every query it misses.
+func (l *Limiter) exclude(ctx context.Context, provider string, b *bucket, limit string, err error) error {
+	l.metrics.exhausted.Add(ctx, 1, metric.WithAttributes(append(carriers.AttributesFromContext(ctx), attribute.String("provider", provider), attribute.String("limit", limit))...))
+
+	if b.exhausted != limit {
+		l.opts.log.WarnContext(ctx, "carrier excluded from queries by its limit", "provider", provider, "limit", limit, "reason", err)
+		b.exhausted = limit
+	}
+
+	return err
+}
+
+// release returns a request reserved (on the day) by a query that was abandoned while it waited. If the day has since
+// changed, the request no longer counts towards the daily quota, so only its token is returned.
+func (l *Limiter) release(provider string, day time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lim, ok := l.limits[provider]
+	if !ok {
+		return
+	}
+
+	b := l.buckets[provider]
+	b.refill(&lim, l.clock.Now())
+	b.tokens = math.Min(lim.burst(), b.tokens+1)
+
+	if b.day.Equal(day) && b.used > 0 {
+		b.used--
+	}
+}
+
+func (l *Limiter) observeRemaining(_ context.Context, o metric.Int64Observer) error {
+	l.mu.Lock()
+	providers := make([]string, 0, len(l.limits))
+	for p := range l.limits {
+		providers = append(providers, p)
+	}
+	l.mu.Unlock()
+
+	for _, p := range providers {
+		if n, ok := l.Remaining(p); ok {
+			o.Observe(n, metric.WithAttributes(attribute.String("provider", p)))
+		}
+	}
+
+	return nil
+}
+
+// Middleware limits each carrier to the limit of its provider (if it has one); excluding it from queries once the
+// limit is exhausted, or queueing them for as long as the limit allows.
+func (l *Limiter) Middleware() carriers.Middleware {
+	return carriers.Middleware{
+		Name: "quota",
+		Wrap: func(c carriers.Carrier) carriers.Carrier {
+			return &limited{Decorator: carriers.Decorator{Carrier: c}, limiter: l}
+		},
+	}
+}
+
+type limited struct {
+	carriers.Decorator
+
+	limiter *Limiter
+}
+
+func (q *limited) Query(pkg *carriers.Package) ([]*carriers.DeliveryOption, error) {
+	return q.QueryContext(context.Background(), pkg)
+}
+
+func (q *limited) QueryContext(ctx context.Context, pkg *carriers.Package) ([]*carriers.DeliveryOption, error) {
+	provider := q.ProviderName()
+
+	wait, day, err := q.limiter.reserve(ctx, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	if wait > 0 {
+		if err := clock.SleepContext(ctx, q.limiter.clock, wait); err != nil {
+			q.limiter.release(provider, day)
+			return nil, err
+		}
+	}
+
+	return q.Decorator.QueryContext(ctx, pkg)
+}
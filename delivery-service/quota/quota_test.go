@@ -0,0 +1,306 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/carriers"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/clock"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/money"
+)
+
+// fake is a carrier that quotes a single option, and counts how often it is queried.
+type fake struct {
+	queries atomic.Int64
+}
+
+func (f *fake) Query(pkg *carriers.Package) ([]*carriers.DeliveryOption, error) {
+	f.queries.Add(1)
+
+	return []*carriers.DeliveryOption{{Provider: "svx", Cost: &money.Money{Total: 590, Currency: "EUR"}}}, nil
+}
+
+func (f *fake) ProviderName() string {
+	return "svx"
+}
+
+// newLimited returns a limiter with the limit, the clock it tells the time with, and a carrier wrapped in it.
+func newLimited(t *testing.T, start time.Time, lim Limit) (*Limiter, *clock.Fake, *fake, carriers.Carrier) {
+	t.Helper()
+
+	clk := clock.NewFake(start)
+
+	l, err := New(WithClock(clk))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.Set([]Limit{lim}); err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fake{}
+
+	return l, clk, f, l.Middleware().Wrap(f)
+}
+
+// query queries the carrier, returning only whether it failed.
+func query(ctx context.Context, c carriers.Carrier) error {
+	_, err := carriers.QueryContext(ctx, c, &carriers.Package{})
+
+	return err
+}
+
+func waitForWaiters(f *clock.Fake, n int) {
+	for f.Waiters() < n {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+var noon = time.Date(2023, 9, 9, 12, 0, 0, 0, time.UTC)
+
+func TestBurst(t *testing.T) {
+	_, _, f, c := newLimited(t, noon, Limit{Provider: "svx", Rate: 1, Burst: 3})
+
+	for i := 0; i < 3; i++ {
+		if err := query(context.Background(), c); err != nil {
+			t.Fatalf("expected query %d of the burst to be allowed, got %v", i, err)
+		}
+	}
+
+	if err := query(context.Background(), c); !errors.Is(err, carriers.ErrExcluded) {
+		t.Errorf("expected %v once the burst is used, got %v", carriers.ErrExcluded, err)
+	}
+
+	if n := f.queries.Load(); n != 3 {
+		t.Errorf("expected the carrier to be queried 3 times, got %d", n)
+	}
+}
+
+func TestRefill(t *testing.T) {
+	_, clk, f, c := newLimited(t, noon, Limit{Provider: "svx", Rate: 2, Burst: 1})
+
+	for _, tc := range []struct {
+		advance time.Duration
+		allowed bool
+	}{
+		{0, true},
+		{0, false},
+
+		// A token is added every 500ms, at the rate of 2 per second.
+		{250 * time.Millisecond, false},
+		{250 * time.Millisecond, true},
+		{499 * time.Millisecond, false},
+		{time.Millisecond, true},
+
+		// No more tokens are kept than the burst, however long the carrier is not queried.
+		{time.Hour, true},
+		{0, false},
+	} {
+		clk.Advance(tc.advance)
+
+		err := query(context.Background(), c)
+		if tc.allowed && err != nil {
+			t.Errorf("%s: expected the query to be allowed, got %v", clk.Now().Format(time.StampMilli), err)
+		}
+
+		if !tc.allowed && !errors.Is(err, carriers.ErrExcluded) {
+			t.Errorf("%s: expected %v, got %v", clk.Now().Format(time.StampMilli), carriers.ErrExcluded, err)
+		}
+	}
+
+	if n := f.queries.Load(); n != 4 {
+		t.Errorf("expected the carrier to be queried 4 times, got %d", n)
+	}
+}
+
+func TestQueue(t *testing.T) {
+	_, clk, f, c := newLimited(t, noon, Limit{Provider: "svx", Rate: 1, Burst: 1, Queue: 2 * time.Second})
+
+	if err := query(context.Background(), c); err != nil {
+		t.Fatal(err)
+	}
+
+	// The next queries wait 1s and 2s for their token; the one after would wait 3s, so is excluded instead.
+	first, second := make(chan error, 1), make(chan error, 1)
+
+	go func() { first <- query(context.Background(), c) }()
+	waitForWaiters(clk, 1)
+
+	go func() { second <- query(context.Background(), c) }()
+	waitForWaiters(clk, 2)
+
+	if err := query(context.Background(), c); !errors.Is(err, carriers.ErrExcluded) {
+		t.Errorf("expected %v past the queue, got %v", carriers.ErrExcluded, err)
+	}
+
+	clk.Advance(time.Second)
+
+	if err := <-first; err != nil {
+		t.Errorf("expected the first queued query to be allowed, got %v", err)
+	}
+
+	select {
+	case err := <-second:
+		t.Fatalf("expected the second queued query to still wait, got %v", err)
+	default:
+	}
+
+	clk.Advance(time.Second)
+
+	if err := <-second; err != nil {
+		t.Errorf("expected the second queued query to be allowed, got %v", err)
+	}
+
+	if n := f.queries.Load(); n != 3 {
+		t.Errorf("expected the carrier to be queried 3 times, got %d", n)
+	}
+}
+
+func TestDaily(t *testing.T) {
+	// An hour before midnight UTC; but not in the zone of the clock.
+	start := time.Date(2023, 9, 10, 1, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	l, clk, _, c := newLimited(t, start, Limit{Provider: "svx", Daily: 2})
+
+	for i := 0; i < 2; i++ {
+		if err := query(context.Background(), c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := query(context.Background(), c); !errors.Is(err, carriers.ErrExcluded) {
+		t.Errorf("expected %v once the quota is used, got %v", carriers.ErrExcluded, err)
+	}
+
+	if n, ok := l.Remaining("svx"); !ok || n != 0 {
+		t.Errorf("expected 0 requests to remain, got %d (%v)", n, ok)
+	}
+
+	clk.Advance(time.Hour - time.Nanosecond)
+
+	if err := query(context.Background(), c); !errors.Is(err, carriers.ErrExcluded) {
+		t.Errorf("expected %v until midnight UTC, got %v", carriers.ErrExcluded, err)
+	}
+
+	clk.Advance(time.Nanosecond)
+
+	if err := query(context.Background(), c); err != nil {
+		t.Errorf("expected the quota to be reset at midnight UTC, got %v", err)
+	}
+
+	if n, ok := l.Remaining("svx"); !ok || n != 1 {
+		t.Errorf("expected 1 request to remain, got %d (%v)", n, ok)
+	}
+}
+
+func TestRelease(t *testing.T) {
+	t.Run("abandoned while queued", func(t *testing.T) {
+		l, clk, f, c := newLimited(t, noon, Limit{Provider: "svx", Rate: 1, Burst: 1, Daily: 10, Queue: time.Second})
+
+		if err := query(context.Background(), c); err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+
+		go func() { done <- query(ctx, c) }()
+		waitForWaiters(clk, 1)
+		cancel()
+
+		if err := <-done; !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected %v, got %v", context.Canceled, err)
+		}
+
+		// The abandoned query gave back both its token and its request of the day.
+		if n, _ := l.Remaining("svx"); n != 9 {
+			t.Errorf("expected 9 requests to remain, got %d", n)
+		}
+
+		if b := l.buckets["svx"]; b.tokens != 0 {
+			t.Errorf("expected the token to be given back, got %v tokens", b.tokens)
+		}
+
+		if n := f.queries.Load(); n != 1 {
+			t.Errorf("expected the carrier to be queried once, got %d", n)
+		}
+	})
+
+	t.Run("after midnight", func(t *testing.T) {
+		l, clk, _, _ := newLimited(t, time.Date(2023, 9, 9, 23, 59, 59, 0, time.UTC), Limit{Provider: "svx", Daily: 10})
+
+		_, yesterday, err := l.reserve(context.Background(), "svx")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		clk.Advance(time.Second)
+
+		_, today, err := l.reserve(context.Background(), "svx")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The request of yesterday does not count towards today, so is not given back from it.
+		l.release("svx", yesterday)
+
+		if n, _ := l.Remaining("svx"); n != 9 {
+			t.Errorf("expected 9 requests to remain, got %d", n)
+		}
+
+		l.release("svx", today)
+
+		if n, _ := l.Remaining("svx"); n != 10 {
+			t.Errorf("expected 10 requests to remain, got %d", n)
+		}
+	})
+}
+
+func TestSet(t *testing.T) {
+	l, _, _, c := newLimited(t, noon, Limit{Provider: "svx", Daily: 5})
+
+	for i := 0; i < 2; i++ {
+		if err := query(context.Background(), c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// What was used is kept when the limit changes, and carriers that were not limited start with their whole quota.
+	if err := l.Set([]Limit{{Provider: "svx", Daily: 10}, {Provider: "mmc", Daily: 3}}); err != nil {
+		t.Fatal(err)
+	}
+
+	for p, want := range map[string]int64{"svx": 8, "mmc": 3} {
+		if n, ok := l.Remaining(p); !ok || n != want {
+			t.Errorf("%s: expected %d requests to remain, got %d (%v)", p, want, n, ok)
+		}
+	}
+
+	// A single invalid limit rejects them all, leaving the limits as they were.
+	err := l.Set([]Limit{{Provider: "svx", Daily: 1}, {Provider: "mmc", Rate: -1}})
+	if !errors.Is(err, ErrInvalidLimit) {
+		t.Errorf("expected %v, got %v", ErrInvalidLimit, err)
+	}
+
+	for p, want := range map[string]int64{"svx": 8, "mmc": 3} {
+		if n, ok := l.Remaining(p); !ok || n != want {
+			t.Errorf("%s: expected %d requests to remain, got %d (%v)", p, want, n, ok)
+		}
+	}
+
+	// Carriers without a limit are no longer limited.
+	if err := l.Set([]Limit{{Provider: "mmc", Daily: 3}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := l.Remaining("svx"); ok {
+		t.Errorf("expected svx to no longer be limited")
+	}
+
+	if err := query(context.Background(), c); err != nil {
+		t.Errorf("expected svx to be queried without a limit, got %v", err)
+	}
+}
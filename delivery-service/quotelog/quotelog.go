@@ -0,0 +1,244 @@
+// package quotelog records every set of delivery options served to a client, such that what was quoted can be
+// analysed later. Entries are appended to a file as newline delimited JSON which is rotated once it grows too large,
+// keeping a fixed number of older files.
+package quotelog
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/carriers"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/money"
+)
+
+var (
+	ErrFailedToOpen   = errors.New("failed to open quote log")
+	ErrFailedToAppend = errors.New("failed to append to quote log")
+	ErrFailedToRead   = errors.New("failed to read quote log")
+)
+
+const (
+	// DefaultMaxSize is the size (in bytes) after which the log is rotated.
+	DefaultMaxSize = 64 * 1024 * 1024
+
+	// DefaultMaxBackups is the number of rotated files that are kept. Older files are removed.
+	DefaultMaxBackups = 5
+)
+
+// Option is a single option served to the client.
+type Option struct {
+	QuoteID  string       `json:"quote_id,omitempty"`
+	Provider string       `json:"provider"`
+	Cost     *money.Money `json:"cost"`
+	Arrival  time.Time    `json:"arrival"`
+
+	Mode          carriers.TransportMode `json:"mode,omitempty"`
+	PickupPointID string                 `json:"pickup_point_id,omitempty"`
+}
+
+// Entry is a single request for delivery options. Requests without any options are recorded too, with no options.
+type Entry struct {
+	Time    time.Time         `json:"time"`
+	Package *carriers.Package `json:"package"`
+
+	// Options are the options served, after any filtering requested by the client.
+	Options []Option `json:"options"`
+
+	// Outcomes are what each carrier returned, before any filtering.
+	Outcomes []carriers.Outcome `json:"outcomes"`
+}
+
+// NewEntry creates the entry for the options served for the package, at the supplied time.
+func NewEntry(pkg *carriers.Package, opts []*carriers.DeliveryOption, outcomes []carriers.Outcome, at time.Time) *Entry {
+	e := &Entry{
+		Time:     at.UTC(),
+		Package:  pkg,
+		Options:  make([]Option, 0, len(opts)),
+		Outcomes: outcomes,
+	}
+
+	for _, o := range opts {
+		// Only the cost as quoted is recorded; not the version formatted for a specific client.
+		cost := *o.Cost
+		cost.Display = ""
+
+		lo := Option{
+			QuoteID:  o.QuoteID,
+			Provider: o.Provider,
+			Cost:     &cost,
+			Arrival:  o.Arrival,
+			Mode:     o.Mode,
+		}
+
+		if o.PickupPoint != nil {
+			lo.PickupPointID = o.PickupPoint.ID
+		}
+
+		e.Options = append(e.Options, lo)
+	}
+
+	return e
+}
+
+// Log appends entries to a file, rotating it as it grows. The current file is at the path; rotated files have a
+// number appended, with ".1" the most recent.
+type Log struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// Open opens (or creates) the log at the path. It is rotated once it exceeds maxSize bytes, keeping maxBackups older
+// files.
+func Open(path string, maxSize int64, maxBackups int) (*Log, error) {
+	l := &Log{path: path, maxSize: maxSize, maxBackups: maxBackups}
+
+	if err := l.open(); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFailedToOpen, err)
+	}
+
+	return l, nil
+}
+
+// Append writes the entry to the log, rotating it first if the entry would take it past the maximum size.
+func (l *Log) Append(e *Entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrFailedToAppend, err)
+	}
+
+	b = append(b, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.size > 0 && l.size+int64(len(b)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return fmt.Errorf("%w: %s", ErrFailedToAppend, err)
+		}
+	}
+
+	n, err := l.f.Write(b)
+	l.size += int64(n)
+
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrFailedToAppend, err)
+	}
+
+	return nil
+}
+
+// Close closes the current file.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.f.Close()
+}
+
+// open opens the current file for appending. The lock must be held (or the log not yet shared).
+func (l *Log) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	l.f = f
+	l.size = fi.Size()
+
+	return nil
+}
+
+// rotate shifts each file along by one (removing the oldest), and starts a new current file. The lock must be held.
+func (l *Log) rotate() error {
+	if err := l.f.Close(); err != nil {
+		return err
+	}
+
+	// Hint: Failing to remove the oldest file is not a problem; it is overwritten below.
+	os.Remove(backup(l.path, l.maxBackups))
+
+	for i := l.maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(backup(l.path, i), backup(l.path, i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	if l.maxBackups > 0 {
+		if err := os.Rename(l.path, backup(l.path, 1)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(l.path); err != nil {
+		return err
+	}
+
+	return l.open()
+}
+
+// Read calls the function for every entry in the log at the path, oldest first; the rotated files (up to maxBackups),
+// and then the current file. Files that do not exist are skipped.
+func Read(path string, maxBackups int, fn func(e *Entry) error) error {
+	paths := make([]string, 0, maxBackups+1)
+	for i := maxBackups; i >= 1; i-- {
+		paths = append(paths, backup(path, i))
+	}
+
+	paths = append(paths, path)
+
+	for _, p := range paths {
+		if err := read(p, fn); err != nil {
+			return fmt.Errorf("%w: %s: %s", ErrFailedToRead, p, err)
+		}
+	}
+
+	return nil
+}
+
+// read calls the function for every entry in a single file.
+func read(path string, fn func(e *Entry) error) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for sc.Scan() {
+		e := &Entry{}
+		if err := json.Unmarshal(sc.Bytes(), e); err != nil {
+			return err
+		}
+
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	return sc.Err()
+}
+
+// backup is the path of the nth rotated file.
+func backup(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
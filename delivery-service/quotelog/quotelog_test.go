@@ -0,0 +1,138 @@
+package quotelog
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/carriers"
+)
+
+var start = time.Date(2023, 9, 9, 12, 0, 0, 0, time.UTC)
+
+// entry is the nth entry appended in the tests; they are told apart by their time.
+func entry(n int) *Entry {
+	return &Entry{Time: start.Add(time.Duration(n) * time.Second), Package: &carriers.Package{Weight: 1000}}
+}
+
+func TestRotate(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		maxSize    int64
+		maxBackups int
+
+		// read are the entries that are read back, oldest first, and files the rotated files that exist.
+		read  []int
+		files []string
+	}{
+		{"not rotated", 1024 * 1024, 2, []int{0, 1, 2, 3, 4}, nil},
+		{"rotated, keeping some", 1, 2, []int{2, 3, 4}, []string{".1", ".2"}},
+		{"rotated, keeping one", 1, 1, []int{3, 4}, []string{".1"}},
+		{"rotated, keeping none", 1, 0, []int{4}, nil},
+		{"rotated, keeping more than there are", 1, 10, []int{0, 1, 2, 3, 4}, []string{".1", ".2", ".3", ".4"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "quotes.ndjson")
+
+			// The log is closed and opened again part way through, such that it continues from the size of the file.
+			for _, batch := range [][]int{{0, 1, 2}, {3, 4}} {
+				l, err := Open(path, tc.maxSize, tc.maxBackups)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				for _, n := range batch {
+					if err := l.Append(entry(n)); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				if err := l.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			read := []int{}
+			if err := Read(path, tc.maxBackups, func(e *Entry) error {
+				read = append(read, int(e.Time.Sub(start)/time.Second))
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			if !slices.Equal(read, tc.read) {
+				t.Errorf("expected entries %v, got %v", tc.read, read)
+			}
+
+			matches, err := filepath.Glob(path + ".*")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			files := []string{}
+			for _, m := range matches {
+				files = append(files, m[len(path):])
+			}
+
+			if !slices.Equal(files, tc.files) {
+				t.Errorf("expected rotated files %v, got %v", tc.files, files)
+			}
+		})
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("no log", func(t *testing.T) {
+		if err := Read(filepath.Join(dir, "missing.ndjson"), DefaultMaxBackups, func(*Entry) error { return nil }); err != nil {
+			t.Errorf("expected a log that does not exist to be empty, got %v", err)
+		}
+	})
+
+	t.Run("malformed entry", func(t *testing.T) {
+		path := filepath.Join(dir, "malformed.ndjson")
+		if err := os.WriteFile(path, []byte("{\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := Read(path, 0, func(*Entry) error { return nil }); !errors.Is(err, ErrFailedToRead) {
+			t.Errorf("expected %v, got %v", ErrFailedToRead, err)
+		}
+	})
+
+	t.Run("stopped by the function", func(t *testing.T) {
+		path := filepath.Join(dir, "stopped.ndjson")
+
+		l, err := Open(path, DefaultMaxSize, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for n := 0; n < 3; n++ {
+			if err := l.Append(entry(n)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		l.Close()
+
+		stop := errors.New("stop")
+
+		var read int
+		err = Read(path, 0, func(*Entry) error {
+			if read++; read == 2 {
+				return stop
+			}
+
+			return nil
+		})
+
+		if !errors.Is(err, ErrFailedToRead) || read != 2 {
+			t.Errorf("expected to stop after 2 entries with %v, got %v after %d", ErrFailedToRead, err, read)
+		}
+	})
+}
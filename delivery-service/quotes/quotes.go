@@ -0,0 +1,300 @@
+// package quotes keeps track of the delivery options that have been offered to clients, such that they can later be
+// booked.
+package quotes
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/carriers"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/clock"
+)
+
+var (
+	ErrNotFound      = errors.New("quote not found")
+	ErrExpired       = errors.New("quote expired")
+	ErrAlreadyBooked = errors.New("quote already booked")
+	ErrFailedToOpen  = errors.New("failed to open quote store")
+	ErrFailedToSave  = errors.New("failed to save quote")
+)
+
+// Option modifies the store as it is opened.
+type Option func(s *Store) error
+
+// DefaultTTL is how long a quote can be booked for, after it was offered.
+const DefaultTTL = 15 * time.Minute
+
+// DefaultRetention is how long quotes are kept after they expire, booked or not. Booked quotes can be shipped until
+// then; see WithRetention.
+const DefaultRetention = 24 * time.Hour
+
+// pruneInterval is how often (at most) the quotes whose retention has passed are removed.
+const pruneInterval = time.Minute
+
+// Quote is a delivery option that was offered to a client, for a specific package.
+type Quote struct {
+	// ID uniquely identifies the quote.
+	ID string `json:"id"`
+
+	// Package is the package the option was offered for.
+	Package *carriers.Package `json:"package"`
+
+	// Option is the option as it was offered.
+	Option *carriers.DeliveryOption `json:"option"`
+
+	// Expires is the time after which the quote can no longer be booked.
+	Expires time.Time `json:"expires"`
+
+	// Booking is the confirmation from the carrier, once the quote has been booked.
+	Booking *carriers.Booking `json:"booking,omitempty"`
+
+	// claimed indicates that a booking is in progress.
+	claimed bool
+}
+
+// Store holds the quotes in memory, and (optionally) persists them to a file so that they survive a restart. Quotes
+// are removed from memory once they have been expired for longer than the retention.
+//
+// Hint: The file is only ever appended to. Quotes past their retention are skipped as it is read, but not removed.
+type Store struct {
+	mu     sync.Mutex
+	quotes map[string]*Quote
+
+	// retention is how long quotes are kept after they expire, and pruned when they were last removed.
+	retention time.Duration
+	pruned    time.Time
+
+	// f is the file quotes are appended to, as newline delimited JSON. Later entries for the same quote replace
+	// earlier ones. May be nil.
+	f *os.File
+
+	// clock is what quotes expire by.
+	clock clock.Clock
+}
+
+// Open creates a store. If the path is empty, quotes are only kept in memory. Otherwise, existing quotes are read
+// from the file and new ones appended to it.
+func Open(path string, opts ...Option) (*Store, error) {
+	s := &Store{
+		quotes:    make(map[string]*Quote),
+		retention: DefaultRetention,
+	}
+
+	for _, o := range opts {
+		if err := o(s); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrFailedToOpen, err)
+		}
+	}
+
+	s.clock = clock.Or(s.clock)
+	s.pruned = s.clock.Now()
+
+	if path == "" {
+		return s, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFailedToOpen, err)
+	}
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for sc.Scan() {
+		q := &Quote{}
+		if err := json.Unmarshal(sc.Bytes(), q); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%w: %s", ErrFailedToOpen, err)
+		}
+
+		s.quotes[q.ID] = q
+	}
+
+	if err := sc.Err(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%w: %s", ErrFailedToOpen, err)
+	}
+
+	s.prune(s.pruned)
+
+	s.f = f
+
+	return s, nil
+}
+
+// WithClock sets the clock that quotes expire by.
+func WithClock(c clock.Clock) Option {
+	return func(s *Store) error {
+		s.clock = c
+
+		return nil
+	}
+}
+
+// WithRetention sets how long quotes are kept after they expire.
+func WithRetention(d time.Duration) Option {
+	return func(s *Store) error {
+		if d < 0 {
+			return fmt.Errorf("retention cannot be negative: %s", d)
+		}
+
+		s.retention = d
+
+		return nil
+	}
+}
+
+// Len is the number of quotes in the store.
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.quotes)
+}
+
+// Issue creates a quote for the option, valid for the supplied duration. The ID and expiry of the quote are also
+// set on the option, so the client can see them. The quote keeps a copy of the option, such that what the client is
+// later shown (for example, its token, or its cost in another currency) does not change what is booked.
+func (s *Store) Issue(pkg *carriers.Package, opt *carriers.DeliveryOption, ttl time.Duration) (*Quote, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFailedToSave, err)
+	}
+
+	opt.QuoteID = hex.EncodeToString(id)
+	opt.Expires = s.clock.Now().Add(ttl).UTC()
+
+	q := &Quote{
+		ID:      opt.QuoteID,
+		Package: pkg,
+		Option:  opt.Copy(),
+		Expires: opt.Expires,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.save(q); err != nil {
+		return nil, err
+	}
+
+	s.quotes[q.ID] = q
+
+	// Quotes are issued with every query, so this is where the store would grow; and thus where it is pruned.
+	if now := s.clock.Now(); now.Sub(s.pruned) >= pruneInterval {
+		s.prune(now)
+		s.pruned = now
+	}
+
+	return q, nil
+}
+
+// prune removes the quotes that have been expired for longer than the retention, unless they are being booked. The
+// lock must be held.
+func (s *Store) prune(now time.Time) {
+	for id, q := range s.quotes {
+		if !q.claimed && now.Sub(q.Expires) > s.retention {
+			delete(s.quotes, id)
+		}
+	}
+}
+
+// Get returns a copy of the quote.
+func (s *Store) Get(id string) (*Quote, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, ok := s.quotes[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+
+	c := *q
+
+	return &c, nil
+}
+
+// Claim reserves the quote for booking, so that it cannot be booked twice at the same time. The claim must be
+// followed by either Complete or Release.
+func (s *Store) Claim(id string) (*Quote, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, ok := s.quotes[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+
+	if q.Booking != nil || q.claimed {
+		return nil, fmt.Errorf("%w: %s", ErrAlreadyBooked, id)
+	}
+
+	if s.clock.Now().After(q.Expires) {
+		return nil, fmt.Errorf("%w: %s at %s", ErrExpired, id, q.Expires)
+	}
+
+	q.claimed = true
+
+	return q, nil
+}
+
+// Release gives up the claim on a quote, such as when the carrier failed to book it.
+func (s *Store) Release(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if q, ok := s.quotes[id]; ok {
+		q.claimed = false
+	}
+}
+
+// Complete records the booking for a claimed quote.
+func (s *Store) Complete(id string, b *carriers.Booking) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, ok := s.quotes[id]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+
+	q.Booking = b
+	q.claimed = false
+
+	return s.save(q)
+}
+
+// Close closes the underlying file, if there is one.
+func (s *Store) Close() error {
+	if s.f == nil {
+		return nil
+	}
+
+	return s.f.Close()
+}
+
+// save appends the quote to the file. The lock must be held.
+func (s *Store) save(q *Quote) error {
+	if s.f == nil {
+		return nil
+	}
+
+	b, err := json.Marshal(q)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrFailedToSave, err)
+	}
+
+	if _, err := s.f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("%w: %s", ErrFailedToSave, err)
+	}
+
+	return nil
+}
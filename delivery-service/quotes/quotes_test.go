@@ -0,0 +1,163 @@
+package quotes
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/carriers"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/clock"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/money"
+)
+
+func testOption() *carriers.DeliveryOption {
+	return &carriers.DeliveryOption{Provider: "svx", Cost: &money.Money{Total: 590, Currency: "EUR"}}
+}
+
+func TestPrune(t *testing.T) {
+	clk := clock.NewFake(time.Date(2023, 9, 9, 12, 0, 0, 0, time.UTC))
+	path := filepath.Join(t.TempDir(), "quotes.ndjson")
+
+	s, err := Open(path, WithClock(clk), WithRetention(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old, err := s.Issue(&carriers.Package{}, testOption(), DefaultTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A quote being booked is kept, even once its retention has passed.
+	claimed, err := s.Issue(&carriers.Package{}, testOption(), DefaultTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Claim(claimed.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Within the retention, the quote is expired rather than unknown.
+	clk.Advance(DefaultTTL + 30*time.Minute)
+
+	if _, err := s.Claim(old.ID); !errors.Is(err, ErrExpired) {
+		t.Fatalf("expected %v, got %v", ErrExpired, err)
+	}
+
+	clk.Advance(time.Hour)
+
+	fresh, err := s.Issue(&carriers.Package{}, testOption(), DefaultTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Get(old.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the expired quote to be pruned, got %v", err)
+	}
+
+	for _, id := range []string{claimed.ID, fresh.ID} {
+		if _, err := s.Get(id); err != nil {
+			t.Errorf("expected %s to be kept, got %v", id, err)
+		}
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Quotes past their retention are not read back from the file either.
+	s, err = Open(path, WithClock(clk), WithRetention(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if s.Len() != 1 {
+		t.Errorf("expected only the fresh quote to be read, got %d quotes", s.Len())
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	clk := clock.NewFake(time.Date(2023, 9, 9, 12, 0, 0, 0, time.UTC))
+
+	s, err := Open("", WithClock(clk))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	q, err := s.Issue(&carriers.Package{}, testOption(), DefaultTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := clk.Now().Add(DefaultTTL); !q.Expires.Equal(want) {
+		t.Errorf("expected the quote to expire at %s, got %s", want, q.Expires)
+	}
+
+	// The quote can be booked until the moment it expires.
+	clk.Advance(DefaultTTL)
+
+	if _, err := s.Claim(q.ID); err != nil {
+		t.Fatalf("expected the quote to be claimed, got %v", err)
+	}
+
+	s.Release(q.ID)
+	clk.Advance(time.Nanosecond)
+
+	if _, err := s.Claim(q.ID); !errors.Is(err, ErrExpired) {
+		t.Errorf("expected %v, got %v", ErrExpired, err)
+	}
+}
+
+func TestIssueCopiesOption(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quotes.ndjson")
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opt := testOption()
+
+	q, err := s.Issue(&carriers.Package{}, opt, DefaultTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The server changes the option after issuing it, to show it to the client.
+	opt.Token = "token"
+	opt.Cost.Total = 1
+	opt.Cost.Display = "€0.01"
+
+	got, err := s.Get(q.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Option.Token != "" || got.Option.Cost.Total != 590 || got.Option.Cost.Display != "" {
+		t.Errorf("expected the quote to keep the option as it was issued, got %+v (%+v)", got.Option, got.Option.Cost)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// What is read back after a restart is what was kept.
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	read, err := s.Get(q.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *read.Option.Cost != *got.Option.Cost || read.Option.Token != got.Option.Token {
+		t.Errorf("expected %+v to be read back, got %+v", got.Option.Cost, read.Option.Cost)
+	}
+}
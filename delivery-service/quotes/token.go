@@ -0,0 +1,193 @@
+package quotes
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/carriers"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/money"
+)
+
+var (
+	ErrMalformedToken   = errors.New("malformed token")
+	ErrInvalidSignature = errors.New("invalid token signature")
+	ErrTokenExpired     = errors.New("token expired")
+	ErrFailedToLoadKeys = errors.New("failed to load signing keys")
+	ErrUnsignable       = errors.New("option cannot be signed")
+)
+
+// MinKeyLength is the shortest key (in bytes) that is accepted for signing. It matches the output of SHA-256.
+const MinKeyLength = 32
+
+// Claims are the contents of a signed token; what exactly was quoted, for which package, and until when.
+type Claims struct {
+	QuoteID  string            `json:"quote_id,omitempty"`
+	Provider string            `json:"provider"`
+	Cost     *money.Money      `json:"cost"`
+	Arrival  time.Time         `json:"arrival"`
+	Package  *carriers.Package `json:"package"`
+	Expires  time.Time         `json:"expires"`
+}
+
+// Keys is the set of keys used to sign tokens. Tokens are always signed with the current key, but can be verified
+// with any of them. That allows rotating keys by adding a new one, making it current and (once the tokens signed with
+// it have expired) removing the old one. It is loaded from a file such as:
+//
+//	{
+//	  "current": "2023-09",
+//	  "keys": {
+//	    "2023-09": "<base64 encoded key>",
+//	    "2023-06": "<base64 encoded key>"
+//	  }
+//	}
+type Keys struct {
+	// Current is the ID of the key that new tokens are signed with.
+	Current string `json:"current"`
+
+	// Keys are the keys themselves, keyed by ID.
+	Keys map[string][]byte `json:"keys"`
+}
+
+// LoadKeys reads the signing keys from a JSON file on disk.
+func LoadKeys(path string) (*Keys, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFailedToLoadKeys, err)
+	}
+	defer f.Close()
+
+	k := &Keys{}
+	if err := json.NewDecoder(f).Decode(k); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFailedToLoadKeys, err)
+	}
+
+	if err := k.validate(); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFailedToLoadKeys, err)
+	}
+
+	return k, nil
+}
+
+// EphemeralKeys generates a random key that only lives as long as the process. Tokens signed with it cannot be
+// verified after a restart.
+func EphemeralKeys() (*Keys, error) {
+	key := make([]byte, MinKeyLength)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFailedToLoadKeys, err)
+	}
+
+	return &Keys{
+		Current: "ephemeral",
+		Keys:    map[string][]byte{"ephemeral": key},
+	}, nil
+}
+
+// validate checks that the current key exists, and that all keys are long enough to be secure.
+func (k *Keys) validate() error {
+	if _, ok := k.Keys[k.Current]; !ok {
+		return fmt.Errorf("current key %q does not exist", k.Current)
+	}
+
+	for id, key := range k.Keys {
+		if strings.Contains(id, ".") {
+			return fmt.Errorf("key id %q must not contain a %q", id, ".")
+		}
+
+		if len(key) < MinKeyLength {
+			return fmt.Errorf("key %q is %d bytes, but must be at least %d", id, len(key), MinKeyLength)
+		}
+	}
+
+	return nil
+}
+
+// Sign creates a token for the option. The token is made up of three parts, separated by a ".":
+//
+//  1. The ID of the key used to sign it.
+//  2. The claims, as base64 encoded JSON.
+//  3. The HMAC-SHA256 of the first two parts, base64 encoded.
+//
+// It is similar in spirit to a JWT, but without the flexibility (and thus the footguns) of choosing an algorithm.
+func (k *Keys) Sign(pkg *carriers.Package, opt *carriers.DeliveryOption) (string, error) {
+	if opt.Cost == nil {
+		return "", fmt.Errorf("%w: %s option has no cost", ErrUnsignable, opt.Provider)
+	}
+
+	// Only the cost as quoted is signed; not the version formatted for a specific client.
+	cost := *opt.Cost
+	cost.Display = ""
+
+	b, err := json.Marshal(&Claims{
+		QuoteID:  opt.QuoteID,
+		Provider: opt.Provider,
+		Cost:     &cost,
+		Arrival:  opt.Arrival,
+		Package:  pkg,
+		Expires:  opt.Expires,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	signed := k.Current + "." + base64.RawURLEncoding.EncodeToString(b)
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(k.mac(k.Keys[k.Current], signed)), nil
+}
+
+// VerifyAt checks the signature of the token and, if it is valid and has not expired at the supplied time (usually now,
+// on the clock of the caller), returns what it claims.
+func (k *Keys) VerifyAt(token string, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: expected 3 parts, got %d", ErrMalformedToken, len(parts))
+	}
+
+	// A key that we do not know is indistinguishable from a forged signature.
+	key, ok := k.Keys[parts[0]]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidSignature, parts[0])
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrMalformedToken, err)
+	}
+
+	// The signature is checked before the claims are even decoded, so we never act on anything unauthenticated.
+	if !hmac.Equal(sig, k.mac(key, parts[0]+"."+parts[1])) {
+		return nil, ErrInvalidSignature
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrMalformedToken, err)
+	}
+
+	c := &Claims{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrMalformedToken, err)
+	}
+
+	if now.After(c.Expires) {
+		return c, fmt.Errorf("%w: at %s", ErrTokenExpired, c.Expires)
+	}
+
+	return c, nil
+}
+
+// mac calculates the HMAC-SHA256 of the message.
+func (k *Keys) mac(key []byte, msg string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(msg))
+
+	return h.Sum(nil)
+}
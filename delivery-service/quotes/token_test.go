@@ -0,0 +1,120 @@
+package quotes
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/carriers"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/money"
+)
+
+func testKeys(t *testing.T, ids ...string) *Keys {
+	t.Helper()
+
+	k := &Keys{Current: ids[0], Keys: map[string][]byte{}}
+	for _, id := range ids {
+		k.Keys[id] = []byte(strings.Repeat(id[:1], MinKeyLength))
+	}
+
+	if err := k.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	return k
+}
+
+func TestToken(t *testing.T) {
+	now := time.Date(2023, 9, 9, 12, 0, 0, 0, time.UTC)
+	pkg := &carriers.Package{Weight: 1000, Width: 10, Height: 20, Depth: 30}
+	opt := &carriers.DeliveryOption{
+		Provider: "svx",
+		Cost:     &money.Money{Total: 590, Currency: "EUR", Display: "€5.90"},
+		Arrival:  now.Add(48 * time.Hour),
+		QuoteID:  "q-1",
+		Expires:  now.Add(15 * time.Minute),
+	}
+
+	keys := testKeys(t, "a")
+
+	token, err := keys.Sign(pkg, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The parts are swapped in, one at a time, from a token signed with a different key.
+	other, err := testKeys(t, "b").Sign(pkg, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts, otherParts := strings.Split(token, "."), strings.Split(other, ".")
+
+	for _, tc := range []struct {
+		name  string
+		keys  *Keys
+		token string
+		at    time.Time
+		err   error
+	}{
+		{"valid", keys, token, now, nil},
+		{"valid until it expires", keys, token, opt.Expires, nil},
+		{"expired", keys, token, opt.Expires.Add(time.Nanosecond), ErrTokenExpired},
+		{"rotated", testKeys(t, "c", "a"), token, now, nil},
+		{"unknown key", testKeys(t, "c"), token, now, ErrInvalidSignature},
+		{"forged signature", keys, parts[0] + "." + parts[1] + "." + otherParts[2], now, ErrInvalidSignature},
+		{"tampered claims", keys, parts[0] + "." + otherParts[1][:len(otherParts[1])-1] + "A." + parts[2], now, ErrInvalidSignature},
+		{"signed with another key", keys, "a." + otherParts[1] + "." + otherParts[2], now, ErrInvalidSignature},
+		{"too few parts", keys, parts[0] + "." + parts[1], now, ErrMalformedToken},
+		{"undecodable signature", keys, parts[0] + "." + parts[1] + ".!", now, ErrMalformedToken},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := tc.keys.VerifyAt(tc.token, tc.at)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if c.QuoteID != opt.QuoteID || c.Provider != opt.Provider || !c.Arrival.Equal(opt.Arrival) {
+				t.Errorf("claims do not match the option: %+v", c)
+			}
+
+			// Only the cost as quoted is signed.
+			if c.Cost.Total != 590 || c.Cost.Currency != "EUR" || c.Cost.Display != "" {
+				t.Errorf("expected the cost as quoted, got %+v", c.Cost)
+			}
+
+			if c.Package.Weight != pkg.Weight {
+				t.Errorf("expected the package to be claimed, got %+v", c.Package)
+			}
+		})
+	}
+}
+
+func TestSignWithoutCost(t *testing.T) {
+	_, err := testKeys(t, "a").Sign(&carriers.Package{}, &carriers.DeliveryOption{Provider: "svx"})
+	if !errors.Is(err, ErrUnsignable) {
+		t.Errorf("expected %v, got %v", ErrUnsignable, err)
+	}
+}
+
+func TestKeysValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		keys *Keys
+	}{
+		{"missing current", &Keys{Current: "x", Keys: map[string][]byte{}}},
+		{"short key", &Keys{Current: "x", Keys: map[string][]byte{"x": []byte("short")}}},
+		{"dotted id", &Keys{Current: "x.y", Keys: map[string][]byte{"x.y": make([]byte, MinKeyLength)}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.keys.validate(); err == nil {
+				t.Error("expected the keys to be invalid")
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/accuracy"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/problem"
+)
+
+// deliveries accepts confirmation that a package was delivered, so the accuracy of the carrier can be tracked.
+func (srv *Server) deliveries(w http.ResponseWriter, r *http.Request) {
+	jw := json.NewEncoder(w)
+
+	if r.Method != http.MethodPost {
+		w.Header().Add("Allow", http.MethodPost)
+		w.Header().Add("Content-Type", problem.HTTPContentTypeJSON)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+
+		// Hint: This can fail, but it is ignored.
+		jw.Encode(&problem.Problem{
+			Type:   "delivery-options.local/problems/method-not-allowed",
+			Title:  "The method is not allowed",
+			Detail: fmt.Sprintf("Deliveries can only be confirmed with %s", http.MethodPost),
+		})
+		return
+	}
+
+	c := &accuracy.Confirmation{}
+	err := json.NewDecoder(r.Body).Decode(c)
+	if err == nil {
+		err = srv.accuracy.Confirm(r.Context(), c)
+	}
+
+	// The only way a confirmation can fail is by being invalid.
+	if err != nil {
+		w.Header().Add("Content-Type", problem.HTTPContentTypeJSON)
+		w.WriteHeader(http.StatusBadRequest)
+
+		// Hint: This can fail, but it is ignored.
+		jw.Encode(&problem.Problem{
+			Type:   "delivery-options.local/problems/bad-body",
+			Title:  "Missing or malformed request body",
+			Detail: `The request body must be a JSON object with a "provider", "quoted_arrival" and "delivered"`,
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// accuracySummary returns how accurate each carrier was for the deliveries confirmed between two times (inclusive,
+// formatted as RFC 3339). For example,
+//
+//	/accuracy?from=2023-09-01T00:00:00Z&to=2023-10-01T00:00:00Z
+func (srv *Server) accuracySummary(w http.ResponseWriter, r *http.Request) {
+	jw := json.NewEncoder(w)
+	values := r.URL.Query()
+
+	// By default, summarise the last 30 days.
+	to := srv.clock.Now()
+	from := to.AddDate(0, 0, -30)
+
+	var errFrom, errTo error
+	if values.Has("from") {
+		from, errFrom = time.Parse(time.RFC3339, values.Get("from"))
+	}
+
+	if values.Has("to") {
+		to, errTo = time.Parse(time.RFC3339, values.Get("to"))
+	}
+
+	if errFrom != nil || errTo != nil {
+		w.Header().Add("Content-Type", problem.HTTPContentTypeJSON)
+		w.WriteHeader(http.StatusBadRequest)
+
+		// Hint: This can fail, but it is ignored.
+		jw.Encode(&problem.Problem{
+			Type:   "delivery-options.local/problems/bad-parameters",
+			Title:  "Missing or malformed input parameters",
+			Detail: "The parameters from and to must be times, formatted as RFC 3339",
+		})
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	jw.Encode(srv.accuracy.Summarise(from, to))
+}
@@ -0,0 +1,15 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// adminCarriers returns the carriers that are queried for each package, along with the middleware each is wrapped in
+// (outermost first), such that what happens to a query can be understood without reading the configuration.
+func (srv *Server) adminCarriers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+
+	// Hint: This can fail, but it is ignored.
+	json.NewEncoder(w).Encode(srv.carriers.Load().Chains())
+}
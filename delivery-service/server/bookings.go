@@ -0,0 +1,156 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/pickup"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/problem"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/quotes"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/usage"
+)
+
+// BookingRequest is the body of a request to book a quote.
+type BookingRequest struct {
+	QuoteID string `json:"quote_id"`
+}
+
+// bookings books a quote previously returned by deliveryOptions, with the carrier that provided it.
+func (srv *Server) bookings(w http.ResponseWriter, r *http.Request) {
+	jw := json.NewEncoder(w)
+
+	if r.Method != http.MethodPost {
+		w.Header().Add("Allow", http.MethodPost)
+		w.Header().Add("Content-Type", problem.HTTPContentTypeJSON)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+
+		// Hint: This can fail, but it is ignored.
+		jw.Encode(&problem.Problem{
+			Type:   "delivery-options.local/problems/method-not-allowed",
+			Title:  "The method is not allowed",
+			Detail: fmt.Sprintf("Bookings can only be created with %s", http.MethodPost),
+		})
+		return
+	}
+
+	req := &BookingRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil || req.QuoteID == "" {
+		w.Header().Add("Content-Type", problem.HTTPContentTypeJSON)
+		w.WriteHeader(http.StatusBadRequest)
+
+		// Hint: This can fail, but it is ignored.
+		jw.Encode(&problem.Problem{
+			Type:   "delivery-options.local/problems/bad-body",
+			Title:  "Missing or malformed request body",
+			Detail: `The request body must be a JSON object with a "quote_id"`,
+		})
+		return
+	}
+
+	// Claim the quote, so that it cannot be booked twice.
+	q, err := srv.quotes.Claim(req.QuoteID)
+
+	switch {
+	case err == nil:
+	case errors.Is(err, quotes.ErrNotFound):
+		w.Header().Add("Content-Type", problem.HTTPContentTypeJSON)
+		w.WriteHeader(http.StatusNotFound)
+
+		// Hint: This can fail, but it is ignored.
+		jw.Encode(&problem.Problem{
+			Type:   "delivery-options.local/problems/unknown-quote",
+			Title:  "The quote does not exist",
+			Detail: fmt.Sprintf("There is no quote with the ID %q", req.QuoteID),
+		})
+		return
+	case errors.Is(err, quotes.ErrExpired):
+		w.Header().Add("Content-Type", problem.HTTPContentTypeJSON)
+		w.WriteHeader(http.StatusGone)
+
+		// Hint: This can fail, but it is ignored.
+		jw.Encode(&problem.Problem{
+			Type:   "delivery-options.local/problems/expired-quote",
+			Title:  "The quote has expired",
+			Detail: "The quote can no longer be booked. Request new delivery options, and book one of those",
+		})
+		return
+	case errors.Is(err, quotes.ErrAlreadyBooked):
+		w.Header().Add("Content-Type", problem.HTTPContentTypeJSON)
+		w.WriteHeader(http.StatusConflict)
+
+		// Hint: This can fail, but it is ignored.
+		jw.Encode(&problem.Problem{
+			Type:   "delivery-options.local/problems/quote-already-booked",
+			Title:  "The quote has already been booked",
+			Detail: fmt.Sprintf("The quote %q has already been booked, or is being booked", req.QuoteID),
+		})
+		return
+	default:
+		w.Header().Add("Content-Type", problem.HTTPContentTypeJSON)
+		w.WriteHeader(http.StatusInternalServerError)
+
+		// Hint: This can fail, but it is ignored.
+		jw.Encode(&problem.Problem{
+			Type:   "delivery-options.local/server/internal-server-error",
+			Title:  "An unexpected server error has occurred",
+			Detail: "An error that is not handled within the software has occurred. Please check telemetry for details",
+		})
+		return
+	}
+
+	// Book the option with the carrier that provided it.
+	b, err := srv.carriers.Load().Book(q.Package, q.Option)
+	if errors.Is(err, pickup.ErrPointFull) {
+		srv.quotes.Release(q.ID)
+
+		w.Header().Add("Content-Type", problem.HTTPContentTypeJSON)
+		w.WriteHeader(http.StatusConflict)
+
+		// Hint: This can fail, but it is ignored.
+		jw.Encode(&problem.Problem{
+			Type:   "delivery-options.local/problems/pickup-point-full",
+			Title:  "The pickup point is full",
+			Detail: "The pickup point of the quote has no room for the package. Request new delivery options, and book one of those",
+		})
+		return
+	}
+
+	if err != nil {
+		srv.quotes.Release(q.ID)
+
+		w.Header().Add("Content-Type", problem.HTTPContentTypeJSON)
+		w.WriteHeader(http.StatusBadGateway)
+
+		// Hint: This can fail, but it is ignored.
+		jw.Encode(&problem.Problem{
+			Type:   "delivery-options.local/problems/booking-failed",
+			Title:  "The provider failed to book the quote",
+			Detail: "The provider could not book the quote. It has not been booked, and can be retried until it expires",
+		})
+		return
+	}
+
+	// Hint: If this fails, the carrier has booked the delivery but we have no record of it.
+	if err := srv.quotes.Complete(q.ID, b); err != nil {
+		w.Header().Add("Content-Type", problem.HTTPContentTypeJSON)
+		w.WriteHeader(http.StatusInternalServerError)
+
+		// Hint: This can fail, but it is ignored.
+		jw.Encode(&problem.Problem{
+			Type:   "delivery-options.local/server/internal-server-error",
+			Title:  "An unexpected server error has occurred",
+			Detail: "An error that is not handled within the software has occurred. Please check telemetry for details",
+		})
+		return
+	}
+
+	// Assignments are sticky, so the client is assigned the same variants as when it was quoted.
+	exp := srv.experiments.Load()
+	exp.Booked(r.Context(), exp.Assign(usage.Identify(r)), q.Option)
+
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	jw.Encode(q)
+}
@@ -4,11 +4,21 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/andrewhowdencom/courses.pito/delivery-service/carriers"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/events"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/experiments"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/geo"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/money"
 	"github.com/andrewhowdencom/courses.pito/delivery-service/problem"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/quotelog"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/quotes"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/usage"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -16,6 +26,30 @@ const (
 	ParamHeight = "height"
 	ParamDepth  = "depth"
 	ParamWeight = "weight"
+
+	// ParamCurrency is optional, and requests that costs are additionally returned in that currency.
+	ParamCurrency = "currency"
+
+	// ParamOrigin and ParamDestination are optional postal codes, used to estimate the distance the package travels
+	// (and thus its emissions). If one is supplied, both must be.
+	ParamOrigin      = "origin"
+	ParamDestination = "destination"
+
+	// ParamSort is optional, and orders the options. The only supported value is SortEmissions.
+	ParamSort = "sort"
+
+	// ParamMaxEmissions is optional, and excludes options estimated to emit more than this (in grams of CO2e).
+	ParamMaxEmissions = "max-emissions"
+
+	// ParamDelivery is optional, and restricts options to those delivered to the door (DeliveryDoor) or to a pickup
+	// point (DeliveryPickup). If omitted, both are returned.
+	ParamDelivery = "delivery"
+
+	DeliveryDoor   = "door"
+	DeliveryPickup = "pickup"
+
+	// SortEmissions orders options from the lowest to highest emissions. Options without an estimate are last.
+	SortEmissions = "emissions"
 )
 
 // deliveryOptions receives a request for delivery options and returns a series of options, depending on what
@@ -72,6 +106,93 @@ func (srv *Server) deliveryOptions(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The currency is optional. However, if it is supplied, it needs to be one that we have an exchange rate for.
+	// Otherwise, we would silently return prices in a currency the client did not ask for.
+	var currency string
+	if values.Has(ParamCurrency) {
+		c, err := money.LookupCurrency(values.Get(ParamCurrency))
+
+		if err != nil || srv.rates == nil || !srv.rates.Supports(c.Code) {
+			w.Header().Add("Content-Type", problem.HTTPContentTypeJSON)
+			w.WriteHeader(http.StatusBadRequest)
+
+			// Hint: This can fail, but it is ignored.
+			jw.Encode(&problem.Problem{
+				Type:  "delivery-options.local/problems/unsupported-currency",
+				Title: "The requested currency is not supported",
+				Detail: fmt.Sprintf(
+					"There is no exchange rate available for the currency %q",
+					values.Get(ParamCurrency),
+				),
+			})
+			return
+		}
+
+		currency = c.Code
+	}
+
+	// The origin and destination are optional, but are needed together to know how far the package travels.
+	var distance int64
+	if values.Has(ParamOrigin) || values.Has(ParamDestination) {
+		d, err := geo.Distance(values.Get(ParamOrigin), values.Get(ParamDestination))
+
+		if err != nil {
+			w.Header().Add("Content-Type", problem.HTTPContentTypeJSON)
+			w.WriteHeader(http.StatusBadRequest)
+
+			// Hint: This can fail, but it is ignored.
+			jw.Encode(&problem.Problem{
+				Type:  "delivery-options.local/problems/unknown-location",
+				Title: "The origin or destination could not be located",
+				Detail: fmt.Sprintf(
+					"Both %s and %s must be known five digit postal codes: %s",
+					ParamOrigin, ParamDestination, err,
+				),
+			})
+			return
+		}
+
+		distance = d
+	}
+
+	// Sorting and filtering are both optional.
+	var maxEmissions int64 = -1
+	pOptBroken := []string{}
+
+	if values.Has(ParamSort) && values.Get(ParamSort) != SortEmissions {
+		pOptBroken = append(pOptBroken, ParamSort)
+	}
+
+	if d := values.Get(ParamDelivery); values.Has(ParamDelivery) && d != DeliveryDoor && d != DeliveryPickup {
+		pOptBroken = append(pOptBroken, ParamDelivery)
+	}
+
+	if values.Has(ParamMaxEmissions) {
+		i64, err := strconv.ParseInt(values.Get(ParamMaxEmissions), 10, 64)
+
+		if err != nil || i64 < 0 {
+			pOptBroken = append(pOptBroken, ParamMaxEmissions)
+		}
+
+		maxEmissions = i64
+	}
+
+	if len(pOptBroken) > 0 {
+		w.Header().Add("Content-Type", problem.HTTPContentTypeJSON)
+		w.WriteHeader(http.StatusBadRequest)
+
+		// Hint: This can fail, but it is ignored.
+		jw.Encode(&problem.Problem{
+			Type:  "delivery-options.local/problems/bad-parameters",
+			Title: "Missing or malformed input parameters",
+			Detail: fmt.Sprintf(
+				"The following optional parameters were malformed: %s",
+				strings.Join(pOptBroken, ","),
+			),
+		})
+		return
+	}
+
 	// Here, we are querying all of the providers for their delivery options.
 	//
 	// In production, you'd probably want to do this in parallel. However, that makes the error handling a little more
@@ -81,12 +202,142 @@ func (srv *Server) deliveryOptions(w http.ResponseWriter, r *http.Request) {
 		Height: pOK[ParamHeight],
 		Depth:  pOK[ParamDepth],
 		Weight: pOK[ParamWeight],
+
+		Origin:      values.Get(ParamOrigin),
+		Destination: values.Get(ParamDestination),
+		Distance:    distance,
+	}
+
+	// The client sees the same variant of each experiment on every request. The variants are recorded on the trace and
+	// the request metrics, and carried to the carriers (which may be excluded, or priced differently, because of them).
+	client := usage.Identify(r)
+	exp := srv.experiments.Load()
+	assigned := exp.Assign(client)
+	trace.SpanFromContext(r.Context()).SetAttributes(assigned.Attributes()...)
+
+	if labeler, ok := otelhttp.LabelerFromContext(r.Context()); ok {
+		labeler.Add(assigned.Attributes()...)
 	}
 
-	offers, err := srv.carriers.Query(pkg)
+	cs := srv.carriers.Load()
+	offers, outcomes, err := cs.QueryOutcomes(experiments.NewContext(r.Context(), assigned), pkg)
+
+	// Every carrier that was queried is counted for the client, whether or not it returned options. Those excluded
+	// (for example, by an experiment or their quota) were never called, so are not.
+	var calls int64
+	for _, o := range outcomes {
+		if o.Excluded == "" {
+			calls++
+		}
+	}
+
+	srv.usage.Record(client, srv.clock.Now(), usage.Counts{CarrierCalls: calls})
+
+	// Exclude the options the client is not interested in. Options without an emissions estimate cannot be shown to
+	// be below the maximum, so they are excluded as well.
+	if err == nil && (maxEmissions >= 0 || values.Has(ParamDelivery)) {
+		kept := []*carriers.DeliveryOption{}
+		for _, o := range offers {
+			if maxEmissions >= 0 && (o.Emissions == nil || o.Emissions.CO2e > maxEmissions) {
+				continue
+			}
+
+			if values.Get(ParamDelivery) == DeliveryDoor && o.PickupPoint != nil {
+				continue
+			}
+
+			if values.Get(ParamDelivery) == DeliveryPickup && o.PickupPoint == nil {
+				continue
+			}
+
+			kept = append(kept, o)
+		}
+
+		if offers = kept; len(offers) == 0 {
+			err = carriers.ErrNoOffersFound
+		}
+	}
+
+	if err == nil && values.Get(ParamSort) == SortEmissions {
+		sort.SliceStable(offers, func(i, j int) bool {
+			a, b := offers[i].Emissions, offers[j].Emissions
+			if a == nil || b == nil {
+				return b == nil && a != nil
+			}
+
+			return a.CO2e < b.CO2e
+		})
+	}
+
+	// Every option that is offered gets a quote, so that the client can book it later, and a signed token, so that
+	// they can prove what they were quoted.
+	if err == nil {
+		for _, o := range offers {
+			if _, err = srv.quotes.Issue(pkg, o, quotes.DefaultTTL); err != nil {
+				break
+			}
+
+			if o.Token, err = srv.keys.Sign(pkg, o); err != nil {
+				break
+			}
+		}
+	}
+
+	// Publish what was quoted for analytics. Failing to publish does not affect the client, who still gets their
+	// options.
+	if err == nil {
+		published := make([]*events.Quote, 0, len(offers))
+		for _, o := range offers {
+			// Hint: Failures are ignored here and below. How would we know the analytics are incomplete?
+			if e, err := events.NewQuote(pkg, o, srv.clock.Now()); err == nil {
+				published = append(published, e)
+			}
+		}
+
+		srv.events.Publish(r.Context(), published...)
+	}
+
+	// Record what was served (including nothing at all) for later analysis.
+	if err == nil || err == carriers.ErrNoOffersFound {
+		exp.Served(r.Context(), assigned, offers)
+	}
+
+	if srv.quoteLog != nil && (err == nil || err == carriers.ErrNoOffersFound) {
+		// Hint: This can fail, but it is ignored.
+		srv.quoteLog.Append(quotelog.NewEntry(pkg, offers, outcomes, srv.clock.Now()))
+	}
 
 	switch err {
 	case nil:
+		// Convert the costs into the requested currency, keeping the original cost so that the client can see what
+		// the carrier actually charges.
+		if currency != "" {
+			for _, o := range offers {
+				conv, err := srv.rates.Convert(o.Cost, currency, money.RoundHalfUp)
+
+				// Hint: If a carrier quotes in a currency we have no rate for, the option is returned without a
+				// conversion. How would we know this happens?
+				if err != nil {
+					continue
+				}
+
+				o.Converted = conv
+			}
+		}
+
+		// If the client told us which language they prefer, include a version of each amount that is ready to
+		// show to a person. Clients can then avoid reimplementing (for example) where the symbol goes.
+		if l, ok := locale(r.Header.Get("Accept-Language")); ok {
+			for _, o := range offers {
+				// Hint: Amounts in currencies we do not know are left without a display value.
+				o.Cost.Display, _ = o.Cost.Format(l)
+
+				if o.Converted != nil {
+					o.Converted.Amount.Display, _ = o.Converted.Amount.Format(l)
+				}
+			}
+		}
+
 		w.Header().Add("Content-Type", "application/json")
 		jw.Encode(offers)
 
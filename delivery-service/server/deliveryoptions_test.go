@@ -0,0 +1,106 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/carriers"
+)
+
+func TestDeliveryOptionsEmissions(t *testing.T) {
+	// A carrier that answers at once and never fails, such that every query returns an option for each mode.
+	c, err := carriers.New(append(carriers.Defaults, carriers.WithCarrier(&carriers.Simulated{
+		Name:     "svx",
+		Currency: "EUR",
+		Base:     590,
+		PerKg:    90,
+		Modes:    []carriers.TransportMode{carriers.ModeAir, carriers.ModeRoad},
+	}))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		query string
+		code  int
+		modes []carriers.TransportMode
+	}{
+		{
+			name:  "estimated between regions",
+			query: "origin=10115&destination=80331",
+			code:  http.StatusOK,
+			modes: []carriers.TransportMode{carriers.ModeAir, carriers.ModeRoad},
+		},
+		{
+			name:  "estimated within a region",
+			query: "origin=10115&destination=10117",
+			code:  http.StatusOK,
+			modes: []carriers.TransportMode{carriers.ModeAir, carriers.ModeRoad},
+		},
+		{
+			name:  "sorted by emissions",
+			query: "origin=10115&destination=80331&sort=emissions",
+			code:  http.StatusOK,
+			modes: []carriers.TransportMode{carriers.ModeRoad, carriers.ModeAir},
+		},
+		{
+			// 2.5kg over ~650km is ~1000g by air, but ~160g by road.
+			name:  "filtered by emissions",
+			query: "origin=10115&destination=80331&max-emissions=250",
+			code:  http.StatusOK,
+			modes: []carriers.TransportMode{carriers.ModeRoad},
+		},
+		{
+			name:  "filtered by emissions within a region",
+			query: "origin=10115&destination=10117&max-emissions=250",
+			code:  http.StatusOK,
+			modes: []carriers.TransportMode{carriers.ModeAir, carriers.ModeRoad},
+		},
+		{
+			name:  "nothing is estimated below the maximum",
+			query: "origin=10115&destination=80331&max-emissions=1",
+			code:  http.StatusNotFound,
+		},
+		{
+			name:  "options without an estimate are filtered",
+			query: "max-emissions=250",
+			code:  http.StatusNotFound,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			srv.deliveryOptions(w, httptest.NewRequest(http.MethodGet, "/delivery-options?width=200&height=35&depth=150&weight=2500&"+tc.query, nil))
+
+			if w.Code != tc.code {
+				t.Fatalf("expected status %d, got %d: %s", tc.code, w.Code, w.Body)
+			}
+
+			if tc.code != http.StatusOK {
+				return
+			}
+
+			var opts []*carriers.DeliveryOption
+			if err := json.NewDecoder(w.Body).Decode(&opts); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(opts) != len(tc.modes) {
+				t.Fatalf("expected %d options, got %d", len(tc.modes), len(opts))
+			}
+
+			for i, o := range opts {
+				if o.Mode != tc.modes[i] || o.Emissions == nil {
+					t.Errorf("expected option %d to be %s with an estimate, got %s (%v)", i, tc.modes[i], o.Mode, o.Emissions)
+				}
+			}
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package server
 
-import "net/http"
+import (
+	"encoding/json"
+	"net/http"
+)
 
 // healthz provids a handler that returns whether or not the application is "alive"
 //
@@ -8,3 +11,20 @@ import "net/http"
 func (srv *Server) healthz(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("OK"))
 }
+
+// readyz returns the state of each component of the application, and whether all of them are ready to serve traffic.
+// Unlike healthz, a failure here indicates traffic should be sent elsewhere, rather than the application restarted.
+func (srv *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	if srv.lifecycle == nil {
+		w.Write([]byte("OK"))
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	if !srv.lifecycle.Healthy() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	// Hint: This can fail, but it is ignored.
+	json.NewEncoder(w).Encode(srv.lifecycle.Status())
+}
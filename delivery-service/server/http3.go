@@ -0,0 +1,97 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// WithHTTP3 additionally serves HTTP/3 (over QUIC) on the UDP address, once ServeHTTP3 is called. HTTP/3 always uses
+// TLS, so a configuration with at least one certificate is required. Responses served over TCP advertise it with the
+// Alt-Svc header, such that clients can upgrade.
+func WithHTTP3(addr string, cfg *tls.Config) Option {
+	return func(srv *Server) error {
+		srv.h3 = &http3.Server{
+			Addr:      addr,
+			TLSConfig: http3.ConfigureTLSConfig(cfg),
+		}
+
+		return nil
+	}
+}
+
+// ServeHTTP3 accepts HTTP/3 connections on a UDP socket that has already been bound. It requires the WithHTTP3 option.
+func (s *Server) ServeHTTP3(conn net.PacketConn) error {
+	if s.h3 == nil {
+		return http.ErrServerClosed
+	}
+
+	return s.h3.Serve(conn)
+}
+
+// altSvc advertises HTTP/3 on responses served over TCP.
+func (s *Server) altSvc(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Hint: Until the UDP socket is bound, there is no port to advertise, and so nothing is.
+		s.h3.SetQuicHeaders(w.Header())
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// http3Proto labels HTTP/3 requests the same way the standard library labels HTTP/1.1 and HTTP/2 ("HTTP/<major>"),
+// such that the instrumentation records the protocol consistently as "http.flavor".
+func http3Proto(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Proto = "HTTP/3"
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// SelfSignedCertificate generates a certificate for the hosts that is only trusted by clients told to trust it (for
+// example, with "curl --insecure"). It is enough to try HTTP/3 locally, but not to serve real clients.
+func SelfSignedCertificate(hosts ...string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{Organization: []string{"delivery-service (self-signed)"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/money"
+)
+
+// locale determines which locale money should be formatted in, based on the "Accept-Language" header. It indicates
+// whether the client asked for a locale at all.
+//
+// See:
+// 1. https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Accept-Language
+func locale(header string) (money.Locale, bool) {
+	if header == "" {
+		return money.DefaultLocale, false
+	}
+
+	type weighted struct {
+		tag string
+		q   float64
+	}
+
+	// The header is a list of language tags, each with an optional "quality" indicating the preference. For
+	// example, "de-CH, de;q=0.9, en;q=0.8".
+	tags := []weighted{}
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		tag = strings.TrimSpace(tag)
+
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			// Hint: Malformed weights are treated as the lowest preference, rather than rejecting the request.
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			} else {
+				q = 0
+			}
+		}
+
+		if tag == "" || tag == "*" || q <= 0 {
+			continue
+		}
+
+		tags = append(tags, weighted{tag: tag, q: q})
+	}
+
+	// Stable, so that tags of equal weight keep the order the client sent them in.
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+
+	for _, t := range tags {
+		if l, ok := money.LookupLocale(t.tag); ok {
+			return l, true
+		}
+	}
+
+	return money.DefaultLocale, true
+}
@@ -0,0 +1,32 @@
+package server
+
+import "testing"
+
+func TestLocale(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		header string
+		want   string
+		asked  bool
+	}{
+		{"no header", "", "en", false},
+		{"single tag", "de", "de", true},
+		{"region falls back to the language", "de-AT", "de", true},
+		{"first supported tag", "xx, fr, de", "fr", true},
+		{"highest weight", "de;q=0.5, fr;q=0.9", "fr", true},
+		{"equal weights keep their order", "fr;q=0.8, de;q=0.8", "fr", true},
+		{"default weight is one", "de;q=0.9, fr", "fr", true},
+		{"zero weight is not acceptable", "fr;q=0, de", "de", true},
+		{"malformed weight is the lowest preference", "fr;q=x, de;q=0.1", "de", true},
+		{"wildcard is ignored", "*, de;q=0.5", "de", true},
+		{"nothing supported", "xx, yy", "en", true},
+		{"whitespace", "  pl ;  q=0.7 ", "pl", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			l, asked := locale(tc.header)
+			if l.Tag != tc.want || asked != tc.asked {
+				t.Errorf("expected %s (%t), got %s (%t)", tc.want, tc.asked, l.Tag, asked)
+			}
+		})
+	}
+}
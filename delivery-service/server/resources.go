@@ -0,0 +1,123 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"runtime/metrics"
+	"runtime/pprof"
+	"sync"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// metricAllocs is the runtime metric sampled before and after each request. It is cumulative, and for the whole
+// process.
+//
+// The runtime also reports CPU time ("/cpu/classes/..."), but only updates it when the garbage collector runs, which
+// is far too seldom to attribute to a single request. The CPU time is instead read from the operating system.
+const metricAllocs = "/gc/heap/allocs:bytes"
+
+// resources is the CPU time and memory used by the process. The difference between two samples is what was used in
+// between.
+type resources struct {
+	cpu    float64
+	allocs uint64
+}
+
+// sampleResources reads the resources used by the process so far.
+func sampleResources() resources {
+	samples := []metrics.Sample{{Name: metricAllocs}}
+	metrics.Read(samples)
+
+	r := resources{cpu: cpuTime()}
+
+	// Metrics that are not supported by the runtime have a KindBad value, and are left as zero.
+	if samples[0].Value.Kind() == metrics.KindUint64 {
+		r.allocs = samples[0].Value.Uint64()
+	}
+
+	return r
+}
+
+// inflight counts the requests in progress, such that requests can tell whether another overlapped with them.
+type inflight struct {
+	mu sync.Mutex
+
+	// n is the number of requests in progress, and started the number ever started.
+	n, started int64
+}
+
+// enter records a request starting, returning how many requests had started before it.
+func (i *inflight) enter() (started int64, alone bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.n++
+	i.started++
+
+	return i.started, i.n == 1
+}
+
+// leave records a request finishing, returning whether it was the only request in progress since it started.
+func (i *inflight) leave(started int64, alone bool) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.n--
+
+	return alone && i.started == started
+}
+
+// attributed records the CPU time and memory used while handling each request to the route. The handler runs with
+// pprof labels for the route and span, such that profiles can be filtered to a route (or a single request).
+//
+// The runtime (and operating system) only report the resources used by the whole process, so they are sampled before and after the request
+// and the difference attributed to it. That is only exact if no other request was in progress at the same time,
+// which is recorded as "resources.exclusive". It also includes whatever background work (for example, the garbage
+// collector) happened at the same time.
+//
+// It must be wrapped by otelhttp, such that the span already exists.
+func (srv *Server) attributed(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span := trace.SpanFromContext(r.Context())
+
+		labels := []string{"route", route}
+		if sc := span.SpanContext(); sc.HasSpanID() {
+			labels = append(labels, "span_id", sc.SpanID().String())
+		}
+
+		started, alone := srv.inflight.enter()
+		before := sampleResources()
+
+		pprof.Do(r.Context(), pprof.Labels(labels...), func(ctx context.Context) {
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+
+		after := sampleResources()
+		exclusive := srv.inflight.leave(started, alone)
+
+		cpu := after.cpu - before.cpu
+		allocs := int64(after.allocs - before.allocs)
+
+		span.SetAttributes(
+			attribute.Float64("resources.cpu_seconds", cpu),
+			attribute.Int64("resources.alloc_bytes", allocs),
+			attribute.Bool("resources.exclusive", exclusive),
+		)
+
+		// Handlers can add attributes (such as the variants of experiments) to the request metrics with the labeler
+		// of otelhttp; they are added to these too.
+		kvs := []attribute.KeyValue{attribute.String("route", route), attribute.Bool("exclusive", exclusive)}
+		if labeler, ok := otelhttp.LabelerFromContext(r.Context()); ok {
+			kvs = append(kvs, labeler.Get()...)
+		}
+
+		attrs := metric.WithAttributes(kvs...)
+
+		srv.metrics.cpu.Record(r.Context(), cpu, attrs)
+		srv.metrics.allocs.Record(r.Context(), allocs, attrs)
+	})
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package server
+
+// cpuTime is not supported outside unix, and is always zero.
+func cpuTime() float64 {
+	return 0
+}
@@ -0,0 +1,15 @@
+//go:build unix
+
+package server
+
+import "syscall"
+
+// cpuTime returns the CPU time (user and system) used by the process so far, in seconds.
+func cpuTime() float64 {
+	ru := syscall.Rusage{}
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0
+	}
+
+	return float64(ru.Utime.Nano()+ru.Stime.Nano()) / 1e9
+}
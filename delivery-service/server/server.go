@@ -2,23 +2,185 @@ package server
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"sync/atomic"
 
+	"github.com/andrewhowdencom/courses.pito/delivery-service/accuracy"
 	"github.com/andrewhowdencom/courses.pito/delivery-service/carriers"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/clock"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/events"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/experiments"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/lifecycle"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/money"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/quotelog"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/quotes"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/tracking"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/usage"
+	"github.com/quic-go/quic-go/http3"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
 )
 
+var (
+	ErrFailedToApplyOption   = errors.New("failed to apply option")
+	ErrFailedToCreateMetrics = errors.New("failed to create metric from provider")
+)
+
+// Option modifies the server as it is being bootstrapped.
+type Option func(srv *Server) error
+
 type Server struct {
 	srv *http.Server
 
-	// carriers are the carriers that can provide the shipping method.
-	carriers *carriers.Carriers
+	// admin serves the routes for operators (such as the usage of every client) on an address of its own, such that it
+	// need not be exposed to clients.
+	admin *http.Server
+
+	// opts are things that modify the bootstrap of the server, but are later unused.
+	opts struct {
+		m metric.Meter
+	}
+
+	metrics struct {
+		cpu    metric.Float64Histogram
+		allocs metric.Int64Histogram
+	}
+
+	// inflight counts the requests in progress, such that the resources they use can be attributed to them.
+	inflight inflight
+
+	// carriers are the carriers that can provide the shipping method. They are replaced as the configuration is
+	// reloaded; see SetCarriers.
+	carriers atomic.Pointer[carriers.Carriers]
+
+	// experiments are running for a percentage of clients. They are replaced as the configuration is reloaded; see
+	// SetExperiments.
+	experiments atomic.Pointer[experiments.Set]
+
+	// rates are used to convert the cost of delivery options into the currency requested by the client. If there are
+	// no rates, conversion is unavailable.
+	rates *money.Rates
+
+	// quotes are the options that have been offered to clients, and that they can book.
+	quotes *quotes.Store
+
+	// keys sign the options offered to clients, so that they can prove what they were quoted.
+	keys *quotes.Keys
+
+	// tracker follows the packages that have been shipped.
+	tracker *tracking.Tracker
+
+	// usage accounts for how much each client uses the service.
+	usage *usage.Store
+
+	// accuracy tracks how well the carriers keep to the arrival they quoted.
+	accuracy *accuracy.Tracker
+
+	// events are where the quotes served to clients are published, for analytics.
+	events events.Publisher
+
+	// lifecycle reports whether the components of the service are ready. May be nil.
+	lifecycle *lifecycle.Manager
+
+	// quoteLog records the options served to clients, for later analysis. May be nil.
+	quoteLog *quotelog.Log
+
+	// h3 serves the same routes as srv, but over HTTP/3. May be nil.
+	h3 *http3.Server
+
+	// clock is what the server tells the time with; for example, to check whether a token has expired.
+	clock clock.Clock
 }
 
 // New generates a new server, appropriately configured
-func New(carriers *carriers.Carriers) *Server {
-	srv := &Server{
-		carriers: carriers,
+func New(carriers *carriers.Carriers, opts ...Option) (*Server, error) {
+	srv := &Server{}
+	srv.carriers.Store(carriers)
+
+	for _, o := range opts {
+		if err := o(srv); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrFailedToApplyOption, err)
+		}
+	}
+
+	srv.clock = clock.Or(srv.clock)
+
+	// If there is no meter, use the global one.
+	if srv.opts.m == nil {
+		srv.opts.m = otel.Meter("github.com/andrewhowdencom/courses.pito/delivery-service/server")
+	}
+
+	var err error
+	if srv.metrics.cpu, err = srv.opts.m.Float64Histogram(
+		"http.server.request.cpu",
+		metric.WithDescription("The CPU time used by the process while handling the request"),
+		metric.WithUnit("s"),
+	); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFailedToCreateMetrics, err)
+	}
+
+	if srv.metrics.allocs, err = srv.opts.m.Int64Histogram(
+		"http.server.request.allocations",
+		metric.WithDescription("The memory allocated by the process while handling the request"),
+		metric.WithUnit("By"),
+	); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFailedToCreateMetrics, err)
+	}
+
+	// If there is no quote store, keep the quotes in memory so options can still be booked.
+	if srv.quotes == nil {
+		// An in memory store cannot fail to open.
+		srv.quotes, _ = quotes.Open("", quotes.WithClock(srv.clock))
+	}
+
+	// If there is no tracker, create one. Shipments can be created, but do not progress unless it is run.
+	if srv.tracker == nil {
+		srv.tracker = tracking.New(tracking.Profiles, tracking.WithClock(srv.clock))
+	}
+
+	// If there is no usage store, keep usage in memory.
+	if srv.usage == nil {
+		// An in memory store cannot fail to open.
+		srv.usage, _ = usage.Open("", usage.WithClock(srv.clock))
+	}
+
+	// If there is nowhere to publish events, drop them.
+	if srv.events == nil {
+		srv.events = events.Discard
+	}
+
+	// If there is no accuracy tracker, create one. Confirmations are then only kept in memory.
+	if srv.accuracy == nil {
+		a, err := accuracy.New(accuracy.Defaults...)
+		if err != nil {
+			return nil, err
+		}
+
+		srv.accuracy = a
+	}
+
+	// If there are no experiments, run none. Every client is then (implicitly) in the control.
+	if srv.experiments.Load() == nil {
+		e, err := experiments.New(nil, experiments.Defaults...)
+		if err != nil {
+			return nil, err
+		}
+
+		srv.experiments.Store(e)
+	}
+
+	// If there are no signing keys, generate one. Tokens can then be verified, but only until the server restarts.
+	if srv.keys == nil {
+		k, err := quotes.EphemeralKeys()
+		if err != nil {
+			return nil, err
+		}
+
+		srv.keys = k
 	}
 
 	mux := http.NewServeMux()
@@ -34,21 +196,168 @@ func New(carriers *carriers.Carriers) *Server {
 		// The second argument is the handler. However, the actual handler is wrapped in the middleware handler
 		// that instruments the request and response.
 		otelhttp.NewHandler(
-			// The first argument converts the "handler func" to a "handler"
-			http.HandlerFunc(srv.healthz),
+			// The first argument converts the "handler func" to a "handler", and attributes the resources it uses to
+			// the route.
+			srv.attributed("healthz", http.HandlerFunc(srv.healthz)),
 
 			// The second argument will be used as the operation name in the metrics and traces.
 			"healthz",
 		),
 	)
 
-	mux.Handle("/delivery-options", otelhttp.NewHandler(http.HandlerFunc(srv.deliveryOptions), "delivery-options"))
+	mux.Handle("/readyz", otelhttp.NewHandler(srv.attributed("readyz", http.HandlerFunc(srv.readyz)), "readyz"))
+	mux.Handle("/delivery-options", otelhttp.NewHandler(srv.attributed("delivery-options", srv.metered(http.HandlerFunc(srv.deliveryOptions))), "delivery-options"))
+	mux.Handle("/quotes/verify", otelhttp.NewHandler(srv.attributed("verify-quote", http.HandlerFunc(srv.verifyQuote)), "verify-quote"))
+	mux.Handle("/bookings", otelhttp.NewHandler(srv.attributed("bookings", http.HandlerFunc(srv.bookings)), "bookings"))
+	mux.Handle("/shipments", otelhttp.NewHandler(srv.attributed("create-shipment", http.HandlerFunc(srv.createShipment)), "create-shipment"))
+	mux.Handle("/shipments/", otelhttp.NewHandler(srv.attributed("shipment", http.HandlerFunc(srv.shipment)), "shipment"))
+	mux.Handle("/deliveries", otelhttp.NewHandler(srv.attributed("deliveries", http.HandlerFunc(srv.deliveries)), "deliveries"))
+	mux.Handle("/accuracy", otelhttp.NewHandler(srv.attributed("accuracy", http.HandlerFunc(srv.accuracySummary)), "accuracy"))
 	srv.srv = &http.Server{
 		Addr:    "localhost:9093",
 		Handler: mux,
 	}
 
-	return srv
+	// The admin routes reveal what every client does, and how the service is configured; so are only served on the
+	// admin address.
+	admin := http.NewServeMux()
+	admin.Handle("/usage", otelhttp.NewHandler(srv.attributed("usage", http.HandlerFunc(srv.usageReport)), "usage"))
+	admin.Handle("/admin/carriers", otelhttp.NewHandler(srv.attributed("admin-carriers", http.HandlerFunc(srv.adminCarriers)), "admin-carriers"))
+
+	srv.admin = &http.Server{
+		Addr:    "localhost:9096",
+		Handler: admin,
+	}
+
+	// HTTP/3 shares the routes (and their instrumentation) with HTTP/1.1, such that the two can be compared.
+	if srv.h3 != nil {
+		srv.srv.Handler = srv.altSvc(mux)
+		srv.h3.Handler = http3Proto(mux)
+	}
+
+	return srv, nil
+}
+
+// WithClock sets the clock the server tells the time with. The clocks of the quote store and tracker (if they are
+// supplied) are set separately.
+func WithClock(c clock.Clock) Option {
+	return func(srv *Server) error {
+		srv.clock = c
+
+		return nil
+	}
+}
+
+// WithMeter applies a specific meter to the server. Used mostly in testing.
+func WithMeter(m metric.Meter) Option {
+	return func(srv *Server) error {
+		srv.opts.m = m
+
+		return nil
+	}
+}
+
+// WithExperiments runs the experiments. The carriers should be wrapped in the middleware of the same experiments, such
+// that the variants of the client are applied to the options they return.
+func WithExperiments(e *experiments.Set) Option {
+	return func(srv *Server) error {
+		srv.experiments.Store(e)
+
+		return nil
+	}
+}
+
+// WithExchangeRates allows clients to request the cost of delivery options in a currency of their choosing.
+func WithExchangeRates(r *money.Rates) Option {
+	return func(srv *Server) error {
+		srv.rates = r
+
+		return nil
+	}
+}
+
+// WithQuoteStore sets where the quotes offered to clients are kept.
+func WithQuoteStore(q *quotes.Store) Option {
+	return func(srv *Server) error {
+		srv.quotes = q
+
+		return nil
+	}
+}
+
+// WithSigningKeys sets the keys used to sign, and verify, the options offered to clients.
+func WithSigningKeys(k *quotes.Keys) Option {
+	return func(srv *Server) error {
+		srv.keys = k
+
+		return nil
+	}
+}
+
+// WithTracker sets the tracker that follows packages once they are shipped.
+func WithTracker(t *tracking.Tracker) Option {
+	return func(srv *Server) error {
+		srv.tracker = t
+
+		return nil
+	}
+}
+
+// WithUsageStore sets where the usage of each client is accounted.
+func WithUsageStore(u *usage.Store) Option {
+	return func(srv *Server) error {
+		srv.usage = u
+
+		return nil
+	}
+}
+
+// WithAccuracyTracker sets the tracker that compares the arrival quoted by carriers with the actual delivery.
+func WithAccuracyTracker(a *accuracy.Tracker) Option {
+	return func(srv *Server) error {
+		srv.accuracy = a
+
+		return nil
+	}
+}
+
+// WithEventPublisher sets where the quotes served to clients are published, for analytics.
+func WithEventPublisher(p events.Publisher) Option {
+	return func(srv *Server) error {
+		srv.events = p
+
+		return nil
+	}
+}
+
+// WithQuoteLog records the options served to clients in the log.
+func WithQuoteLog(l *quotelog.Log) Option {
+	return func(srv *Server) error {
+		srv.quoteLog = l
+
+		return nil
+	}
+}
+
+// WithLifecycle reports the state of the components started by the manager on "/readyz".
+func WithLifecycle(m *lifecycle.Manager) Option {
+	return func(srv *Server) error {
+		srv.lifecycle = m
+
+		return nil
+	}
+}
+
+// SetCarriers replaces the carriers that are queried for each package. Requests in progress continue with the
+// carriers they started with.
+func (srv *Server) SetCarriers(c *carriers.Carriers) {
+	srv.carriers.Store(c)
+}
+
+// SetExperiments replaces the experiments that are running. Requests in progress continue with the experiments they
+// started with.
+func (srv *Server) SetExperiments(e *experiments.Set) {
+	srv.experiments.Store(e)
 }
 
 func (s *Server) Listen(addr string) error {
@@ -57,6 +366,29 @@ func (s *Server) Listen(addr string) error {
 	return s.srv.ListenAndServe()
 }
 
-func (s *Server) Shutdown() error {
-	return s.srv.Shutdown(context.Background())
+// Serve accepts connections on a listener that has already been bound. Binding first allows failures (such as the
+// address being in use) to be handled before the server is considered started.
+func (s *Server) Serve(l net.Listener) error {
+	s.srv.Addr = l.Addr().String()
+
+	return s.srv.Serve(l)
+}
+
+// ServeAdmin accepts connections for the admin routes (such as /usage) on a listener that has already been bound.
+func (s *Server) ServeAdmin(l net.Listener) error {
+	s.admin.Addr = l.Addr().String()
+
+	return s.admin.Serve(l)
+}
+
+// Shutdown stops accepting connections, and waits for those in progress to finish until the context is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	// Hint: The HTTP/3 server cannot (yet) wait for requests in progress; they are cut off.
+	if s.h3 != nil {
+		if err := s.h3.Close(); err != nil {
+			return err
+		}
+	}
+
+	return errors.Join(s.admin.Shutdown(ctx), s.srv.Shutdown(ctx))
 }
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/problem"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/quotes"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/tracking"
+)
+
+// ShipmentRequest is the body of a request to create a shipment.
+type ShipmentRequest struct {
+	QuoteID string `json:"quote_id"`
+}
+
+// createShipment starts tracking a package from a quote that has been booked.
+func (srv *Server) createShipment(w http.ResponseWriter, r *http.Request) {
+	jw := json.NewEncoder(w)
+
+	if r.Method != http.MethodPost {
+		w.Header().Add("Allow", http.MethodPost)
+		w.Header().Add("Content-Type", problem.HTTPContentTypeJSON)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+
+		// Hint: This can fail, but it is ignored.
+		jw.Encode(&problem.Problem{
+			Type:   "delivery-options.local/problems/method-not-allowed",
+			Title:  "The method is not allowed",
+			Detail: fmt.Sprintf("Shipments can only be created with %s", http.MethodPost),
+		})
+		return
+	}
+
+	req := &ShipmentRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil || req.QuoteID == "" {
+		w.Header().Add("Content-Type", problem.HTTPContentTypeJSON)
+		w.WriteHeader(http.StatusBadRequest)
+
+		// Hint: This can fail, but it is ignored.
+		jw.Encode(&problem.Problem{
+			Type:   "delivery-options.local/problems/bad-body",
+			Title:  "Missing or malformed request body",
+			Detail: `The request body must be a JSON object with a "quote_id"`,
+		})
+		return
+	}
+
+	q, err := srv.quotes.Get(req.QuoteID)
+	if errors.Is(err, quotes.ErrNotFound) {
+		w.Header().Add("Content-Type", problem.HTTPContentTypeJSON)
+		w.WriteHeader(http.StatusNotFound)
+
+		// Hint: This can fail, but it is ignored.
+		jw.Encode(&problem.Problem{
+			Type:   "delivery-options.local/problems/unknown-quote",
+			Title:  "The quote does not exist",
+			Detail: fmt.Sprintf("There is no quote with the ID %q", req.QuoteID),
+		})
+		return
+	}
+
+	var s *tracking.Shipment
+	if err == nil {
+		s, err = srv.tracker.Create(q)
+	}
+
+	switch {
+	case err == nil:
+		w.Header().Add("Content-Type", "application/json")
+		w.Header().Add("Location", "/shipments/"+s.ID)
+		w.WriteHeader(http.StatusCreated)
+		jw.Encode(s)
+
+	case errors.Is(err, tracking.ErrNotBooked):
+		w.Header().Add("Content-Type", problem.HTTPContentTypeJSON)
+		w.WriteHeader(http.StatusConflict)
+
+		// Hint: This can fail, but it is ignored.
+		jw.Encode(&problem.Problem{
+			Type:   "delivery-options.local/problems/quote-not-booked",
+			Title:  "The quote has not been booked",
+			Detail: "Only booked quotes can be shipped. Book the quote via /bookings first",
+		})
+
+	case errors.Is(err, tracking.ErrShipped):
+		w.Header().Add("Content-Type", problem.HTTPContentTypeJSON)
+		w.WriteHeader(http.StatusConflict)
+
+		// Hint: This can fail, but it is ignored.
+		jw.Encode(&problem.Problem{
+			Type:   "delivery-options.local/problems/quote-already-shipped",
+			Title:  "The quote has already been shipped",
+			Detail: fmt.Sprintf("A shipment has already been created for the quote %q", req.QuoteID),
+		})
+
+	default:
+		w.Header().Add("Content-Type", problem.HTTPContentTypeJSON)
+		w.WriteHeader(http.StatusInternalServerError)
+
+		// Hint: This can fail, but it is ignored.
+		jw.Encode(&problem.Problem{
+			Type:   "delivery-options.local/server/internal-server-error",
+			Title:  "An unexpected server error has occurred",
+			Detail: "An error that is not handled within the software has occurred. Please check telemetry for details",
+		})
+	}
+}
+
+// shipment returns either the current state of a shipment (/shipments/{id}) or every state it has been in
+// (/shipments/{id}/history).
+func (srv *Server) shipment(w http.ResponseWriter, r *http.Request) {
+	jw := json.NewEncoder(w)
+
+	id, sub, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/shipments/"), "/")
+
+	var out any
+	var err error
+
+	switch sub {
+	case "":
+		out, err = srv.tracker.Get(id)
+	case "history":
+		out, err = srv.tracker.History(id)
+	default:
+		err = tracking.ErrNotFound
+	}
+
+	if err != nil {
+		w.Header().Add("Content-Type", problem.HTTPContentTypeJSON)
+		w.WriteHeader(http.StatusNotFound)
+
+		// Hint: This can fail, but it is ignored.
+		jw.Encode(&problem.Problem{
+			Type:   "delivery-options.local/problems/unknown-shipment",
+			Title:  "The shipment does not exist",
+			Detail: fmt.Sprintf("There is no shipment at %q", r.URL.Path),
+		})
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	jw.Encode(out)
+}
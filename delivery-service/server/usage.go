@@ -0,0 +1,91 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/problem"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/usage"
+)
+
+// statusRecorder remembers the status code written to the response, so that it can be inspected after the handler
+// has finished.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.status = status
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+// metered records the usage of the handler against the client that made the request.
+func (srv *Server) metered(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sr := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sr, r)
+
+		c := usage.Counts{Requests: 1}
+		if sr.status >= http.StatusBadRequest {
+			c.Errors = 1
+		}
+
+		srv.usage.Record(usage.Identify(r), srv.clock.Now(), c)
+	})
+}
+
+// usageReport returns how much each client has used the service between two days (inclusive). For example,
+//
+//	/usage?from=2023-09-01&to=2023-09-30&client=ip:127.0.0.1
+func (srv *Server) usageReport(w http.ResponseWriter, r *http.Request) {
+	jw := json.NewEncoder(w)
+	values := r.URL.Query()
+
+	// By default, report on today.
+	today := srv.clock.Now().UTC().Format(usage.DayFormat)
+	from, to := today, today
+
+	if values.Has("from") {
+		from = values.Get("from")
+	}
+
+	if values.Has("to") {
+		to = values.Get("to")
+	}
+
+	_, errFrom := time.Parse(usage.DayFormat, from)
+	_, errTo := time.Parse(usage.DayFormat, to)
+
+	if errFrom != nil || errTo != nil {
+		w.Header().Add("Content-Type", problem.HTTPContentTypeJSON)
+		w.WriteHeader(http.StatusBadRequest)
+
+		// Hint: This can fail, but it is ignored.
+		jw.Encode(&problem.Problem{
+			Type:   "delivery-options.local/problems/bad-parameters",
+			Title:  "Missing or malformed input parameters",
+			Detail: fmt.Sprintf("The parameters from and to must be days, formatted as %s", usage.DayFormat),
+		})
+		return
+	}
+
+	rows, err := srv.usage.Report(from, to, values.Get("client"))
+	if err != nil {
+		w.Header().Add("Content-Type", problem.HTTPContentTypeJSON)
+		w.WriteHeader(http.StatusInternalServerError)
+
+		// Hint: This can fail, but it is ignored.
+		jw.Encode(&problem.Problem{
+			Type:   "delivery-options.local/server/internal-server-error",
+			Title:  "An unexpected server error has occurred",
+			Detail: "An error that is not handled within the software has occurred. Please check telemetry for details",
+		})
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	jw.Encode(rows)
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/problem"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/quotes"
+)
+
+// VerifyRequest is the body of a request to verify a quote token.
+type VerifyRequest struct {
+	Token string `json:"token"`
+}
+
+// verifyQuote checks a token attached to a delivery option, and returns what was quoted if it is genuine and has not
+// yet expired.
+func (srv *Server) verifyQuote(w http.ResponseWriter, r *http.Request) {
+	jw := json.NewEncoder(w)
+
+	if r.Method != http.MethodPost {
+		w.Header().Add("Allow", http.MethodPost)
+		w.Header().Add("Content-Type", problem.HTTPContentTypeJSON)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+
+		// Hint: This can fail, but it is ignored.
+		jw.Encode(&problem.Problem{
+			Type:   "delivery-options.local/problems/method-not-allowed",
+			Title:  "The method is not allowed",
+			Detail: fmt.Sprintf("Tokens can only be verified with %s", http.MethodPost),
+		})
+		return
+	}
+
+	req := &VerifyRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil || req.Token == "" {
+		w.Header().Add("Content-Type", problem.HTTPContentTypeJSON)
+		w.WriteHeader(http.StatusBadRequest)
+
+		// Hint: This can fail, but it is ignored.
+		jw.Encode(&problem.Problem{
+			Type:   "delivery-options.local/problems/bad-body",
+			Title:  "Missing or malformed request body",
+			Detail: `The request body must be a JSON object with a "token"`,
+		})
+		return
+	}
+
+	claims, err := srv.keys.VerifyAt(req.Token, srv.clock.Now())
+
+	switch {
+	case err == nil:
+		w.Header().Add("Content-Type", "application/json")
+		jw.Encode(claims)
+
+	case errors.Is(err, quotes.ErrTokenExpired):
+		w.Header().Add("Content-Type", problem.HTTPContentTypeJSON)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+
+		// Hint: This can fail, but it is ignored.
+		jw.Encode(&problem.Problem{
+			Type:   "delivery-options.local/problems/quote-token-expired",
+			Title:  "The quote token has expired",
+			Detail: fmt.Sprintf("The token is genuine, but the quote expired at %s", claims.Expires),
+		})
+
+	case errors.Is(err, quotes.ErrInvalidSignature):
+		w.Header().Add("Content-Type", problem.HTTPContentTypeJSON)
+		w.WriteHeader(http.StatusUnprocessableEntity)
+
+		// Hint: This can fail, but it is ignored.
+		jw.Encode(&problem.Problem{
+			Type:   "delivery-options.local/problems/quote-token-invalid-signature",
+			Title:  "The quote token signature is invalid",
+			Detail: "The token was not issued by this service, or has been modified since it was issued",
+		})
+
+	default:
+		w.Header().Add("Content-Type", problem.HTTPContentTypeJSON)
+		w.WriteHeader(http.StatusBadRequest)
+
+		// Hint: This can fail, but it is ignored.
+		jw.Encode(&problem.Problem{
+			Type:   "delivery-options.local/problems/quote-token-malformed",
+			Title:  "The quote token is malformed",
+			Detail: "The token could not be understood. It should be exactly as it was returned with the delivery option",
+		})
+	}
+}
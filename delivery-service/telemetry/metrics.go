@@ -1,8 +1,10 @@
 package telemetry
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 
 	"log/slog"
@@ -17,6 +19,9 @@ import (
 
 var Log *slog.Logger
 
+// provider is the meter provider bootstrapped by SetupOTelMetrics, kept such that it can be shut down.
+var provider *metric.MeterProvider
+
 var (
 	ErrFailedSetup    = errors.New("failed to setup telemetry")
 	ErrFailedExporter = errors.New("failed to setup exporter")
@@ -26,41 +31,86 @@ var (
 // exporting the data to different "sinks".
 type WithReader func() (metric.Reader, error)
 
-// WithPrometheusHTTP sets up the promethus exporter, as well as starts a HTTP instance on the specified address / port
-// with the "/metrics" endpoint exposed.
-func WithPrometheusHTTP(listenOn string) func() (metric.Reader, error) {
+// Prometheus is an exporter that serves the metrics over HTTP on the "/metrics" endpoint, in the format Prometheus
+// scrapes.
+type Prometheus struct {
+	registry *prometheus.Registry
+	srv      *http.Server
+}
+
+// NewPrometheusHTTP creates an exporter that will serve the metrics on the specified address / port, once started.
+func NewPrometheusHTTP(listenOn string) *Prometheus {
 	promRegistry := prometheus.NewRegistry()
 	mux := http.NewServeMux()
 	mux.Handle("/metrics", promhttp.InstrumentMetricHandler(
 		promRegistry, promhttp.HandlerFor(promRegistry, promhttp.HandlerOpts{}),
 	))
 
-	// Here, unfortunately there's not a lot we can do to determine whether the server was successful. Listening to a
-	// socket requires a blocking goroutine. Given this, we simply log if there's a failure to instantiate metrics.
-	go func() {
-		srv := http.Server{
+	return &Prometheus{
+		registry: promRegistry,
+		srv: &http.Server{
 			Addr:    listenOn,
 			Handler: mux,
-		}
+		},
+	}
+}
+
+// Reader creates the reader that the metrics are collected with, for use with SetupOTelMetrics.
+func (p *Prometheus) Reader() (metric.Reader, error) {
+	exporter, err := otelprom.New(
+		otelprom.WithRegisterer(p.registry),
+	)
+
+	// If we fail to setup the registry or exporter (somehow), there's no point in bootstrapping the telemetry. We
+	// thus return an error to indicate the failure.
+	if err != nil {
+		return nil, err
+	}
+
+	return exporter, nil
+}
+
+// Handler serves the metrics, for mounting on a server other than the one started by Listen.
+func (p *Prometheus) Handler() http.Handler {
+	return p.srv.Handler
+}
+
+// Listen binds the address, and serves the metrics in the background. Unlike ListenAndServe, failing to bind (for
+// example, because the port is in use) is returned rather than only logged.
+func (p *Prometheus) Listen() error {
+	l, err := net.Listen("tcp", p.srv.Addr)
+	if err != nil {
+		return err
+	}
 
-		if err := srv.ListenAndServe(); err != nil {
-			Log.Error("failed to start metrics handler: %s", err)
+	go func() {
+		if err := p.srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			Log.Error("failed to serve metrics", "error", err)
 		}
 	}()
 
-	return func() (metric.Reader, error) {
-		exporter, err := otelprom.New(
-			otelprom.WithRegisterer(promRegistry),
-		)
+	return nil
+}
 
-		// If we fail to setup the registry or exporter (somehow), there's no point in bootstrapping the telemetry. We
-		// thus return an error to indicate the failure.
-		if err != nil {
-			return nil, err
+// Shutdown stops serving the metrics.
+func (p *Prometheus) Shutdown(ctx context.Context) error {
+	return p.srv.Shutdown(ctx)
+}
+
+// WithPrometheusHTTP sets up the promethus exporter, as well as starts a HTTP instance on the specified address / port
+// with the "/metrics" endpoint exposed.
+func WithPrometheusHTTP(listenOn string) func() (metric.Reader, error) {
+	p := NewPrometheusHTTP(listenOn)
+
+	// Here, unfortunately there's not a lot we can do to determine whether the server was successful. Listening to a
+	// socket requires a blocking goroutine. Given this, we simply log if there's a failure to instantiate metrics.
+	go func() {
+		if err := p.srv.ListenAndServe(); err != nil {
+			Log.Error("failed to start metrics handler", "error", err)
 		}
+	}()
 
-		return exporter, nil
-	}
+	return p.Reader
 }
 
 // SetupOTelMetrics sets up the OpenTelemetry metrics provider with the Prometheus exporter. This allows using the in-process
@@ -83,7 +133,7 @@ func SetupOTelMetrics(exporters ...func() (metric.Reader, error)) error {
 	}
 
 	// Create the "meter provider" — the thing that will be used to create metrics.
-	provider := metric.NewMeterProvider(opts...)
+	provider = metric.NewMeterProvider(opts...)
 
 	// Set the global "meter provider". This can be queried on a per package basis as the default "meter provider",
 	// and overridden in specific cases where code needs to be tested.
@@ -91,3 +141,13 @@ func SetupOTelMetrics(exporters ...func() (metric.Reader, error)) error {
 
 	return nil
 }
+
+// ShutdownOTelMetrics flushes and stops the meter provider bootstrapped by SetupOTelMetrics. Metrics recorded
+// afterwards are dropped.
+func ShutdownOTelMetrics(ctx context.Context) error {
+	if provider == nil {
+		return nil
+	}
+
+	return provider.Shutdown(ctx)
+}
@@ -0,0 +1,81 @@
+package telemetry
+
+import (
+	"context"
+	"log/slog"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// tracerProvider is the tracer provider bootstrapped by SetupOTelTraces, kept such that it can be shut down.
+var tracerProvider *trace.TracerProvider
+
+// SetupOTelTraces sets up the OpenTelemetry tracer provider, such that spans are recorded (rather than the no-op spans
+// of the default provider) and handed to the exporters. Every request is traced, unless the caller of the request
+// decided against it (in the "traceparent" header).
+//
+// As with the metrics, the objects it bootstraps are global.
+func SetupOTelTraces(exporters ...trace.SpanExporter) error {
+	opts := []trace.TracerProviderOption{
+		trace.WithSampler(trace.ParentBased(trace.AlwaysSample())),
+	}
+
+	for _, e := range exporters {
+		opts = append(opts, trace.WithBatcher(e))
+	}
+
+	tracerProvider = trace.NewTracerProvider(opts...)
+
+	otel.SetTracerProvider(tracerProvider)
+
+	// Continue the traces of callers that propagate them.
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return nil
+}
+
+// ShutdownOTelTraces exports the spans that are yet to be, and stops the tracer provider bootstrapped by
+// SetupOTelTraces.
+func ShutdownOTelTraces(ctx context.Context) error {
+	if tracerProvider == nil {
+		return nil
+	}
+
+	return tracerProvider.Shutdown(ctx)
+}
+
+// LogExporter is an exporter that writes each span to the log, at the debug level. It is a stand in for an exporter to
+// a tracing backend, such that the spans (and their attributes) can be seen without one; for example, with
+// -log-level=debug.
+type LogExporter struct{}
+
+func (LogExporter) ExportSpans(ctx context.Context, spans []trace.ReadOnlySpan) error {
+	if !Log.Enabled(ctx, slog.LevelDebug) {
+		return nil
+	}
+
+	for _, s := range spans {
+		attrs := make([]any, 0, len(s.Attributes()))
+		for _, kv := range s.Attributes() {
+			attrs = append(attrs, slog.Any(string(kv.Key), kv.Value.AsInterface()))
+		}
+
+		Log.DebugContext(ctx, "span",
+			"name", s.Name(),
+			"trace_id", s.SpanContext().TraceID().String(),
+			"span_id", s.SpanContext().SpanID().String(),
+			"parent_id", s.Parent().SpanID().String(),
+			"duration", s.EndTime().Sub(s.StartTime()),
+			"status", s.Status().Code.String(),
+			slog.Group("attributes", attrs...),
+		)
+	}
+
+	return nil
+}
+
+func (LogExporter) Shutdown(context.Context) error {
+	return nil
+}
@@ -0,0 +1,359 @@
+// package tracking follows packages after they have been booked, from the label being created to the package being
+// delivered. As the carriers are simulated, so are the shipments; each moves through its lifecycle on a clock that
+// runs faster than real time.
+package tracking
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	mrand "math/rand"
+	"sync"
+	"time"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/clock"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/quotes"
+)
+
+var (
+	ErrNotFound  = errors.New("shipment not found")
+	ErrNotBooked = errors.New("quote not booked")
+	ErrShipped   = errors.New("quote already shipped")
+)
+
+// State is a step in the lifecycle of a shipment.
+type State string
+
+const (
+	StateLabelCreated   State = "label-created"
+	StatePickedUp       State = "picked-up"
+	StateInTransit      State = "in-transit"
+	StateOutForDelivery State = "out-for-delivery"
+	StateDelivered      State = "delivered"
+
+	// StateException indicates something went wrong (for example, the package was damaged). It is final.
+	StateException State = "exception"
+)
+
+// Profile describes how shipments with a given provider behave.
+type Profile struct {
+	// Speed is how many times faster than real time the clock of the carrier runs. For example, 3600 means that an
+	// hour passes every second.
+	Speed float64
+
+	// ExceptionRate is the probability (between 0 and 1) that something goes wrong with a shipment.
+	ExceptionRate float64
+}
+
+// DefaultProfile is used for providers without a profile of their own.
+var DefaultProfile = Profile{Speed: 3600, ExceptionRate: 0.05}
+
+// Profiles are the profiles of the simulated providers. Each is slow (or clumsy) in its own way.
+var Profiles = map[string]Profile{
+	"svx": {Speed: 3600, ExceptionRate: 0.02},
+	"mmc": {Speed: 7200, ExceptionRate: 0.05},
+	"hid": {Speed: 1800, ExceptionRate: 0.15},
+}
+
+// DefaultRetention is how long shipments are kept after they reach their final state (delivered, or an exception).
+// It is longer than quotes are kept (see quotes.DefaultRetention), such that a quote cannot be shipped again once its
+// shipment has been removed. See WithRetention.
+const DefaultRetention = 48 * time.Hour
+
+// Event records a shipment changing state.
+type Event struct {
+	ShipmentID string    `json:"shipment_id"`
+	Provider   string    `json:"provider"`
+	Reference  string    `json:"reference"`
+	State      State     `json:"state"`
+	At         time.Time `json:"at"`
+}
+
+// step is a planned state change, at an offset (in simulated time) from when the shipment was created.
+type step struct {
+	state State
+	after time.Duration
+}
+
+// Shipment is a package that is on its way.
+type Shipment struct {
+	ID string `json:"id"`
+
+	// QuoteID is the quote that was booked to create the shipment.
+	QuoteID string `json:"quote_id"`
+
+	// Provider and Reference identify the shipment with the carrier.
+	Provider  string `json:"provider"`
+	Reference string `json:"reference"`
+
+	// State is the current state of the shipment, and Updated when it entered that state.
+	State   State     `json:"state"`
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+
+	// history is every state change so far, oldest first.
+	history []Event
+
+	// plan is the state changes that are yet to happen, soonest first.
+	plan []step
+
+	// speed is how fast the clock of the carrier runs.
+	speed float64
+}
+
+// Tracker keeps track of all shipments, and moves them through their lifecycle.
+type Tracker struct {
+	mu        sync.RWMutex
+	shipments map[string]*Shipment
+
+	// shipped maps each quote to the shipment created from it, such that a quote can only be shipped once.
+	shipped map[string]string
+
+	// profiles are how shipments behave, keyed by provider.
+	profiles map[string]Profile
+
+	// subscribers are notified of every state change.
+	subscribers []func(Event)
+
+	// clock is what shipments are created, and advanced, by.
+	clock clock.Clock
+
+	// retention is how long shipments are kept after they reach their final state.
+	retention time.Duration
+
+	// rand is the source of randomness for whether (and when) something goes wrong with a shipment. If nil, the global
+	// source is used. It is only used while the tracker is locked.
+	rand *mrand.Rand
+}
+
+// Option modifies the tracker as it is created.
+type Option func(t *Tracker)
+
+// New creates a tracker with the supplied profiles, keyed by provider.
+func New(profiles map[string]Profile, opts ...Option) *Tracker {
+	t := &Tracker{
+		shipments: make(map[string]*Shipment),
+		shipped:   make(map[string]string),
+		profiles:  profiles,
+		retention: DefaultRetention,
+	}
+
+	for _, o := range opts {
+		o(t)
+	}
+
+	t.clock = clock.Or(t.clock)
+
+	return t
+}
+
+// WithClock sets the clock that shipments are created, and advanced, by.
+func WithClock(c clock.Clock) Option {
+	return func(t *Tracker) {
+		t.clock = c
+	}
+}
+
+// WithRand sets the source of randomness for whether (and when) something goes wrong with a shipment. With the same
+// source (and the same sequence of shipments), the same shipments go wrong every time.
+func WithRand(r *mrand.Rand) Option {
+	return func(t *Tracker) {
+		t.rand = r
+	}
+}
+
+// WithRetention sets how long shipments are kept after they reach their final state. After that, they (and their
+// history) can no longer be found.
+func WithRetention(d time.Duration) Option {
+	return func(t *Tracker) {
+		t.retention = d
+	}
+}
+
+// Len is the number of shipments being tracked.
+func (t *Tracker) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return len(t.shipments)
+}
+
+// Subscribe registers a function to be called for every state change. It is called while the tracker is locked, so
+// it must not call back into the tracker.
+func (t *Tracker) Subscribe(fn func(Event)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.subscribers = append(t.subscribers, fn)
+}
+
+// Create starts tracking the package from a booked quote. The lifecycle is planned up front, such that the package is
+// delivered at the arrival that was quoted (unless something goes wrong).
+func (t *Tracker) Create(q *quotes.Quote) (*Shipment, error) {
+	if q.Booking == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNotBooked, q.ID)
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if sid, ok := t.shipped[q.ID]; ok {
+		return nil, fmt.Errorf("%w: %s as %s", ErrShipped, q.ID, sid)
+	}
+
+	profile, ok := t.profiles[q.Option.Provider]
+	if !ok {
+		profile = DefaultProfile
+	}
+
+	now := t.clock.Now()
+	s := &Shipment{
+		ID:        hex.EncodeToString(id),
+		QuoteID:   q.ID,
+		Provider:  q.Option.Provider,
+		Reference: q.Booking.Reference,
+		Created:   now,
+		plan:      plan(t.rand, q.Option.Arrival.Sub(now), profile.ExceptionRate),
+		speed:     profile.Speed,
+	}
+
+	t.shipments[s.ID] = s
+	t.shipped[q.ID] = s.ID
+	t.transition(s, StateLabelCreated, now)
+
+	return s.copy(), nil
+}
+
+// Get returns the current state of the shipment.
+func (t *Tracker) Get(id string) (*Shipment, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	s, ok := t.shipments[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+
+	return s.copy(), nil
+}
+
+// History returns every state change of the shipment so far, oldest first.
+func (t *Tracker) History(id string) ([]Event, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	s, ok := t.shipments[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+
+	return append([]Event{}, s.history...), nil
+}
+
+// Advance moves every shipment through the state changes that should have happened by the supplied time. Shipments
+// that reached their final state longer than the retention ago are removed.
+func (t *Tracker) Advance(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for id, s := range t.shipments {
+		if len(s.plan) == 0 && now.Sub(s.Updated) > t.retention {
+			delete(t.shipments, id)
+			delete(t.shipped, s.QuoteID)
+
+			continue
+		}
+
+		// How much time has passed, according to the clock of the carrier.
+		elapsed := time.Duration(float64(now.Sub(s.Created)) * s.speed)
+
+		for len(s.plan) > 0 && s.plan[0].after <= elapsed {
+			// The state change is recorded at the (real) time it would have happened, rather than the time we
+			// noticed.
+			at := s.Created.Add(time.Duration(float64(s.plan[0].after) / s.speed))
+
+			t.transition(s, s.plan[0].state, at)
+			s.plan = s.plan[1:]
+		}
+	}
+}
+
+// Run advances the shipments every interval, until the context is cancelled.
+func (t *Tracker) Run(ctx context.Context, interval time.Duration) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.clock.After(interval):
+			t.Advance(now)
+		}
+	}
+}
+
+// transition records the shipment entering a new state, and notifies the subscribers. The lock must be held.
+func (t *Tracker) transition(s *Shipment, state State, at time.Time) {
+	e := Event{
+		ShipmentID: s.ID,
+		Provider:   s.Provider,
+		Reference:  s.Reference,
+		State:      state,
+		At:         at,
+	}
+
+	s.State = state
+	s.Updated = at
+	s.history = append(s.history, e)
+
+	for _, fn := range t.subscribers {
+		fn(e)
+	}
+}
+
+// copy returns a copy of the shipment that is safe to use without holding the lock.
+func (s *Shipment) copy() *Shipment {
+	c := *s
+	c.history = nil
+	c.plan = nil
+
+	return &c
+}
+
+// plan works out when each state change happens, such that the package is delivered after the supplied duration. If
+// something goes wrong (drawn from r or, if nil, the global source), the plan ends in an exception instead.
+func plan(r *mrand.Rand, until time.Duration, exceptionRate float64) []step {
+	// Carriers pick up a couple of hours after the label is created, and go out for delivery on the morning of the
+	// day. However, packages that are due very soon squeeze all of that into the time that is left.
+	steps := []step{
+		{state: StatePickedUp, after: 2 * time.Hour},
+		{state: StateInTransit, after: 6 * time.Hour},
+		{state: StateOutForDelivery, after: until - 4*time.Hour},
+		{state: StateDelivered, after: until},
+	}
+
+	for i := range steps {
+		if i > 0 && steps[i].after <= steps[i-1].after {
+			steps[i].after = steps[i-1].after + time.Minute
+		}
+	}
+
+	// Something can go wrong at any point after the package has been picked up.
+	chance, pick := mrand.Float64, mrand.Intn
+	if r != nil {
+		chance, pick = r.Float64, r.Intn
+	}
+
+	if chance() < exceptionRate {
+		i := 1 + pick(len(steps)-1)
+		steps[i].state = StateException
+		steps = steps[:i+1]
+	}
+
+	return steps
+}
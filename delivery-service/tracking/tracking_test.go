@@ -0,0 +1,154 @@
+package tracking
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/carriers"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/clock"
+	"github.com/andrewhowdencom/courses.pito/delivery-service/quotes"
+)
+
+func bookedQuote(id string, arrival time.Time) *quotes.Quote {
+	return &quotes.Quote{
+		ID:      id,
+		Option:  &carriers.DeliveryOption{Provider: "test", Arrival: arrival},
+		Booking: &carriers.Booking{Reference: "TEST-" + id, Provider: "test"},
+	}
+}
+
+func TestRetention(t *testing.T) {
+	start := time.Date(2023, 9, 9, 12, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+
+	tr := New(map[string]Profile{"test": {Speed: 1}}, WithClock(clk), WithRetention(time.Hour))
+
+	s, err := tr.Create(bookedQuote("q-1", start.Add(24*time.Hour)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Delivered, but within the retention.
+	tr.Advance(start.Add(24*time.Hour + 30*time.Minute))
+
+	got, err := tr.Get(s.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.State != StateDelivered {
+		t.Fatalf("expected %s, got %s", StateDelivered, got.State)
+	}
+
+	tr.Advance(start.Add(25*time.Hour + time.Second))
+
+	if _, err := tr.Get(s.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the delivered shipment to be removed, got %v", err)
+	}
+
+	if tr.Len() != 0 {
+		t.Errorf("expected no shipments, got %d", tr.Len())
+	}
+}
+
+func TestRun(t *testing.T) {
+	start := time.Date(2023, 9, 9, 12, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+
+	tr := New(map[string]Profile{"test": {Speed: 1}}, WithClock(clk))
+
+	s, err := tr.Create(bookedQuote("q-1", start.Add(24*time.Hour)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		tr.Run(ctx, time.Hour)
+		close(done)
+	}()
+
+	// Each hour that passes on the clock advances the shipments; the package is picked up 2 hours after the label is
+	// created.
+	for i := 0; i < 2; i++ {
+		for clk.Waiters() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		clk.Advance(time.Hour)
+	}
+
+	// Wait for the second advance to be handled, which happens before Run waits again.
+	for clk.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	<-done
+
+	got, err := tr.Get(s.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.State != StatePickedUp {
+		t.Errorf("expected %s, got %s", StatePickedUp, got.State)
+	}
+
+	if want := start.Add(2 * time.Hour); !got.Updated.Equal(want) {
+		t.Errorf("expected the state to change at %s, got %s", want, got.Updated)
+	}
+}
+
+func TestRand(t *testing.T) {
+	start := time.Date(2023, 9, 9, 12, 0, 0, 0, time.UTC)
+
+	// states creates shipments with a tracker seeded from seed, and returns the state each ends in.
+	states := func(seed int64) []State {
+		tr := New(map[string]Profile{"test": {Speed: 1, ExceptionRate: 0.5}}, WithClock(clock.NewFake(start)), WithRand(rand.New(rand.NewSource(seed))), WithRetention(time.Hour))
+
+		ids := []string{}
+		for i := 0; i < 50; i++ {
+			s, err := tr.Create(bookedQuote(fmt.Sprintf("q-%d", i), start.Add(24*time.Hour)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ids = append(ids, s.ID)
+		}
+
+		tr.Advance(start.Add(24 * time.Hour))
+
+		out := []State{}
+		for _, id := range ids {
+			s, err := tr.Get(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			out = append(out, s.State)
+		}
+
+		return out
+	}
+
+	a, b := states(42), states(42)
+	if !slices.Equal(a, b) {
+		t.Errorf("expected the same seed to give the same shipments, got %v and %v", a, b)
+	}
+
+	if !slices.Contains(a, StateException) || !slices.Contains(a, StateDelivered) {
+		t.Errorf("expected some shipments to go wrong, and some to be delivered, got %v", a)
+	}
+
+	if slices.Equal(a, states(43)) {
+		t.Errorf("expected another seed to give other shipments, got %v", a)
+	}
+}
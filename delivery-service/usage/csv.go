@@ -0,0 +1,52 @@
+package usage
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// MonthFormat is how months are written when requesting an export.
+const MonthFormat = "2006-01"
+
+// Month returns the first and last day of the month (as per MonthFormat), for use with Report.
+func Month(month string) (from, to string, err error) {
+	t, err := time.Parse(MonthFormat, month)
+	if err != nil {
+		return "", "", err
+	}
+
+	return t.Format(DayFormat), t.AddDate(0, 1, -1).Format(DayFormat), nil
+}
+
+// WriteCSV writes the rows as CSV, with a header.
+func WriteCSV(w io.Writer, rows []Row) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write([]string{"day", "client", "requests", "carrier_calls", "errors"}); err != nil {
+		return err
+	}
+
+	for _, r := range rows {
+		err := cw.Write([]string{
+			r.Day,
+			r.Client,
+			strconv.FormatInt(r.Requests, 10),
+			strconv.FormatInt(r.CarrierCalls, 10),
+			strconv.FormatInt(r.Errors, 10),
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("failed to write csv: %w", err)
+	}
+
+	return nil
+}
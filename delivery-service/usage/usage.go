@@ -0,0 +1,304 @@
+// package usage accounts for who is using the service, and how much, such that internal teams can be billed for it.
+package usage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/clock"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	ErrFailedToOpen  = errors.New("failed to open usage store")
+	ErrFailedToFlush = errors.New("failed to flush usage")
+	ErrFailedToRead  = errors.New("failed to read usage")
+)
+
+// HeaderAPIKey is the header that clients identify themselves with.
+const HeaderAPIKey = "X-API-Key"
+
+// DayFormat is how days are written, both in the store and in reports.
+const DayFormat = "2006-01-02"
+
+// bucket is the bbolt bucket that daily usage is stored in, keyed by "<day>/<client>".
+var bucket = []byte("daily")
+
+// Counts are how much a client used the service.
+type Counts struct {
+	// Requests is the number of requests the client made.
+	Requests int64 `json:"requests"`
+
+	// CarrierCalls is the number of times a carrier was queried on behalf of the client.
+	CarrierCalls int64 `json:"carrier_calls"`
+
+	// Errors is the number of requests that were not successful.
+	Errors int64 `json:"errors"`
+}
+
+// add adds the other counts to these.
+func (c *Counts) add(o Counts) {
+	c.Requests += o.Requests
+	c.CarrierCalls += o.CarrierCalls
+	c.Errors += o.Errors
+}
+
+// Row is the usage of a single client, on a single day.
+type Row struct {
+	Day    string `json:"day"`
+	Client string `json:"client"`
+	Counts
+}
+
+// key identifies a row.
+type key struct {
+	day, client string
+}
+
+// Store accumulates usage in memory, and periodically flushes it to an embedded (bbolt) database so that it survives
+// restarts.
+type Store struct {
+	mu sync.Mutex
+
+	// pending is usage that has not yet been flushed.
+	pending map[key]Counts
+
+	// memory is the flushed usage, when there is no database.
+	memory map[key]Counts
+
+	// db is where flushed usage is kept. May be nil.
+	db *bolt.DB
+
+	// clock is what the usage is flushed by.
+	clock clock.Clock
+}
+
+// Option modifies the store as it is opened.
+type Option func(s *Store)
+
+// WithClock sets the clock that the usage is flushed by.
+func WithClock(c clock.Clock) Option {
+	return func(s *Store) {
+		s.clock = c
+	}
+}
+
+// Open creates a store. If the path is empty, usage is only kept in memory.
+func Open(path string, opts ...Option) (*Store, error) {
+	s := &Store{
+		pending: make(map[key]Counts),
+		memory:  make(map[key]Counts),
+	}
+
+	for _, o := range opts {
+		o(s)
+	}
+
+	s.clock = clock.Or(s.clock)
+
+	if path == "" {
+		return s, nil
+	}
+
+	// The database is locked while open. Rather than waiting forever if another process has it, give up.
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFailedToOpen, err)
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%w: %s", ErrFailedToOpen, err)
+	}
+
+	s.db = db
+
+	return s, nil
+}
+
+// Identify works out who the client making the request is. Clients that send an API key are identified by a
+// fingerprint of it (so that the key itself is never stored); all others by their IP address.
+func Identify(r *http.Request) string {
+	if k := r.Header.Get(HeaderAPIKey); k != "" {
+		sum := sha256.Sum256([]byte(k))
+		return "key:" + hex.EncodeToString(sum[:])[:16]
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return "ip:" + host
+}
+
+// Record adds usage for the client, on the day of the supplied time.
+func (s *Store) Record(client string, at time.Time, c Counts) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := key{day: at.UTC().Format(DayFormat), client: client}
+
+	counts := s.pending[k]
+	counts.add(c)
+	s.pending[k] = counts
+}
+
+// Flush writes the pending usage to the database.
+func (s *Store) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.pending) == 0 {
+		return nil
+	}
+
+	if s.db == nil {
+		for k, c := range s.pending {
+			counts := s.memory[k]
+			counts.add(c)
+			s.memory[k] = counts
+		}
+
+		s.pending = make(map[key]Counts)
+		return nil
+	}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+
+		for k, c := range s.pending {
+			id := []byte(k.day + "/" + k.client)
+
+			counts := Counts{}
+			if v := b.Get(id); v != nil {
+				if err := json.Unmarshal(v, &counts); err != nil {
+					return err
+				}
+			}
+
+			counts.add(c)
+
+			v, err := json.Marshal(counts)
+			if err != nil {
+				return err
+			}
+
+			if err := b.Put(id, v); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrFailedToFlush, err)
+	}
+
+	s.pending = make(map[key]Counts)
+
+	return nil
+}
+
+// Report returns the usage between the two days (inclusive, as per DayFormat), optionally for a single client,
+// ordered by day and then client.
+func (s *Store) Report(from, to, client string) ([]Row, error) {
+	if err := s.Flush(); err != nil {
+		return nil, err
+	}
+
+	rows := []Row{}
+	include := func(day, c string) bool {
+		return day >= from && day <= to && (client == "" || client == c)
+	}
+
+	if s.db == nil {
+		s.mu.Lock()
+		for k, c := range s.memory {
+			if include(k.day, k.client) {
+				rows = append(rows, Row{Day: k.day, Client: k.client, Counts: c})
+			}
+		}
+		s.mu.Unlock()
+	} else {
+		err := s.db.View(func(tx *bolt.Tx) error {
+			cur := tx.Bucket(bucket).Cursor()
+
+			// Keys start with the day, so the cursor can skip straight to the first day in the range.
+			for k, v := cur.Seek([]byte(from)); k != nil; k, v = cur.Next() {
+				day, c, _ := strings.Cut(string(k), "/")
+				if day > to {
+					break
+				}
+
+				if !include(day, c) {
+					continue
+				}
+
+				r := Row{Day: day, Client: c}
+				if err := json.Unmarshal(v, &r.Counts); err != nil {
+					return err
+				}
+
+				rows = append(rows, r)
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrFailedToRead, err)
+		}
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Day != rows[j].Day {
+			return rows[i].Day < rows[j].Day
+		}
+
+		return rows[i].Client < rows[j].Client
+	})
+
+	return rows, nil
+}
+
+// Run flushes the usage every interval, until the context is cancelled.
+func (s *Store) Run(ctx context.Context, interval time.Duration) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.clock.After(interval):
+			// Hint: Failures are ignored, as the usage remains pending and is retried on the next tick. How would we
+			// know if it never succeeds?
+			s.Flush()
+		}
+	}
+}
+
+// Close flushes any pending usage, and closes the database.
+func (s *Store) Close() error {
+	if err := s.Flush(); err != nil {
+		return err
+	}
+
+	if s.db == nil {
+		return nil
+	}
+
+	return s.db.Close()
+}
@@ -0,0 +1,123 @@
+package usage
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/andrewhowdencom/courses.pito/delivery-service/clock"
+)
+
+func TestExport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.db")
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sep := time.Date(2023, 9, 30, 23, 59, 0, 0, time.UTC)
+
+	s.Record("ip:127.0.0.1", sep, Counts{Requests: 1, CarrierCalls: 3})
+	s.Record("ip:127.0.0.1", sep, Counts{Requests: 1, Errors: 1})
+	s.Record("key:abc", sep.AddDate(0, 0, -29), Counts{Requests: 1, CarrierCalls: 2})
+
+	// Flushed usage is added to, rather than replaced.
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	s.Record("key:abc", sep.AddDate(0, 0, -29), Counts{Requests: 1, CarrierCalls: 1})
+
+	// Neither of the months either side is exported.
+	s.Record("ip:127.0.0.1", sep.Add(time.Minute), Counts{Requests: 1})
+	s.Record("ip:127.0.0.1", sep.AddDate(0, -1, 0), Counts{Requests: 1})
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The usage survives the store being closed, and opened again.
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	from, to, err := Month("2023-09")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := s.Report(from, to, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	if err := WriteCSV(&b, rows); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "day,client,requests,carrier_calls,errors\n" +
+		"2023-09-01,key:abc,2,3,0\n" +
+		"2023-09-30,ip:127.0.0.1,2,3,1\n"
+
+	if b.String() != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, b.String())
+	}
+}
+
+func TestRun(t *testing.T) {
+	clk := clock.NewFake(time.Date(2023, 9, 9, 12, 0, 0, 0, time.UTC))
+
+	s, err := Open(filepath.Join(t.TempDir(), "usage.db"), WithClock(clk))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	s.Record("ip:127.0.0.1", clk.Now(), Counts{Requests: 1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		s.Run(ctx, 10*time.Second)
+		close(done)
+	}()
+
+	// pending is the usage that is yet to be flushed.
+	pending := func() int {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		return len(s.pending)
+	}
+
+	for clk.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	clk.Advance(9 * time.Second)
+
+	if pending() != 1 {
+		t.Fatalf("expected the usage not to be flushed before the interval")
+	}
+
+	clk.Advance(time.Second)
+
+	// The usage is flushed before Run waits again.
+	for clk.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if pending() != 0 {
+		t.Errorf("expected the usage to be flushed once the interval passed")
+	}
+
+	cancel()
+	<-done
+}